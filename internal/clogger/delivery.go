@@ -0,0 +1,41 @@
+package clogger
+
+import "sync/atomic"
+
+// Delivery tracks the copies of a message that are still making their way through the pipeline, for inputs that
+// need to know once it's been delivered (e.g. to commit offsets). Every copy is either delivered by an output, or
+// deliberately dropped (e.g. by a filter), at which point it's Done. Once all the copies are Done, the callback is called.
+// All the methods are no-ops on a nil Delivery, which is what messages from most inputs have
+type Delivery struct {
+	pending int64
+	done    func()
+}
+
+// NewDelivery constructs a Delivery for the given number of copies (e.g. all the messages parsed from one record),
+// which calls done once they've all been delivered
+func NewDelivery(copies int, done func()) *Delivery {
+	return &Delivery{
+		pending: int64(copies),
+		done:    done,
+	}
+}
+
+// Add registers n more copies, e.g. when a message is sent to more than one step
+func (d *Delivery) Add(n int) {
+	if d == nil {
+		return
+	}
+
+	atomic.AddInt64(&d.pending, int64(n))
+}
+
+// Done marks a single copy as delivered
+func (d *Delivery) Done() {
+	if d == nil {
+		return
+	}
+
+	if atomic.AddInt64(&d.pending, -1) == 0 {
+		d.done()
+	}
+}
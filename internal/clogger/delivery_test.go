@@ -0,0 +1,33 @@
+package clogger_test
+
+import (
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+func TestDelivery(t *testing.T) {
+	delivered := 0
+	delivery := clogger.NewDelivery(2, func() {
+		delivered++
+	})
+
+	// The second message gets fanned out to two steps
+	delivery.Add(1)
+	for i := 0; i < 2; i++ {
+		delivery.Done()
+		if delivered != 0 {
+			t.Fatal("Expected the delivery not to complete with copies still pending")
+		}
+	}
+
+	delivery.Done()
+	if delivered != 1 {
+		t.Fatalf("Expected the delivery to complete once, got %d", delivered)
+	}
+
+	// Messages without a delivery can be marked all the same
+	var none *clogger.Delivery
+	none.Add(1)
+	none.Done()
+}
@@ -0,0 +1,394 @@
+package clogger
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the binary encoding. See message.proto for the schema
+const (
+	batchMessagesField = 1
+
+	messageEventTimeField  = 1
+	messageFieldsField     = 2
+	messageIngestTimeField = 3
+	messageMetadataField   = 4
+
+	metadataKeyField   = 1
+	metadataValueField = 2
+
+	fieldKeyField   = 1
+	fieldValueField = 2
+
+	valueNullField   = 1
+	valueBoolField   = 2
+	valueIntField    = 3
+	valueUintField   = 4
+	valueFloatField  = 5
+	valueStringField = 6
+	valueBytesField  = 7
+	valueListField   = 8
+	valueMapField    = 9
+	valueTimeField   = 10
+
+	listValuesField = 1
+	mapFieldsField  = 1
+)
+
+// MarshalBinary encodes the message in the binary format described in message.proto. Unlike JSON, this preserves
+// the timestamp, and the difference between ints, floats, strings and bytes
+func (m *Message) MarshalBinary() ([]byte, error) {
+	return AppendMessage(nil, m), nil
+}
+
+// UnmarshalBinary decodes a message encoded with MarshalBinary, replacing the contents of m
+func (m *Message) UnmarshalBinary(data []byte) error {
+	decoded, err := decodeMessage(data)
+	if err != nil {
+		return err
+	}
+
+	*m = decoded
+	return nil
+}
+
+// AppendMessage appends the binary encoding of the given message to b
+func AppendMessage(b []byte, m *Message) []byte {
+	if !m.EventTime.IsZero() {
+		b = protowire.AppendTag(b, messageEventTimeField, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(m.EventTime.UnixNano()))
+	}
+
+	if !m.IngestTime.IsZero() {
+		b = protowire.AppendTag(b, messageIngestTimeField, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(m.IngestTime.UnixNano()))
+	}
+
+	// Sort the keys so that encoding the same message always produces the same bytes
+	keys := make([]string, 0, len(m.ParsedFields))
+	for key := range m.ParsedFields {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		b = protowire.AppendTag(b, messageFieldsField, protowire.BytesType)
+		b = protowire.AppendBytes(b, appendField(nil, key, m.ParsedFields[key]))
+	}
+
+	keys = keys[:0]
+	for key := range m.Metadata {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var entry []byte
+		entry = protowire.AppendTag(entry, metadataKeyField, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, metadataValueField, protowire.BytesType)
+		entry = protowire.AppendString(entry, m.Metadata[key])
+
+		b = protowire.AppendTag(b, messageMetadataField, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	return b
+}
+
+// MarshalBatch encodes the given messages as a MessageBatch
+func MarshalBatch(messages []Message) []byte {
+	var b []byte
+	for i := range messages {
+		b = protowire.AppendTag(b, batchMessagesField, protowire.BytesType)
+		b = protowire.AppendBytes(b, AppendMessage(nil, &messages[i]))
+	}
+
+	return b
+}
+
+// UnmarshalBatch decodes a MessageBatch encoded with MarshalBatch
+func UnmarshalBatch(data []byte) ([]Message, error) {
+	messages := []Message{}
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		if num != batchMessagesField || typ != protowire.BytesType {
+			return nil
+		}
+
+		m, err := decodeMessage(value)
+		if err != nil {
+			return err
+		}
+
+		messages = append(messages, m)
+		return nil
+	})
+
+	return messages, err
+}
+
+func appendField(b []byte, key string, value interface{}) []byte {
+	b = protowire.AppendTag(b, fieldKeyField, protowire.BytesType)
+	b = protowire.AppendString(b, key)
+	b = protowire.AppendTag(b, fieldValueField, protowire.BytesType)
+	b = protowire.AppendBytes(b, appendValue(nil, value))
+	return b
+}
+
+func appendValue(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		b = protowire.AppendTag(b, valueNullField, protowire.VarintType)
+		return protowire.AppendVarint(b, 1)
+	case bool:
+		b = protowire.AppendTag(b, valueBoolField, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeBool(v))
+	case string:
+		b = protowire.AppendTag(b, valueStringField, protowire.BytesType)
+		return protowire.AppendString(b, v)
+	case []byte:
+		b = protowire.AppendTag(b, valueBytesField, protowire.BytesType)
+		return protowire.AppendBytes(b, v)
+	case time.Time:
+		b = protowire.AppendTag(b, valueTimeField, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, uint64(v.UnixNano()))
+	case []interface{}:
+		var list []byte
+		for _, item := range v {
+			list = protowire.AppendTag(list, listValuesField, protowire.BytesType)
+			list = protowire.AppendBytes(list, appendValue(nil, item))
+		}
+
+		b = protowire.AppendTag(b, valueListField, protowire.BytesType)
+		return protowire.AppendBytes(b, list)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		var fields []byte
+		for _, key := range keys {
+			fields = protowire.AppendTag(fields, mapFieldsField, protowire.BytesType)
+			fields = protowire.AppendBytes(fields, appendField(nil, key, v[key]))
+		}
+
+		b = protowire.AppendTag(b, valueMapField, protowire.BytesType)
+		return protowire.AppendBytes(b, fields)
+	}
+
+	// Fall back to reflection for the other numeric types, and slices and maps that aren't of interface{}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b = protowire.AppendTag(b, valueIntField, protowire.VarintType)
+		return protowire.AppendVarint(b, protowire.EncodeZigZag(rv.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b = protowire.AppendTag(b, valueUintField, protowire.VarintType)
+		return protowire.AppendVarint(b, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		b = protowire.AppendTag(b, valueFloatField, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(rv.Float()))
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+
+		return appendValue(b, list)
+	case reflect.Map:
+		if rv.Type().Key().Kind() == reflect.String {
+			m := make(map[string]interface{}, rv.Len())
+			iter := rv.MapRange()
+			for iter.Next() {
+				m[iter.Key().String()] = iter.Value().Interface()
+			}
+
+			return appendValue(b, m)
+		}
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return appendValue(b, nil)
+		}
+
+		return appendValue(b, rv.Elem().Interface())
+	}
+
+	// Anything else (e.g. structs) gets stringified, rather than dropping the message
+	return appendValue(b, fmt.Sprint(value))
+}
+
+// walkFields calls the given function for every field in the given encoded protobuf message. value is the contents
+// of length delimited fields, and varint is the value of varint and fixed width fields
+func walkFields(data []byte, f func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+
+		var value []byte
+		var varint uint64
+		switch typ {
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(data)
+		case protowire.Fixed64Type:
+			varint, n = protowire.ConsumeFixed64(data)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(data)
+			varint = uint64(v)
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		data = data[n:]
+		if err := f(num, typ, value, varint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeMessage(data []byte) (Message, error) {
+	m := Message{
+		ParsedFields: make(map[string]interface{}),
+	}
+
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		switch num {
+		case messageEventTimeField:
+			m.EventTime = time.Unix(0, int64(varint))
+		case messageIngestTimeField:
+			m.IngestTime = time.Unix(0, int64(varint))
+		case messageFieldsField:
+			key, v, err := decodeField(value)
+			if err != nil {
+				return err
+			}
+
+			m.ParsedFields[key] = v
+		case messageMetadataField:
+			var metaKey, metaValue string
+			err := walkFields(value, func(num protowire.Number, typ protowire.Type, data []byte, _ uint64) error {
+				switch num {
+				case metadataKeyField:
+					metaKey = string(data)
+				case metadataValueField:
+					metaValue = string(data)
+				}
+
+				return nil
+			})
+
+			if err != nil {
+				return err
+			}
+
+			m.SetMetadata(metaKey, metaValue)
+		}
+
+		return nil
+	})
+
+	return m, err
+}
+
+func decodeField(data []byte) (string, interface{}, error) {
+	var key string
+	var value interface{}
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, data []byte, _ uint64) error {
+		var err error
+		switch num {
+		case fieldKeyField:
+			key = string(data)
+		case fieldValueField:
+			value, err = decodeValue(data)
+		}
+
+		return err
+	})
+
+	return key, value, err
+}
+
+// decodeValue decodes a single Value. Values without a kind that we know about (e.g. from a newer version of the schema) decode to nil
+func decodeValue(data []byte) (interface{}, error) {
+	var value interface{}
+	err := walkFields(data, func(num protowire.Number, typ protowire.Type, data []byte, varint uint64) error {
+		switch num {
+		case valueNullField:
+			value = nil
+		case valueBoolField:
+			value = protowire.DecodeBool(varint)
+		case valueIntField:
+			value = protowire.DecodeZigZag(varint)
+		case valueUintField:
+			value = varint
+		case valueFloatField:
+			value = math.Float64frombits(varint)
+		case valueStringField:
+			value = string(data)
+		case valueBytesField:
+			value = append([]byte{}, data...)
+		case valueTimeField:
+			value = time.Unix(0, int64(varint))
+		case valueListField:
+			list := []interface{}{}
+			err := walkFields(data, func(num protowire.Number, _ protowire.Type, data []byte, _ uint64) error {
+				if num != listValuesField {
+					return nil
+				}
+
+				item, err := decodeValue(data)
+				list = append(list, item)
+				return err
+			})
+
+			if err != nil {
+				return err
+			}
+
+			value = list
+		case valueMapField:
+			m := map[string]interface{}{}
+			err := walkFields(data, func(num protowire.Number, _ protowire.Type, data []byte, _ uint64) error {
+				if num != mapFieldsField {
+					return nil
+				}
+
+				key, item, err := decodeField(data)
+				m[key] = item
+				return err
+			})
+
+			if err != nil {
+				return err
+			}
+
+			value = m
+		}
+
+		return nil
+	})
+
+	return value, err
+}
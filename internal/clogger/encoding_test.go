@@ -0,0 +1,65 @@
+package clogger_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+func TestBinaryEncodingRoundTrip(t *testing.T) {
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+	msg.ParsedFields["int"] = int64(-42)
+	msg.ParsedFields["uint"] = uint64(42)
+	msg.ParsedFields["float"] = 4.2
+	msg.ParsedFields["bool"] = true
+	msg.ParsedFields["nil"] = nil
+	msg.ParsedFields["bytes"] = []byte{0, 1, 2}
+	msg.ParsedFields["time"] = time.Unix(1600000000, 123)
+	msg.ParsedFields["list"] = []interface{}{"a", int64(1), []interface{}{2.5}}
+	msg.ParsedFields["map"] = map[string]interface{}{"nested": map[string]interface{}{"key": "value"}}
+	msg.SetMetadata(clogger.METADATA_PEER_ADDR, "127.0.0.1:1234")
+	msg.SetMetadata(clogger.METADATA_INPUT, "tcp_in")
+
+	data, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := clogger.Message{}
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(msg, decoded) {
+		t.Fatalf("Message didn't round trip.\nExpected: %#v\nGot:      %#v", msg, decoded)
+	}
+}
+
+func TestBinaryEncodingWidensTypes(t *testing.T) {
+	msg := clogger.NewMessage()
+	msg.ParsedFields["int"] = 42
+	msg.ParsedFields["float32"] = float32(1.5)
+	msg.ParsedFields["strings"] = []string{"a", "b"}
+
+	batch, err := clogger.UnmarshalBatch(clogger.MarshalBatch([]clogger.Message{msg, msg}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batch) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(batch))
+	}
+
+	expected := map[string]interface{}{
+		"int":     int64(42),
+		"float32": float64(1.5),
+		"strings": []interface{}{"a", "b"},
+	}
+
+	if !reflect.DeepEqual(batch[1].ParsedFields, expected) {
+		t.Fatalf("Expected %#v, got %#v", expected, batch[1].ParsedFields)
+	}
+}
@@ -0,0 +1,33 @@
+package clogger
+
+import "strings"
+
+// PATH_SEPARATOR separates the keys of nested maps in field paths, e.g. `http.request.method`
+const PATH_SEPARATOR = "."
+
+// GetPath returns the value at the given dotted path in the fields, and whether it exists
+func GetPath(fields map[string]interface{}, path string) (interface{}, bool) {
+	// Prefer a literal key, so that fields with dots in their names are still reachable
+	if value, ok := fields[path]; ok {
+		return value, true
+	}
+
+	parts := strings.Split(path, PATH_SEPARATOR)
+	current := fields
+	for i, part := range parts {
+		value, ok := current[part]
+		if !ok {
+			return nil, false
+		}
+
+		if i == len(parts)-1 {
+			return value, true
+		}
+
+		if current, ok = value.(map[string]interface{}); !ok {
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
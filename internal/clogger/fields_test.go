@@ -0,0 +1,35 @@
+package clogger_test
+
+import (
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+func TestGetPath(t *testing.T) {
+	fields := map[string]interface{}{
+		"http":        map[string]interface{}{"status": 500, "request": map[string]interface{}{"method": "GET"}},
+		"http.status": "literal",
+		"level":       "error",
+	}
+
+	tests := []struct {
+		path     string
+		expected interface{}
+		found    bool
+	}{
+		{"level", "error", true},
+		{"http.request.method", "GET", true},
+		{"http.status", "literal", true},
+		{"http.missing", nil, false},
+		{"level.nested", nil, false},
+		{"missing", nil, false},
+	}
+
+	for _, test := range tests {
+		value, ok := clogger.GetPath(fields, test.path)
+		if value != test.expected || ok != test.found {
+			t.Errorf("Expected `%s` to get (%v, %v), got (%v, %v)", test.path, test.expected, test.found, value, ok)
+		}
+	}
+}
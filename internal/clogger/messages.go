@@ -1,6 +1,7 @@
 package clogger
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -9,27 +10,111 @@ const DEFAULT_BATCH_SIZE = 100
 const DEFAULT_FLUSH_DURATION = 10 * time.Millisecond
 const MESSAGE_FIELD = "message"
 
+// Well known metadata keys
+const (
+	// METADATA_SOURCE_NODE is the hostname of the clogger instance that first received the message
+	METADATA_SOURCE_NODE = "source_node"
+
+	// METADATA_INPUT is the name of the input step that received the message
+	METADATA_INPUT = "input"
+
+	// METADATA_INPUT_TYPE is the type of the input that received the message, e.g. `tcp`
+	METADATA_INPUT_TYPE = "input_type"
+
+	// METADATA_PEER_ADDR is the address of the client that sent the message
+	METADATA_PEER_ADDR = "peer_addr"
+
+	// METADATA_JOURNALD_CURSOR is the journald cursor of the entry that the message was read from
+	METADATA_JOURNALD_CURSOR = "journald_cursor"
+
+	// METADATA_TAG is the tag that the message was sent with, for protocols that have them (e.g. Fluent Forward)
+	METADATA_TAG = "tag"
+)
+
 type MessageChannel = chan *MessageBatch
 type MessageBatch struct {
 	Messages []Message
 }
 
 type Message struct {
-	MonoTimestamp int64
-	ParsedFields  map[string]interface{}
+	// EventTime is when the event described by the message happened. This starts off as the IngestTime,
+	// and gets replaced by inputs (or filters) that can find out the time from the source
+	EventTime time.Time
+
+	// IngestTime is when the message was first received by clogger
+	IngestTime time.Time
+
+	ParsedFields map[string]interface{}
+
+	// Metadata holds information about the message (e.g. where it came from) that isn't part of the log itself,
+	// so doesn't get formatted unless an output asks for it. It's nil until something gets set
+	Metadata map[string]string
+
+	// Delivery tracks when the message has been delivered, for inputs that need to know. It's nil otherwise
+	Delivery *Delivery
 }
 
 func NewMessage() Message {
+	// Strip the monotonic clock reading, which is meaningless once the message leaves this process
+	now := time.Now().Round(0)
 	return Message{
-		MonoTimestamp: time.Now().UnixNano(),
-		ParsedFields:  make(map[string]interface{}),
+		EventTime:    now,
+		IngestTime:   now,
+		ParsedFields: make(map[string]interface{}),
+	}
+}
+
+// SetMetadata sets the given metadata key on the message, allocating the metadata map if necessary
+func (m *Message) SetMetadata(key, value string) {
+	if m.Metadata == nil {
+		m.Metadata = make(map[string]string)
 	}
+
+	m.Metadata[key] = value
+}
+
+// GetMetadata returns the value of the given metadata key, and whether it was set
+func (m *Message) GetMetadata(key string) (string, bool) {
+	value, ok := m.Metadata[key]
+	return value, ok
+}
+
+type metadataContextKey struct{}
+
+// ContextWithMetadata returns a copy of the context carrying the given metadata (on top of any the context
+// already has), which parsers add to all the messages they parse with that context
+func ContextWithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	merged := make(map[string]string, len(metadata))
+	for key, value := range MetadataFromContext(ctx) {
+		merged[key] = value
+	}
+
+	for key, value := range metadata {
+		merged[key] = value
+	}
+
+	return context.WithValue(ctx, metadataContextKey{}, merged)
+}
+
+// AddMetadataFromContext sets all the metadata attached to the context with ContextWithMetadata on the message
+func (m *Message) AddMetadataFromContext(ctx context.Context) {
+	for key, value := range MetadataFromContext(ctx) {
+		m.SetMetadata(key, value)
+	}
+}
+
+// MetadataFromContext returns the metadata attached to the context with ContextWithMetadata, if any
+func MetadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(metadataContextKey{}).(map[string]string)
+	return metadata
 }
 
 func (m *Message) Reset() {
 	for k := range m.ParsedFields {
 		delete(m.ParsedFields, k)
 	}
+
+	m.Metadata = nil
 }
 
 var batchPool sync.Pool
@@ -68,6 +153,13 @@ func CloneBatch(m *MessageBatch) *MessageBatch {
 	return batch
 }
 
+// Delivered marks all the messages in the batch as delivered
+func (m *MessageBatch) Delivered() {
+	for i := range m.Messages {
+		m.Messages[i].Delivery.Done()
+	}
+}
+
 func PutMessageBatch(m *MessageBatch) {
 	batchPool.Put(m)
 }
@@ -49,17 +49,24 @@ func NewTLSConfigFromRaw(raw map[string]string) (TLSConfig, error) {
 	return NewTLSConfig(caFile, certPath, keyPath)
 }
 
-func (t *TLSConfig) isEnabled() bool {
+// IsEnabled returns true if this TLS config has any certificates configured
+func (t *TLSConfig) IsEnabled() bool {
 	return t.cert != nil || t.caCerts != nil
 }
 
 // WrapListener returns the given listener wrapped by the TLS config
 // If this TLS config is empty, this just returns the given wrapper
 func (t *TLSConfig) WrapListener(n net.Listener) net.Listener {
-	if !t.isEnabled() {
+	if !t.IsEnabled() {
 		return n
 	}
 
+	return tls.NewListener(n, t.ServerConfig())
+}
+
+// ServerConfig returns a tls.Config that can be used to serve TLS, presenting the configured cert
+// and verifying client certs against the configured CA certs, if any
+func (t *TLSConfig) ServerConfig() *tls.Config {
 	conf := tls.Config{}
 
 	if t.cert != nil {
@@ -70,5 +77,21 @@ func (t *TLSConfig) WrapListener(n net.Listener) net.Listener {
 		conf.ClientCAs = t.caCerts
 	}
 
-	return tls.NewListener(n, &conf)
+	return &conf
+}
+
+// ClientConfig returns a tls.Config that can be used to connect to a server, trusting the configured
+// CA certs (or the system roots if none are configured) and presenting the configured client cert, if any
+func (t *TLSConfig) ClientConfig() *tls.Config {
+	conf := tls.Config{}
+
+	if t.cert != nil {
+		conf.Certificates = []tls.Certificate{*t.cert}
+	}
+
+	if t.caCerts != nil {
+		conf.RootCAs = t.caCerts
+	}
+
+	return &conf
 }
@@ -0,0 +1,508 @@
+package filters
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/metrics"
+)
+
+const DEFAULT_AGGREGATE_WINDOW = time.Minute
+const DEFAULT_AGGREGATE_MAX_GROUPS = 10000
+const DEFAULT_AGGREGATE_MAX_SAMPLES = 1000
+
+// OVERFLOW_GROUP_VALUE is the value given to the group by fields of the group that collects messages past the max groups in a window,
+// and to the partition fields of the rate limit summary that collects the drops of evicted partitions past the max
+const OVERFLOW_GROUP_VALUE = "__other__"
+
+const (
+	AGGREGATE_COUNT_FIELD        = "count"
+	AGGREGATE_WINDOW_START_FIELD = "window_start"
+	AGGREGATE_WINDOW_END_FIELD   = "window_end"
+)
+
+type AggregateTimeMode string
+
+const (
+	// AGGREGATE_PROCESSING_TIME puts messages in windows by when they reach the filter
+	AGGREGATE_PROCESSING_TIME AggregateTimeMode = "processing"
+
+	// AGGREGATE_EVENT_TIME puts messages in windows by their event time. Windows close once the latest event time seen,
+	// minus the allowed lateness, passes their end. The watermark never moves past the current time, so that
+	// a message with a timestamp in the future can't close windows early. If no messages arrive for a window length,
+	// the watermark moves on with the current time instead, so that the last windows still close when the input goes quiet
+	AGGREGATE_EVENT_TIME AggregateTimeMode = "event"
+)
+
+type LatePolicy string
+
+const (
+	LATE_DROP LatePolicy = "drop"
+	LATE_PASS LatePolicy = "pass"
+)
+
+// aggregateReservedFields are the fields that summaries set themselves, and so can't be grouped by or aggregated over
+var aggregateReservedFields = []string{
+	clogger.MESSAGE_FIELD,
+	AGGREGATE_COUNT_FIELD,
+	AGGREGATE_WINDOW_START_FIELD,
+	AGGREGATE_WINDOW_END_FIELD,
+}
+
+// pathsOverlap returns whether setting one of the given paths would overwrite the other
+func pathsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
+
+// aggregateStats are the per field statistics that can be computed, aside from percentiles
+var aggregateStats = map[string]bool{
+	"sum": true,
+	"min": true,
+	"max": true,
+	"avg": true,
+}
+
+type AggregateFilterConfig struct {
+	// GroupBy are the fields that messages are grouped by. Empty puts all messages in a window into one group
+	GroupBy []string
+
+	// Fields are the numeric fields to compute statistics of
+	Fields []string
+
+	// Stats are the statistics to compute for each of the Fields - sum, min, max, avg
+	Stats []string
+
+	// Percentiles are the percentiles to compute for each of the Fields, from stats of the form `p99`
+	Percentiles []int
+
+	// Window is the length of each window, and Slide is how far apart windows start. Slide == Window for tumbling windows
+	Window time.Duration
+	Slide  time.Duration
+
+	// TimeMode picks whether windows are in event or processing time
+	TimeMode AggregateTimeMode
+
+	// AllowedLateness is how long event time windows are kept open after the latest event time passes their end
+	AllowedLateness time.Duration
+
+	// LatePolicy is what to do with messages that arrive after all the windows they belong to have closed
+	LatePolicy LatePolicy
+
+	// MaxGroups caps the number of groups per window. Messages past it are aggregated into a single overflow group
+	MaxGroups int
+
+	// MaxSamples caps the number of values per field per group that are kept for computing percentiles
+	MaxSamples int
+}
+
+func NewAggregateFilterConfigFromRaw(raw map[string]string) (AggregateFilterConfig, error) {
+	conf := AggregateFilterConfig{
+		GroupBy:    splitList(raw["group_by"]),
+		Fields:     splitList(raw["fields"]),
+		Window:     DEFAULT_AGGREGATE_WINDOW,
+		TimeMode:   AGGREGATE_PROCESSING_TIME,
+		LatePolicy: LATE_DROP,
+		MaxGroups:  DEFAULT_AGGREGATE_MAX_GROUPS,
+		MaxSamples: DEFAULT_AGGREGATE_MAX_SAMPLES,
+	}
+
+	for _, field := range conf.GroupBy {
+		for _, reserved := range aggregateReservedFields {
+			if pathsOverlap(field, reserved) {
+				return AggregateFilterConfig{}, fmt.Errorf("invalid group_by field `%s` in AggregateFilter - it would be overwritten by `%s` in the summaries", field, reserved)
+			}
+		}
+	}
+
+	for _, field := range conf.Fields {
+		for _, other := range append(aggregateReservedFields, conf.GroupBy...) {
+			if pathsOverlap(field, other) {
+				return AggregateFilterConfig{}, fmt.Errorf("invalid field `%s` in AggregateFilter - its stats would overwrite `%s` in the summaries", field, other)
+			}
+		}
+	}
+
+	stats := "sum,min,max,avg"
+	if s, ok := raw["stats"]; ok {
+		stats = s
+	}
+
+	for _, stat := range splitList(strings.ToLower(stats)) {
+		if aggregateStats[stat] {
+			conf.Stats = append(conf.Stats, stat)
+			continue
+		}
+
+		if strings.HasPrefix(stat, "p") {
+			if percentile, err := strconv.Atoi(stat[1:]); err == nil && percentile > 0 && percentile <= 100 {
+				conf.Percentiles = append(conf.Percentiles, percentile)
+				continue
+			}
+		}
+
+		return AggregateFilterConfig{}, fmt.Errorf("invalid stat `%s` in AggregateFilter - expected sum, min, max, avg or a percentile like p99", stat)
+	}
+
+	for key, dest := range map[string]*time.Duration{"window": &conf.Window, "slide": &conf.Slide, "allowed_lateness": &conf.AllowedLateness} {
+		if s, ok := raw[key]; ok {
+			val, err := time.ParseDuration(s)
+			if err != nil || val < 0 {
+				return AggregateFilterConfig{}, fmt.Errorf("invalid `%s` in AggregateFilter - expected a duration, got `%s`", key, s)
+			}
+
+			*dest = val
+		}
+	}
+
+	if conf.Window <= 0 {
+		return AggregateFilterConfig{}, fmt.Errorf("invalid `window` in AggregateFilter - expected a positive duration")
+	}
+
+	if conf.Slide == 0 {
+		conf.Slide = conf.Window
+	}
+
+	if conf.Slide > conf.Window || conf.Window%conf.Slide != 0 {
+		return AggregateFilterConfig{}, fmt.Errorf("invalid `slide` in AggregateFilter - expected a duration that evenly divides the window (%s), got %s", conf.Window, conf.Slide)
+	}
+
+	if s, ok := raw["time"]; ok {
+		conf.TimeMode = AggregateTimeMode(strings.ToLower(s))
+		if conf.TimeMode != AGGREGATE_PROCESSING_TIME && conf.TimeMode != AGGREGATE_EVENT_TIME {
+			return AggregateFilterConfig{}, fmt.Errorf("invalid `time` in AggregateFilter - expected processing or event, got `%s`", s)
+		}
+	}
+
+	if s, ok := raw["late"]; ok {
+		conf.LatePolicy = LatePolicy(strings.ToLower(s))
+		if conf.LatePolicy != LATE_DROP && conf.LatePolicy != LATE_PASS {
+			return AggregateFilterConfig{}, fmt.Errorf("invalid `late` in AggregateFilter - expected drop or pass, got `%s`", s)
+		}
+	}
+
+	for key, dest := range map[string]*int{"max_groups": &conf.MaxGroups, "max_samples": &conf.MaxSamples} {
+		if s, ok := raw[key]; ok {
+			val, err := strconv.Atoi(s)
+			if err != nil || val <= 0 {
+				return AggregateFilterConfig{}, fmt.Errorf("invalid `%s` in AggregateFilter - expected a positive int, got `%s`", key, s)
+			}
+
+			*dest = val
+		}
+	}
+
+	return conf, nil
+}
+
+// fieldAggregate holds the running statistics of one field in a group
+type fieldAggregate struct {
+	count    int
+	sum      float64
+	min      float64
+	max      float64
+	samples  []float64
+	observed int
+}
+
+func (f *fieldAggregate) add(value float64, maxSamples int, keepSamples bool) {
+	if f.count == 0 || value < f.min {
+		f.min = value
+	}
+
+	if f.count == 0 || value > f.max {
+		f.max = value
+	}
+
+	f.count++
+	f.sum += value
+
+	if !keepSamples {
+		return
+	}
+
+	// Reservoir sample the values, so that percentiles stay representative in bounded memory
+	f.observed++
+	if len(f.samples) < maxSamples {
+		f.samples = append(f.samples, value)
+	} else if i := rand.Intn(f.observed); i < maxSamples {
+		f.samples[i] = value
+	}
+}
+
+// percentile returns the given nearest-rank percentile of the sampled values, which must be sorted
+func percentile(sorted []float64, p int) float64 {
+	rank := int(math.Ceil(float64(p)/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+type groupAggregate struct {
+	fields map[string]interface{}
+	count  int
+	stats  map[string]*fieldAggregate
+}
+
+type aggregateWindow struct {
+	start  time.Time
+	groups map[string]*groupAggregate
+}
+
+// AggregateFilter is an EmittingFilter that replaces messages with per group statistics over windows of time
+type AggregateFilter struct {
+	AggregateFilterConfig
+
+	lock    sync.Mutex
+	windows map[int64]*aggregateWindow
+
+	// watermark is the latest event time seen, minus the allowed lateness, capped at the current time.
+	// Event time windows that end before it are closed
+	watermark time.Time
+
+	// lastMessage is when the latest message reached the filter
+	lastMessage time.Time
+}
+
+func NewAggregateFilter(conf AggregateFilterConfig) *AggregateFilter {
+	return &AggregateFilter{
+		AggregateFilterConfig: conf,
+		windows:               make(map[int64]*aggregateWindow),
+	}
+}
+
+// groupKey returns the key of the group the message belongs to, and the values of its group by fields
+func (a *AggregateFilter) groupKey(msg *clogger.Message) (string, map[string]interface{}) {
+	values := make(map[string]interface{}, len(a.GroupBy))
+	parts := make([]string, 0, len(a.GroupBy))
+	for _, field := range a.GroupBy {
+		value, ok := clogger.GetPath(msg.ParsedFields, field)
+		if ok {
+			values[field] = value
+		}
+
+		parts = append(parts, fmt.Sprint(value))
+	}
+
+	return strings.Join(parts, "\x00"), values
+}
+
+// closed returns whether the window starting at the given time has closed, given the current time
+func (a *AggregateFilter) closed(start time.Time, now time.Time) bool {
+	end := start.Add(a.Window)
+	if a.TimeMode == AGGREGATE_EVENT_TIME {
+		return !end.After(a.watermark)
+	}
+
+	return !end.After(now)
+}
+
+// advanceWatermark moves the watermark to the given event time minus the allowed lateness, if that's later
+// than the current watermark, without moving it past the current time
+func (a *AggregateFilter) advanceWatermark(eventTime time.Time, now time.Time) {
+	watermark := eventTime.Add(-a.AllowedLateness)
+	if watermark.After(now) {
+		watermark = now
+	}
+
+	if watermark.After(a.watermark) {
+		a.watermark = watermark
+	}
+}
+
+func (a *AggregateFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldDrop bool, err error) {
+	now := time.Now()
+	ts := now
+	if a.TimeMode == AGGREGATE_EVENT_TIME && !msg.EventTime.IsZero() {
+		ts = msg.EventTime
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.TimeMode == AGGREGATE_EVENT_TIME {
+		a.advanceWatermark(ts, now)
+	}
+
+	a.lastMessage = now
+
+	key, groupValues := a.groupKey(msg)
+	added := false
+
+	// Add the message to every window that covers its timestamp and is still open
+	for start := ts.Truncate(a.Slide); start.Add(a.Window).After(ts); start = start.Add(-a.Slide) {
+		if a.closed(start, now) {
+			continue
+		}
+
+		window, ok := a.windows[start.UnixNano()]
+		if !ok {
+			window = &aggregateWindow{
+				start:  start,
+				groups: make(map[string]*groupAggregate),
+			}
+
+			a.windows[start.UnixNano()] = window
+		}
+
+		a.addToWindow(window, key, groupValues, msg)
+		added = true
+	}
+
+	if !added {
+		if a.LatePolicy == LATE_PASS {
+			return false, nil
+		}
+
+		metrics.AggregateLateDropped.WithLabelValues(StepNameFromContext(ctx)).Inc()
+	}
+
+	return true, nil
+}
+
+func (a *AggregateFilter) addToWindow(window *aggregateWindow, key string, groupValues map[string]interface{}, msg *clogger.Message) {
+	group, ok := window.groups[key]
+	if !ok {
+		if len(window.groups) >= a.MaxGroups {
+			key = OVERFLOW_GROUP_VALUE
+			groupValues = make(map[string]interface{}, len(a.GroupBy))
+			for _, field := range a.GroupBy {
+				groupValues[field] = OVERFLOW_GROUP_VALUE
+			}
+		}
+
+		if group, ok = window.groups[key]; !ok {
+			group = &groupAggregate{
+				fields: groupValues,
+				stats:  make(map[string]*fieldAggregate, len(a.Fields)),
+			}
+
+			window.groups[key] = group
+		}
+	}
+
+	group.count++
+	for _, field := range a.Fields {
+		value, ok := clogger.GetPath(msg.ParsedFields, field)
+		if !ok {
+			continue
+		}
+
+		number, err := coerceFloat(value)
+		if err != nil {
+			continue
+		}
+
+		stats, ok := group.stats[field]
+		if !ok {
+			stats = &fieldAggregate{}
+			group.stats[field] = stats
+		}
+
+		stats.add(number.(float64), a.MaxSamples, len(a.Percentiles) > 0)
+	}
+}
+
+// summarise builds the summary message of one group in a window
+func (a *AggregateFilter) summarise(window *aggregateWindow, group *groupAggregate, now time.Time) clogger.Message {
+	end := window.start.Add(a.Window)
+
+	summary := clogger.NewMessage()
+	summary.EventTime = window.start
+	summary.IngestTime = now
+	for field, value := range group.fields {
+		setPath(summary.ParsedFields, field, value)
+	}
+
+	summary.ParsedFields[clogger.MESSAGE_FIELD] = fmt.Sprintf("aggregated %d messages", group.count)
+	summary.ParsedFields[AGGREGATE_COUNT_FIELD] = group.count
+	summary.ParsedFields[AGGREGATE_WINDOW_START_FIELD] = window.start.UTC().Format(time.RFC3339Nano)
+	summary.ParsedFields[AGGREGATE_WINDOW_END_FIELD] = end.UTC().Format(time.RFC3339Nano)
+
+	for field, stats := range group.stats {
+		values := make(map[string]interface{}, len(a.Stats)+len(a.Percentiles))
+		for _, stat := range a.Stats {
+			switch stat {
+			case "sum":
+				values[stat] = stats.sum
+			case "min":
+				values[stat] = stats.min
+			case "max":
+				values[stat] = stats.max
+			case "avg":
+				values[stat] = stats.sum / float64(stats.count)
+			}
+		}
+
+		if len(a.Percentiles) > 0 {
+			sort.Float64s(stats.samples)
+			for _, p := range a.Percentiles {
+				values[fmt.Sprintf("p%d", p)] = percentile(stats.samples, p)
+			}
+		}
+
+		setPath(summary.ParsedFields, field, values)
+	}
+
+	return summary
+}
+
+// Flush closes all the windows that have ended (or all of them, if final), returning a summary per group in each of them
+func (a *AggregateFilter) Flush(ctx context.Context, now time.Time, final bool) []clogger.Message {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// Without any messages the watermark would never move, so once the input has been quiet for a window
+	// length it falls back to processing time
+	if a.TimeMode == AGGREGATE_EVENT_TIME && now.Sub(a.lastMessage) >= a.Window {
+		a.advanceWatermark(now, now)
+	}
+
+	closed := []*aggregateWindow{}
+	for start, window := range a.windows {
+		if final || a.closed(window.start, now) {
+			closed = append(closed, window)
+			delete(a.windows, start)
+		}
+	}
+
+	sort.Slice(closed, func(i, j int) bool {
+		return closed[i].start.Before(closed[j].start)
+	})
+
+	summaries := []clogger.Message{}
+	for _, window := range closed {
+		keys := make([]string, 0, len(window.groups))
+		for key := range window.groups {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+		for _, key := range keys {
+			summaries = append(summaries, a.summarise(window, window.groups[key], now))
+		}
+	}
+
+	return summaries
+}
+
+func init() {
+	filtersRegistry.Register("aggregate", func(rawConf map[string]string) (interface{}, error) {
+		return NewAggregateFilterConfigFromRaw(rawConf)
+	}, func(rawConf interface{}) (Filter, error) {
+		if conf, ok := rawConf.(AggregateFilterConfig); ok {
+			return NewAggregateFilter(conf), nil
+		} else {
+			return nil, fmt.Errorf("BUG: invalid type for Aggregate filter configuration (expected AggregateFilterConfig)")
+		}
+	})
+}
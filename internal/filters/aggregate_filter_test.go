@@ -0,0 +1,259 @@
+package filters_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/filters"
+	"github.com/sinkingpoint/clogger/internal/metrics"
+)
+
+func accessLog(ts time.Time, endpoint string, latency interface{}) *clogger.Message {
+	msg := clogger.NewMessage()
+	msg.EventTime = ts
+	msg.ParsedFields["http"] = map[string]interface{}{"path": endpoint}
+	msg.ParsedFields["latency"] = latency
+	return &msg
+}
+
+func TestAggregateFilterProcessingTime(t *testing.T) {
+	filter, err := filters.Construct("aggregate", map[string]string{
+		"group_by": "http.path",
+		"fields":   "latency",
+		"stats":    "sum,min,max,avg,p50,p100",
+		"window":   "1m",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emitter := filter.(filters.EmittingFilter)
+	for i, latency := range []interface{}{10, 20.0, "30", 40, "fast"} {
+		endpoint := "/users"
+		if i == 4 {
+			endpoint = "/health"
+		}
+
+		if shouldDrop, _ := filter.Filter(context.Background(), accessLog(time.Now(), endpoint, latency)); !shouldDrop {
+			t.Fatal("expected aggregated messages to be dropped")
+		}
+	}
+
+	if summaries := emitter.Flush(context.Background(), time.Now(), false); len(summaries) != 0 {
+		t.Fatalf("expected no summaries before the window ends, got %v", summaries)
+	}
+
+	summaries := emitter.Flush(context.Background(), time.Now().Add(time.Minute), false)
+	if len(summaries) != 2 {
+		t.Fatalf("expected a summary per group, got %v", summaries)
+	}
+
+	// Groups are sorted by key, so /health comes first
+	health, users := summaries[0].ParsedFields, summaries[1].ParsedFields
+	if health[filters.AGGREGATE_COUNT_FIELD] != 1 || health["http"].(map[string]interface{})["path"] != "/health" {
+		t.Fatalf("got unexpected summary for /health: %v", health)
+	}
+
+	if _, ok := health["latency"]; ok {
+		t.Fatalf("expected non-numeric values to be ignored, got %v", health)
+	}
+
+	expected := map[string]interface{}{
+		"sum":  100.0,
+		"min":  10.0,
+		"max":  40.0,
+		"avg":  25.0,
+		"p50":  20.0,
+		"p100": 40.0,
+	}
+
+	if users[filters.AGGREGATE_COUNT_FIELD] != 4 || !reflect.DeepEqual(users["latency"], expected) {
+		t.Fatalf("got unexpected summary for /users: %v", users)
+	}
+
+	if !summaries[1].EventTime.Equal(summaries[1].EventTime.Truncate(time.Minute)) {
+		t.Fatalf("expected the summary to have the start of the window as its event time, got %s", summaries[1].EventTime)
+	}
+}
+
+func TestAggregateFilterEventTime(t *testing.T) {
+	filter, err := filters.Construct("aggregate", map[string]string{
+		"window":           "10s",
+		"slide":            "5s",
+		"time":             "event",
+		"allowed_lateness": "5s",
+		"late":             "pass",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emitter := filter.(filters.EmittingFilter)
+	base := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Falls in the windows starting at -5s and 0s
+	filter.Filter(context.Background(), accessLog(base.Add(time.Second), "/", 1))
+
+	// Moves the watermark to 9s, closing the window starting at -5s but not the one at 0s
+	filter.Filter(context.Background(), accessLog(base.Add(14*time.Second), "/", 1))
+
+	// Late for the window at -5s, but still counts towards the one at 0s
+	if shouldDrop, _ := filter.Filter(context.Background(), accessLog(base.Add(2*time.Second), "/", 1)); !shouldDrop {
+		t.Fatal("expected a message with an open window to be aggregated")
+	}
+
+	// Only belongs to closed windows, so it's passed through
+	if shouldDrop, _ := filter.Filter(context.Background(), accessLog(base.Add(-time.Second), "/", 1)); shouldDrop {
+		t.Fatal("expected a late message to be passed through")
+	}
+
+	counts := map[string]interface{}{}
+	for _, summary := range emitter.Flush(context.Background(), time.Now(), false) {
+		counts[summary.ParsedFields[filters.AGGREGATE_WINDOW_START_FIELD].(string)] = summary.ParsedFields[filters.AGGREGATE_COUNT_FIELD]
+	}
+
+	if !reflect.DeepEqual(counts, map[string]interface{}{"2021-06-01T11:59:55Z": 1}) {
+		t.Fatalf("expected only the closed window to be flushed, got %v", counts)
+	}
+
+	counts = map[string]interface{}{}
+	for _, summary := range emitter.Flush(context.Background(), time.Now(), true) {
+		counts[summary.ParsedFields[filters.AGGREGATE_WINDOW_START_FIELD].(string)] = summary.ParsedFields[filters.AGGREGATE_COUNT_FIELD]
+	}
+
+	expected := map[string]interface{}{
+		"2021-06-01T12:00:00Z": 2,
+		"2021-06-01T12:00:05Z": 1,
+		"2021-06-01T12:00:10Z": 1,
+	}
+
+	if !reflect.DeepEqual(counts, expected) {
+		t.Fatalf("expected the final flush to close the rest of the windows, got %v", counts)
+	}
+}
+
+func TestAggregateFilterFutureEventTime(t *testing.T) {
+	filter, err := filters.Construct("aggregate", map[string]string{
+		"window":           "1m",
+		"time":             "event",
+		"allowed_lateness": "10s",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := filters.ContextWithStepName(context.Background(), "test_future_aggregate")
+	now := time.Now()
+
+	// A clock skewed message from an hour in the future can't move the watermark past now
+	filter.Filter(ctx, accessLog(now.Add(time.Hour), "/", 1))
+
+	if shouldDrop, _ := filter.Filter(ctx, accessLog(now, "/", 1)); !shouldDrop {
+		t.Fatal("expected a current message to be aggregated")
+	}
+
+	if dropped := testutil.ToFloat64(metrics.AggregateLateDropped.WithLabelValues("test_future_aggregate")); dropped != 0 {
+		t.Fatalf("expected no late drops, got %v", dropped)
+	}
+
+	// Messages from windows that have really closed are still dropped, and counted
+	filter.Filter(ctx, accessLog(now.Add(-time.Hour), "/", 1))
+	if dropped := testutil.ToFloat64(metrics.AggregateLateDropped.WithLabelValues("test_future_aggregate")); dropped != 1 {
+		t.Fatalf("expected the late message to be counted, got %v", dropped)
+	}
+
+	total := 0
+	for _, summary := range filter.(filters.EmittingFilter).Flush(ctx, now, true) {
+		total += summary.ParsedFields[filters.AGGREGATE_COUNT_FIELD].(int)
+	}
+
+	if total != 2 {
+		t.Fatalf("expected the current and future messages to be aggregated, got %d", total)
+	}
+}
+
+func TestAggregateFilterEventTimeIdle(t *testing.T) {
+	filter, err := filters.Construct("aggregate", map[string]string{
+		"window":           "1m",
+		"time":             "event",
+		"allowed_lateness": "10s",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emitter := filter.(filters.EmittingFilter)
+	now := time.Now()
+	filter.Filter(context.Background(), accessLog(now, "/", 1))
+
+	if summaries := emitter.Flush(context.Background(), now, false); len(summaries) != 0 {
+		t.Fatalf("expected the window to stay open while it's current, got %v", summaries)
+	}
+
+	// No more messages arrive, but the window still closes once it's ended in processing time
+	later := now.Add(2 * time.Minute)
+	summaries := emitter.Flush(context.Background(), later, false)
+	if len(summaries) != 1 || summaries[0].ParsedFields[filters.AGGREGATE_COUNT_FIELD] != 1 {
+		t.Fatalf("expected the window to be flushed after the input went quiet, got %v", summaries)
+	}
+
+	if !summaries[0].IngestTime.Equal(later) {
+		t.Fatalf("expected the summary to be ingested at the flush time, got %v", summaries[0].IngestTime)
+	}
+}
+
+func TestAggregateFilterMaxGroups(t *testing.T) {
+	filter, err := filters.Construct("aggregate", map[string]string{"group_by": "http.path", "max_groups": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, endpoint := range []string{"/a", "/b", "/c", "/a"} {
+		filter.Filter(context.Background(), accessLog(time.Now(), endpoint, 1))
+	}
+
+	counts := map[interface{}]interface{}{}
+	for _, summary := range filter.(filters.EmittingFilter).Flush(context.Background(), time.Now(), true) {
+		counts[summary.ParsedFields["http"].(map[string]interface{})["path"]] = summary.ParsedFields[filters.AGGREGATE_COUNT_FIELD]
+	}
+
+	if !reflect.DeepEqual(counts, map[interface{}]interface{}{"/a": 2, filters.OVERFLOW_GROUP_VALUE: 2}) {
+		t.Fatalf("expected groups past the max to be aggregated together, got %v", counts)
+	}
+}
+
+func TestAggregateFilterConfig(t *testing.T) {
+	invalid := []map[string]string{
+		{"stats": "median"},
+		{"stats": "p101"},
+		{"window": "0s"},
+		{"window": "1m", "slide": "7s"},
+		{"window": "1m", "slide": "2m"},
+		{"time": "wall"},
+		{"late": "keep"},
+		{"max_groups": "0"},
+		{"fields": "count"},
+		{"fields": "message"},
+		{"fields": "window_start"},
+		{"fields": "latency", "group_by": "latency"},
+		{"fields": "http", "group_by": "http.path"},
+		{"fields": "http.path.length", "group_by": "http.path"},
+		{"group_by": "message"},
+		{"group_by": "http.path,count"},
+		{"group_by": "window_end.day"},
+	}
+
+	for _, conf := range invalid {
+		if _, err := filters.Construct("aggregate", conf); err == nil {
+			t.Errorf("Expected an error constructing an aggregate filter with %v", conf)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package filters
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+const DEFAULT_DEDUP_WINDOW = time.Minute
+const DEFAULT_DEDUP_MAX_ENTRIES = 10000
+const DEFAULT_REPEAT_COUNT_FIELD = "repeat_count"
+
+type DedupFilterConfig struct {
+	// Fields are the fields that have to match for messages to be duplicates of each other
+	Fields []string
+
+	// Window is how long after the first of a set of duplicates that further duplicates are suppressed for
+	Window time.Duration
+
+	// MaxEntries caps the number of distinct messages tracked at once. When it's reached, the oldest windows get closed early
+	MaxEntries int
+
+	// Summary emits a "last message repeated N times" message when a window that suppressed messages closes
+	Summary bool
+
+	// CountField is the field of summary messages that holds the number of suppressed messages
+	CountField string
+}
+
+func NewDedupFilterConfigFromRaw(raw map[string]string) (DedupFilterConfig, error) {
+	conf := DedupFilterConfig{
+		Fields:     []string{clogger.MESSAGE_FIELD},
+		Window:     DEFAULT_DEDUP_WINDOW,
+		MaxEntries: DEFAULT_DEDUP_MAX_ENTRIES,
+		CountField: DEFAULT_REPEAT_COUNT_FIELD,
+	}
+
+	if s, ok := raw["fields"]; ok {
+		conf.Fields = splitList(s)
+		if len(conf.Fields) == 0 {
+			return DedupFilterConfig{}, fmt.Errorf("invalid `fields` in DedupFilter - expected at least one field")
+		}
+	}
+
+	if s, ok := raw["window"]; ok {
+		window, err := time.ParseDuration(s)
+		if err != nil || window <= 0 {
+			return DedupFilterConfig{}, fmt.Errorf("invalid `window` in DedupFilter - expected a positive duration, got `%s`", s)
+		}
+
+		conf.Window = window
+	}
+
+	if s, ok := raw["max_entries"]; ok {
+		maxEntries, err := strconv.Atoi(s)
+		if err != nil || maxEntries <= 0 {
+			return DedupFilterConfig{}, fmt.Errorf("invalid `max_entries` in DedupFilter - expected a positive int, got `%s`", s)
+		}
+
+		conf.MaxEntries = maxEntries
+	}
+
+	if s, ok := raw["summary"]; ok {
+		var err error
+		conf.Summary, err = strconv.ParseBool(s)
+		if err != nil {
+			return DedupFilterConfig{}, fmt.Errorf("invalid `summary` in DedupFilter - expected true or false, got `%s`", s)
+		}
+	}
+
+	if field, ok := raw["count_field"]; ok {
+		conf.CountField = field
+	}
+
+	return conf, nil
+}
+
+// dedupEntry tracks the first of a set of duplicate messages
+type dedupEntry struct {
+	hash       uint64
+	firstSeen  time.Time
+	suppressed int
+
+	// The key fields, message and metadata of the first message, to build the summary out of
+	fields   map[string]interface{}
+	message  interface{}
+	metadata map[string]string
+}
+
+// DedupFilter is an EmittingFilter that drops messages that duplicate one seen recently
+type DedupFilter struct {
+	DedupFilterConfig
+
+	lock sync.Mutex
+
+	// entries are the open windows, oldest first, so we can close them in order.
+	// index maps the hashes of the key fields to the entries in the list
+	entries *list.List
+	index   map[uint64]*list.Element
+
+	// pending are summaries from windows that have closed since the last flush
+	pending []clogger.Message
+}
+
+func NewDedupFilter(conf DedupFilterConfig) *DedupFilter {
+	return &DedupFilter{
+		DedupFilterConfig: conf,
+		entries:           list.New(),
+		index:             make(map[uint64]*list.Element),
+	}
+}
+
+// keyHash hashes the values of the key fields of the given message.
+// We only keep the hash so that long messages don't take up memory for the length of the window
+func (d *DedupFilter) keyHash(msg *clogger.Message) uint64 {
+	hash := fnv.New64a()
+	for _, field := range d.Fields {
+		if value, ok := clogger.GetPath(msg.ParsedFields, field); ok {
+			hash.Write([]byte(stringify(value)))
+		} else {
+			// Distinguish between missing fields and empty ones
+			hash.Write([]byte{1})
+		}
+
+		hash.Write([]byte{0})
+	}
+
+	return hash.Sum64()
+}
+
+// closeEntry removes the given entry, queuing a summary of it if it suppressed anything
+func (d *DedupFilter) closeEntry(element *list.Element, now time.Time) {
+	entry := d.entries.Remove(element).(*dedupEntry)
+	delete(d.index, entry.hash)
+
+	if !d.Summary || entry.suppressed == 0 {
+		return
+	}
+
+	summary := clogger.NewMessage()
+	summary.EventTime = now
+	summary.IngestTime = now
+	for field, value := range entry.fields {
+		setPath(summary.ParsedFields, field, value)
+	}
+
+	text := fmt.Sprintf("last message repeated %d times", entry.suppressed)
+	if entry.message != nil {
+		text = fmt.Sprintf("%s: %s", text, stringify(entry.message))
+	}
+
+	summary.ParsedFields[clogger.MESSAGE_FIELD] = text
+	setPath(summary.ParsedFields, d.CountField, entry.suppressed)
+	for key, value := range entry.metadata {
+		summary.SetMetadata(key, value)
+	}
+
+	d.pending = append(d.pending, summary)
+}
+
+func (d *DedupFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldDrop bool, err error) {
+	now := time.Now()
+	hash := d.keyHash(msg)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if element, ok := d.index[hash]; ok {
+		entry := element.Value.(*dedupEntry)
+		if now.Sub(entry.firstSeen) < d.Window {
+			entry.suppressed++
+			return true, nil
+		}
+
+		// The window has closed, but hasn't been flushed yet. This message starts a new one
+		d.closeEntry(element, now)
+	}
+
+	entry := &dedupEntry{
+		hash:      hash,
+		firstSeen: now,
+	}
+
+	if d.Summary {
+		entry.fields = make(map[string]interface{}, len(d.Fields))
+		for _, field := range d.Fields {
+			if value, ok := clogger.GetPath(msg.ParsedFields, field); ok {
+				entry.fields[field] = value
+			}
+		}
+
+		entry.message = msg.ParsedFields[clogger.MESSAGE_FIELD]
+
+		// Copy the metadata, because it's shared with the message that we pass on
+		entry.metadata = make(map[string]string, len(msg.Metadata))
+		for key, value := range msg.Metadata {
+			entry.metadata[key] = value
+		}
+	}
+
+	d.index[hash] = d.entries.PushBack(entry)
+	for d.entries.Len() > d.MaxEntries {
+		d.closeEntry(d.entries.Front(), now)
+	}
+
+	return false, nil
+}
+
+// Flush closes all the windows that have expired by the given time (or all of them, if final),
+// returning summaries of the ones that suppressed messages
+func (d *DedupFilter) Flush(ctx context.Context, now time.Time, final bool) []clogger.Message {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for element := d.entries.Front(); element != nil; element = d.entries.Front() {
+		if !final && now.Sub(element.Value.(*dedupEntry).firstSeen) < d.Window {
+			break
+		}
+
+		d.closeEntry(element, now)
+	}
+
+	pending := d.pending
+	d.pending = nil
+	return pending
+}
+
+func init() {
+	filtersRegistry.Register("dedup", func(rawConf map[string]string) (interface{}, error) {
+		return NewDedupFilterConfigFromRaw(rawConf)
+	}, func(rawConf interface{}) (Filter, error) {
+		if conf, ok := rawConf.(DedupFilterConfig); ok {
+			return NewDedupFilter(conf), nil
+		} else {
+			return nil, fmt.Errorf("BUG: invalid type for Dedup filter configuration (expected DedupFilterConfig)")
+		}
+	})
+}
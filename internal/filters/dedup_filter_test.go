@@ -0,0 +1,141 @@
+package filters_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/filters"
+)
+
+func dedupMessage(message string, host string) clogger.Message {
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = message
+	msg.ParsedFields["host"] = host
+	msg.SetMetadata(clogger.METADATA_INPUT, "journal")
+	return msg
+}
+
+func TestDedupFilter(t *testing.T) {
+	filter, err := filters.Construct("dedup", map[string]string{
+		"fields":  "message,host",
+		"window":  "1m",
+		"summary": "true",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emitter, ok := filter.(filters.EmittingFilter)
+	if !ok {
+		t.Fatal("expected the dedup filter to be an EmittingFilter")
+	}
+
+	messages := []clogger.Message{
+		dedupMessage("crashed", "web1"),
+		dedupMessage("crashed", "web1"),
+		dedupMessage("crashed", "web2"),
+		dedupMessage("crashed", "web1"),
+		dedupMessage("started", "web1"),
+	}
+
+	expectedDrops := []bool{false, true, false, true, false}
+	for i := range messages {
+		shouldDrop, err := filter.Filter(context.Background(), &messages[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if shouldDrop != expectedDrops[i] {
+			t.Fatalf("expected message %d to have dropped=%v", i, expectedDrops[i])
+		}
+	}
+
+	if summaries := emitter.Flush(context.Background(), time.Now(), false); len(summaries) != 0 {
+		t.Fatalf("expected no summaries before the window closes, got %v", summaries)
+	}
+
+	summaries := emitter.Flush(context.Background(), time.Now().Add(time.Minute), false)
+	if len(summaries) != 1 {
+		t.Fatalf("expected one summary once the window closes, got %v", summaries)
+	}
+
+	summary := summaries[0]
+	if summary.ParsedFields[clogger.MESSAGE_FIELD] != "last message repeated 2 times: crashed" ||
+		summary.ParsedFields["host"] != "web1" ||
+		summary.ParsedFields[filters.DEFAULT_REPEAT_COUNT_FIELD] != 2 {
+		t.Fatalf("got unexpected summary: %v", summary.ParsedFields)
+	}
+
+	if input, _ := summary.GetMetadata(clogger.METADATA_INPUT); input != "journal" {
+		t.Fatalf("expected the summary to keep the metadata of the original message, got %v", summary.Metadata)
+	}
+
+	// Once the window has closed, the next duplicate gets through
+	msg := dedupMessage("crashed", "web1")
+	if shouldDrop, _ := filter.Filter(context.Background(), &msg); shouldDrop {
+		t.Fatal("expected a message to be let through after the window is flushed")
+	}
+}
+
+func TestDedupFilterFinalFlushAndEviction(t *testing.T) {
+	filter, err := filters.Construct("dedup", map[string]string{"max_entries": "2", "summary": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emitter := filter.(filters.EmittingFilter)
+	for _, text := range []string{"a", "a", "b", "c", "a", "c"} {
+		msg := dedupMessage(text, "web1")
+		if _, err := filter.Filter(context.Background(), &msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// `a` gets evicted by `c`, so the second `a` opens a new window, evicting `b`
+	summaries := emitter.Flush(context.Background(), time.Now(), false)
+	if len(summaries) != 1 || summaries[0].ParsedFields[filters.DEFAULT_REPEAT_COUNT_FIELD] != 1 {
+		t.Fatalf("expected a summary of the evicted window, got %v", summaries)
+	}
+
+	summaries = emitter.Flush(context.Background(), time.Now(), true)
+	if len(summaries) != 1 || summaries[0].ParsedFields[clogger.MESSAGE_FIELD] != "last message repeated 1 times: c" {
+		t.Fatalf("expected the final flush to close the remaining windows, got %v", summaries)
+	}
+}
+
+func TestDedupFilterWithoutSummary(t *testing.T) {
+	filter, err := filters.Construct("dedup", map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		msg := dedupMessage("a", "web1")
+		if shouldDrop, _ := filter.Filter(context.Background(), &msg); shouldDrop != (i > 0) {
+			t.Fatalf("unexpected result for message %d", i)
+		}
+	}
+
+	if summaries := filter.(filters.EmittingFilter).Flush(context.Background(), time.Now(), true); len(summaries) != 0 {
+		t.Fatalf("expected no summaries, got %v", summaries)
+	}
+}
+
+func TestDedupFilterConfig(t *testing.T) {
+	invalid := []map[string]string{
+		{"fields": ""},
+		{"window": "0s"},
+		{"window": "soon"},
+		{"max_entries": "0"},
+		{"summary": "maybe"},
+	}
+
+	for _, conf := range invalid {
+		if _, err := filters.Construct("dedup", conf); err == nil {
+			t.Errorf("Expected an error constructing a dedup filter with %v", conf)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package filters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+// fieldTemplate is a value that can reference other fields with `${field}`
+type fieldTemplate struct {
+	// literals and fields alternate, with the literals always being one longer than the fields
+	literals []string
+	fields   []string
+}
+
+func parseFieldTemplate(s string) (fieldTemplate, error) {
+	template := fieldTemplate{}
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			template.literals = append(template.literals, s)
+			return template, nil
+		}
+
+		end := strings.IndexRune(s[start:], '}')
+		if end < 0 {
+			return fieldTemplate{}, fmt.Errorf("unterminated `${` in `%s`", s)
+		}
+
+		field := strings.TrimSpace(s[start+2 : start+end])
+		if field == "" {
+			return fieldTemplate{}, fmt.Errorf("empty field reference in `%s`", s)
+		}
+
+		template.literals = append(template.literals, s[:start])
+		template.fields = append(template.fields, field)
+		s = s[start+end+1:]
+	}
+}
+
+// Render renders the template against the given fields. A template that consists of a single reference
+// keeps the type of the referenced value, otherwise references are formatted into a string,
+// with missing fields rendering as empty strings
+func (f fieldTemplate) Render(fields map[string]interface{}) interface{} {
+	if len(f.fields) == 1 && f.literals[0] == "" && f.literals[1] == "" {
+		value, _ := clogger.GetPath(fields, f.fields[0])
+		return value
+	}
+
+	var builder strings.Builder
+	for i, literal := range f.literals {
+		builder.WriteString(literal)
+		if i < len(f.fields) {
+			if value, ok := clogger.GetPath(fields, f.fields[i]); ok && value != nil {
+				builder.WriteString(stringify(value))
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+// stringify formats a field value as a string, encoding maps and slices as JSON
+func stringify(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		if data, err := json.Marshal(v); err == nil {
+			return string(data)
+		}
+	}
+
+	return fmt.Sprint(value)
+}
+
+// FieldAssignment is a field, and the (possibly interpolated) value to assign to it
+type FieldAssignment struct {
+	Field string
+	Value fieldTemplate
+}
+
+// FieldPair is a pair of fields to move or copy a value between
+type FieldPair struct {
+	From string
+	To   string
+}
+
+// FieldCoercion is a field, and the type to convert its value to
+type FieldCoercion struct {
+	Field string
+	Type  string
+}
+
+// coercions maps the names of types that fields can be coerced into to the functions that do the conversion
+var coercions = map[string]func(value interface{}) (interface{}, error){
+	"int":    coerceInt,
+	"float":  coerceFloat,
+	"string": func(value interface{}) (interface{}, error) { return stringify(value), nil },
+	"bool":   coerceBool,
+}
+
+func coerceInt(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("can't convert `%v` to an int", value)
+		}
+
+		return int64(v), nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+
+		return int64(0), nil
+	case string:
+		s := strings.TrimSpace(v)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i, nil
+		}
+
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return int64(f), nil
+		}
+	}
+
+	return nil, fmt.Errorf("can't convert `%v` to an int", value)
+}
+
+func coerceFloat(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return float64(1), nil
+		}
+
+		return float64(0), nil
+	case string:
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, nil
+		}
+	}
+
+	return nil, fmt.Errorf("can't convert `%v` to a float", value)
+}
+
+func coerceBool(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case int:
+		return v != 0, nil
+	case int64:
+		return v != 0, nil
+	case uint64:
+		return v != 0, nil
+	case float64:
+		return v != 0, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "t", "yes", "y", "on", "1":
+			return true, nil
+		case "false", "f", "no", "n", "off", "0", "":
+			return false, nil
+		}
+	}
+
+	return nil, fmt.Errorf("can't convert `%v` to a bool", value)
+}
+
+// splitList splits a comma separated list, trimming whitespace and ignoring empty items
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// splitPairs splits a comma separated list of `key<sep>value` pairs
+func splitPairs(s string, sep string, key string) ([][2]string, error) {
+	pairs := [][2]string{}
+	for _, item := range splitList(s) {
+		parts := strings.SplitN(item, sep, 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid `%s` in FieldsFilter - expected `field%svalue` pairs, got `%s`", key, sep, item)
+		}
+
+		pairs = append(pairs, [2]string{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+
+	return pairs, nil
+}
+
+type FieldsFilterConfig struct {
+	// Rename moves values from one field to another
+	Rename []FieldPair
+
+	// Copy copies values from one field to another
+	Copy []FieldPair
+
+	// Add sets fields that don't already exist
+	Add []FieldAssignment
+
+	// Set sets fields, overwriting any existing value
+	Set []FieldAssignment
+
+	// Coerce converts field values to the given types
+	Coerce []FieldCoercion
+
+	// Remove removes fields
+	Remove []string
+}
+
+func parseAssignments(raw map[string]string, key string) ([]FieldAssignment, error) {
+	pairs, err := splitPairs(raw[key], "=", key)
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := make([]FieldAssignment, 0, len(pairs))
+	for _, pair := range pairs {
+		template, err := parseFieldTemplate(pair[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid `%s` in FieldsFilter: %w", key, err)
+		}
+
+		assignments = append(assignments, FieldAssignment{Field: pair[0], Value: template})
+	}
+
+	return assignments, nil
+}
+
+func parseFieldPairs(raw map[string]string, key string) ([]FieldPair, error) {
+	pairs, err := splitPairs(raw[key], ":", key)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldPairs := make([]FieldPair, 0, len(pairs))
+	for _, pair := range pairs {
+		if pair[1] == "" {
+			return nil, fmt.Errorf("invalid `%s` in FieldsFilter - missing destination for `%s`", key, pair[0])
+		}
+
+		fieldPairs = append(fieldPairs, FieldPair{From: pair[0], To: pair[1]})
+	}
+
+	return fieldPairs, nil
+}
+
+func NewFieldsFilterConfigFromRaw(raw map[string]string) (FieldsFilterConfig, error) {
+	conf := FieldsFilterConfig{}
+
+	var err error
+	if conf.Rename, err = parseFieldPairs(raw, "rename"); err != nil {
+		return FieldsFilterConfig{}, err
+	}
+
+	if conf.Copy, err = parseFieldPairs(raw, "copy"); err != nil {
+		return FieldsFilterConfig{}, err
+	}
+
+	if conf.Add, err = parseAssignments(raw, "add"); err != nil {
+		return FieldsFilterConfig{}, err
+	}
+
+	if conf.Set, err = parseAssignments(raw, "set"); err != nil {
+		return FieldsFilterConfig{}, err
+	}
+
+	coercePairs, err := splitPairs(raw["coerce"], ":", "coerce")
+	if err != nil {
+		return FieldsFilterConfig{}, err
+	}
+
+	for _, pair := range coercePairs {
+		typ := strings.ToLower(pair[1])
+		if _, ok := coercions[typ]; !ok {
+			return FieldsFilterConfig{}, fmt.Errorf("invalid `coerce` in FieldsFilter - expected one of int, float, string or bool, got `%s`", pair[1])
+		}
+
+		conf.Coerce = append(conf.Coerce, FieldCoercion{Field: pair[0], Type: typ})
+	}
+
+	conf.Remove = splitList(raw["remove"])
+
+	if len(conf.Rename)+len(conf.Copy)+len(conf.Add)+len(conf.Set)+len(conf.Coerce)+len(conf.Remove) == 0 {
+		return FieldsFilterConfig{}, fmt.Errorf("FieldsFilter requires at least one of `rename`, `copy`, `add`, `set`, `coerce` or `remove`")
+	}
+
+	return conf, nil
+}
+
+// FieldsFilter is a Filter that manipulates the fields of messages without needing a script.
+// Operations are applied in a fixed order: rename, copy, add, set, coerce and then remove,
+// so e.g. a renamed field can be coerced, and a field can be copied before it's removed
+type FieldsFilter struct {
+	FieldsFilterConfig
+}
+
+func NewFieldsFilter(conf FieldsFilterConfig) *FieldsFilter {
+	return &FieldsFilter{
+		FieldsFilterConfig: conf,
+	}
+}
+
+func (f *FieldsFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldDrop bool, err error) {
+	fields := newFieldsWriter(msg.ParsedFields)
+	defer func() {
+		msg.ParsedFields = fields.Fields()
+	}()
+
+	for _, pair := range f.Rename {
+		if value, ok := fields.Delete(pair.From); ok {
+			fields.Set(pair.To, value)
+		}
+	}
+
+	for _, pair := range f.Copy {
+		if value, ok := clogger.GetPath(fields.Fields(), pair.From); ok {
+			fields.Set(pair.To, value)
+		}
+	}
+
+	for _, assignment := range f.Add {
+		if _, ok := clogger.GetPath(fields.Fields(), assignment.Field); !ok {
+			fields.Set(assignment.Field, assignment.Value.Render(fields.Fields()))
+		}
+	}
+
+	for _, assignment := range f.Set {
+		fields.Set(assignment.Field, assignment.Value.Render(fields.Fields()))
+	}
+
+	// Carry on past coercion failures so that one bad field doesn't stop the rest of the operations,
+	// but report the first one
+	for _, coercion := range f.Coerce {
+		value, ok := clogger.GetPath(fields.Fields(), coercion.Field)
+		if !ok || value == nil {
+			continue
+		}
+
+		coerced, coerceErr := coercions[coercion.Type](value)
+		if coerceErr != nil {
+			if err == nil {
+				err = fmt.Errorf("failed to coerce field `%s`: %w", coercion.Field, coerceErr)
+			}
+
+			continue
+		}
+
+		fields.Set(coercion.Field, coerced)
+	}
+
+	for _, field := range f.Remove {
+		fields.Delete(field)
+	}
+
+	return false, err
+}
+
+func init() {
+	filtersRegistry.Register("fields", func(rawConf map[string]string) (interface{}, error) {
+		return NewFieldsFilterConfigFromRaw(rawConf)
+	}, func(rawConf interface{}) (Filter, error) {
+		if conf, ok := rawConf.(FieldsFilterConfig); ok {
+			return NewFieldsFilter(conf), nil
+		} else {
+			return nil, fmt.Errorf("BUG: invalid type for Fields filter configuration (expected FieldsFilterConfig)")
+		}
+	})
+}
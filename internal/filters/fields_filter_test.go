@@ -0,0 +1,212 @@
+package filters_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/filters"
+)
+
+func TestFieldsFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     map[string]string
+		fields   map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name: "set, rename, remove and coerce",
+			conf: map[string]string{
+				"set":    "env=prod",
+				"rename": "msg:message",
+				"remove": "password, token",
+				"coerce": "status:int",
+			},
+			fields: map[string]interface{}{
+				"msg":      "hello",
+				"password": "hunter2",
+				"token":    "abc",
+				"status":   "200",
+				"env":      "dev",
+			},
+			expected: map[string]interface{}{
+				"message": "hello",
+				"status":  int64(200),
+				"env":     "prod",
+			},
+		},
+		{
+			name: "add doesn't overwrite",
+			conf: map[string]string{"add": "env=prod,region=us"},
+			fields: map[string]interface{}{
+				"env": "dev",
+			},
+			expected: map[string]interface{}{
+				"env":    "dev",
+				"region": "us",
+			},
+		},
+		{
+			name: "nested paths",
+			conf: map[string]string{
+				"rename": "http.status:status",
+				"copy":   "host:source.host",
+				"remove": "http.request.body",
+				"coerce": "status:float",
+			},
+			fields: map[string]interface{}{
+				"host": "web1",
+				"http": map[string]interface{}{
+					"status": 200,
+					"request": map[string]interface{}{
+						"method": "GET",
+						"body":   "secret",
+					},
+				},
+			},
+			expected: map[string]interface{}{
+				"host":   "web1",
+				"status": float64(200),
+				"source": map[string]interface{}{
+					"host": "web1",
+				},
+				"http": map[string]interface{}{
+					"request": map[string]interface{}{
+						"method": "GET",
+					},
+				},
+			},
+		},
+		{
+			name: "interpolation",
+			conf: map[string]string{
+				"set": "id=${host}-${pid}-${missing},user_copy=${user},method=${http.method}",
+			},
+			fields: map[string]interface{}{
+				"host": "web1",
+				"pid":  42,
+				"user": map[string]interface{}{"name": "bob"},
+				"http": map[string]interface{}{"method": "GET"},
+			},
+			expected: map[string]interface{}{
+				"host":      "web1",
+				"pid":       42,
+				"user":      map[string]interface{}{"name": "bob"},
+				"http":      map[string]interface{}{"method": "GET"},
+				"id":        "web1-42-",
+				"user_copy": map[string]interface{}{"name": "bob"},
+				"method":    "GET",
+			},
+		},
+		{
+			name: "coerce bool and string",
+			conf: map[string]string{"coerce": "ok:bool,code:string"},
+			fields: map[string]interface{}{
+				"ok":   "yes",
+				"code": 404,
+			},
+			expected: map[string]interface{}{
+				"ok":   true,
+				"code": "404",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := filters.Construct("fields", test.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := clogger.NewMessage()
+			msg.ParsedFields = test.fields
+
+			if shouldDrop, err := filter.Filter(context.Background(), &msg); err != nil || shouldDrop {
+				t.Fatalf("Filter failed: dropped=%v, err=%v", shouldDrop, err)
+			}
+
+			if !reflect.DeepEqual(msg.ParsedFields, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, msg.ParsedFields)
+			}
+		})
+	}
+}
+
+func TestFieldsFilterCoerceFailure(t *testing.T) {
+	filter, err := filters.Construct("fields", map[string]string{"coerce": "status:int,size:int", "remove": "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := clogger.NewMessage()
+	msg.ParsedFields["status"] = "ok"
+	msg.ParsedFields["size"] = "10"
+	msg.ParsedFields["secret"] = "hunter2"
+
+	shouldDrop, err := filter.Filter(context.Background(), &msg)
+	if err == nil || shouldDrop {
+		t.Fatalf("Expected a failed coercion to be reported, got dropped=%v, err=%v", shouldDrop, err)
+	}
+
+	// The failing field is left alone, and the rest of the operations still happen
+	expected := map[string]interface{}{"status": "ok", "size": int64(10)}
+	if !reflect.DeepEqual(msg.ParsedFields, expected) {
+		t.Fatalf("expected %v, got %v", expected, msg.ParsedFields)
+	}
+}
+
+func TestFieldsFilterDoesntModifyOriginal(t *testing.T) {
+	filter, err := filters.Construct("fields", map[string]string{
+		"rename": "http.status:status",
+		"set":    "http.method=GET,service=api",
+		"remove": "http.path",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := clogger.NewMessage()
+	original.ParsedFields["http"] = map[string]interface{}{"status": 200, "path": "/"}
+	before := clogger.NewMessage()
+	before.ParsedFields["http"] = map[string]interface{}{"status": 200, "path": "/"}
+
+	// Messages in cloned batches share their fields
+	msg := original
+	if _, err := filter.Filter(context.Background(), &msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(original.ParsedFields, before.ParsedFields) {
+		t.Fatalf("changing fields modified the original message: %v", original.ParsedFields)
+	}
+
+	expected := map[string]interface{}{
+		"http":    map[string]interface{}{"method": "GET"},
+		"status":  200,
+		"service": "api",
+	}
+
+	if !reflect.DeepEqual(msg.ParsedFields, expected) {
+		t.Fatalf("expected %v, got %v", expected, msg.ParsedFields)
+	}
+}
+
+func TestFieldsFilterConfig(t *testing.T) {
+	invalid := []map[string]string{
+		{},
+		{"set": "env"},
+		{"rename": "a:"},
+		{"coerce": "a:uuid"},
+		{"set": "a=${b"},
+	}
+
+	for _, conf := range invalid {
+		if _, err := filters.Construct("fields", conf); err == nil {
+			t.Errorf("Expected an error constructing a fields filter with %v", conf)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package filters
 
 import (
 	"context"
+	"time"
 
 	"github.com/sinkingpoint/clogger/internal/clogger"
 )
@@ -9,3 +10,28 @@ import (
 type Filter interface {
 	Filter(ctx context.Context, msg *clogger.Message) (shouldDrop bool, err error)
 }
+
+// EmittingFilter is a Filter that can also generate messages of its own, e.g. summaries of the messages it dropped.
+// The pipeline calls Flush every FLUSH_INTERVAL, from the same goroutine as Filter, and once more with final set
+// when the filter's input closes, at which point the filter should return everything it's holding on to
+type EmittingFilter interface {
+	Filter
+	Flush(ctx context.Context, now time.Time, final bool) []clogger.Message
+}
+
+// FLUSH_INTERVAL is how often EmittingFilters are flushed
+const FLUSH_INTERVAL = time.Second
+
+type stepNameKey struct{}
+
+// ContextWithStepName returns a context that tells filters the name of the pipeline step that they're running as,
+// e.g. for labelling their metrics
+func ContextWithStepName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, stepNameKey{}, name)
+}
+
+// StepNameFromContext returns the name of the pipeline step that the filter is running as, or an empty string if it isn't known
+func StepNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(stepNameKey{}).(string)
+	return name
+}
@@ -0,0 +1,312 @@
+package filters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+const DEFAULT_PARSE_ERROR_FIELD = "parse_error"
+
+type ParseFormat string
+
+const (
+	PARSE_JSON   ParseFormat = "json"
+	PARSE_LOGFMT ParseFormat = "logfmt"
+	PARSE_KV     ParseFormat = "kv"
+)
+
+type ParseFailureMode string
+
+const (
+	// PARSE_FAILURE_REPORT returns an error from the filter, so the failure gets logged
+	PARSE_FAILURE_REPORT ParseFailureMode = "report"
+
+	// PARSE_FAILURE_IGNORE silently passes the message on untouched
+	PARSE_FAILURE_IGNORE ParseFailureMode = "ignore"
+
+	// PARSE_FAILURE_TAG records the failure in a field of the message
+	PARSE_FAILURE_TAG ParseFailureMode = "tag"
+)
+
+// parseKeyValues parses `key<valueSep>value` pairs separated by fieldSep. Values can be double quoted, with backslash escapes.
+// If bareKeys is set, keys without a value are set to true (as in logfmt), otherwise they're ignored
+func parseKeyValues(s string, fieldSep string, valueSep string, bareKeys bool) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	for {
+		// Skip any leading separators
+		for strings.HasPrefix(s, fieldSep) {
+			s = s[len(fieldSep):]
+		}
+
+		if s == "" {
+			return fields, nil
+		}
+
+		keyEnd := strings.Index(s, fieldSep)
+		if keyEnd < 0 {
+			keyEnd = len(s)
+		}
+
+		valueStart := strings.Index(s[:keyEnd], valueSep)
+		if valueStart < 0 {
+			if bareKeys {
+				fields[s[:keyEnd]] = true
+			}
+
+			s = s[keyEnd:]
+			continue
+		}
+
+		key := s[:valueStart]
+		if key == "" {
+			return nil, fmt.Errorf("missing key before `%s`", s[:keyEnd])
+		}
+
+		s = s[valueStart+len(valueSep):]
+		if strings.HasPrefix(s, `"`) {
+			// Find the closing quote, skipping over escaped characters
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated quoted value for key `%s`", key)
+			}
+
+			value, err := strconv.Unquote(s[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value for key `%s`: %w", key, err)
+			}
+
+			fields[key] = value
+			s = s[end+1:]
+			if s != "" && !strings.HasPrefix(s, fieldSep) {
+				return nil, fmt.Errorf("unexpected `%s` after quoted value for key `%s`", s, key)
+			}
+
+			continue
+		}
+
+		valueEnd := strings.Index(s, fieldSep)
+		if valueEnd < 0 {
+			valueEnd = len(s)
+		}
+
+		fields[key] = s[:valueEnd]
+		s = s[valueEnd:]
+	}
+}
+
+type ParseFilterConfig struct {
+	// Field is the field that contains the encoded string
+	Field string
+
+	// Format is the encoding of the field
+	Format ParseFormat
+
+	// Target, if set, is the path to put the decoded fields under. Otherwise they're merged into the top level of the message
+	Target string
+
+	// Overwrite controls whether decoded fields replace existing fields of the same name when merging into the top level
+	Overwrite bool
+
+	// RemoveField removes the source field once it's been successfully decoded
+	RemoveField bool
+
+	// FieldSeparator and ValueSeparator split the pairs of the kv format
+	FieldSeparator string
+	ValueSeparator string
+
+	// OnFailure controls what happens to messages where the field can't be decoded. Messages are never modified on failure,
+	// except for adding the ErrorField with PARSE_FAILURE_TAG
+	OnFailure  ParseFailureMode
+	ErrorField string
+}
+
+func NewParseFilterConfigFromRaw(raw map[string]string) (ParseFilterConfig, error) {
+	conf := ParseFilterConfig{
+		Field:          clogger.MESSAGE_FIELD,
+		Format:         PARSE_JSON,
+		Overwrite:      true,
+		FieldSeparator: " ",
+		ValueSeparator: "=",
+		OnFailure:      PARSE_FAILURE_REPORT,
+		ErrorField:     DEFAULT_PARSE_ERROR_FIELD,
+	}
+
+	if field, ok := raw["field"]; ok {
+		conf.Field = field
+	}
+
+	if s, ok := raw["format"]; ok {
+		conf.Format = ParseFormat(strings.ToLower(s))
+		switch conf.Format {
+		case PARSE_JSON, PARSE_LOGFMT, PARSE_KV:
+		default:
+			return ParseFilterConfig{}, fmt.Errorf("invalid `format` in ParseFilter - expected json, logfmt or kv, got `%s`", s)
+		}
+	}
+
+	conf.Target = raw["target"]
+
+	for key, dest := range map[string]*bool{"overwrite": &conf.Overwrite, "remove_field": &conf.RemoveField} {
+		if s, ok := raw[key]; ok {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return ParseFilterConfig{}, fmt.Errorf("invalid `%s` in ParseFilter - expected true or false, got `%s`", key, s)
+			}
+
+			*dest = b
+		}
+	}
+
+	if s, ok := raw["field_split"]; ok {
+		if conf.Format != PARSE_KV {
+			return ParseFilterConfig{}, fmt.Errorf("`field_split` in ParseFilter is only valid with the kv format")
+		}
+
+		conf.FieldSeparator = s
+	}
+
+	if s, ok := raw["value_split"]; ok {
+		if conf.Format != PARSE_KV {
+			return ParseFilterConfig{}, fmt.Errorf("`value_split` in ParseFilter is only valid with the kv format")
+		}
+
+		conf.ValueSeparator = s
+	}
+
+	if conf.FieldSeparator == "" || conf.ValueSeparator == "" {
+		return ParseFilterConfig{}, fmt.Errorf("`field_split` and `value_split` in ParseFilter can't be empty")
+	}
+
+	if s, ok := raw["on_failure"]; ok {
+		conf.OnFailure = ParseFailureMode(strings.ToLower(s))
+		switch conf.OnFailure {
+		case PARSE_FAILURE_REPORT, PARSE_FAILURE_IGNORE, PARSE_FAILURE_TAG:
+		default:
+			return ParseFilterConfig{}, fmt.Errorf("invalid `on_failure` in ParseFilter - expected report, ignore or tag, got `%s`", s)
+		}
+	}
+
+	if field, ok := raw["error_field"]; ok {
+		conf.ErrorField = field
+	}
+
+	return conf, nil
+}
+
+// ParseFilter is a Filter that decodes structured data out of a string field of messages,
+// e.g. apps that log JSON to stdout, which turns into a single `message` field
+type ParseFilter struct {
+	ParseFilterConfig
+}
+
+func NewParseFilter(conf ParseFilterConfig) *ParseFilter {
+	return &ParseFilter{
+		ParseFilterConfig: conf,
+	}
+}
+
+// Decode decodes the given string in the configured format
+func (p *ParseFilter) Decode(s string) (interface{}, error) {
+	switch p.Format {
+	case PARSE_LOGFMT:
+		return parseKeyValues(strings.TrimSpace(s), " ", "=", true)
+	case PARSE_KV:
+		return parseKeyValues(s, p.FieldSeparator, p.ValueSeparator, false)
+	default:
+		var value interface{}
+		if err := json.Unmarshal([]byte(s), &value); err != nil {
+			return nil, err
+		}
+
+		return value, nil
+	}
+}
+
+func (p *ParseFilter) decodeField(fields map[string]interface{}) (interface{}, error) {
+	value, _ := clogger.GetPath(fields, p.Field)
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected a string, got %T", value)
+	}
+
+	decoded, err := p.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := decoded.(map[string]interface{}); !ok && p.Target == "" {
+		return nil, fmt.Errorf("expected an object to merge into the message, got %T", decoded)
+	}
+
+	return decoded, nil
+}
+
+func (p *ParseFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldDrop bool, err error) {
+	if _, ok := clogger.GetPath(msg.ParsedFields, p.Field); !ok {
+		return false, nil
+	}
+
+	fields := newFieldsWriter(msg.ParsedFields)
+	defer func() {
+		msg.ParsedFields = fields.Fields()
+	}()
+
+	decoded, err := p.decodeField(msg.ParsedFields)
+	if err != nil {
+		switch p.OnFailure {
+		case PARSE_FAILURE_IGNORE:
+			return false, nil
+		case PARSE_FAILURE_TAG:
+			fields.Set(p.ErrorField, err.Error())
+			return false, nil
+		default:
+			return false, fmt.Errorf("failed to parse field `%s` as %s: %w", p.Field, p.Format, err)
+		}
+	}
+
+	// Remove the source field first, so that decoded fields with the same name survive
+	if p.RemoveField {
+		fields.Delete(p.Field)
+	}
+
+	if p.Target != "" {
+		fields.Set(p.Target, decoded)
+		return false, nil
+	}
+
+	for key, value := range decoded.(map[string]interface{}) {
+		if _, exists := fields.Fields()[key]; exists && !p.Overwrite {
+			continue
+		}
+
+		// Merged keys are always top level, even if they contain a path separator
+		fields.SetKey(key, value)
+	}
+
+	return false, nil
+}
+
+func init() {
+	filtersRegistry.Register("parse", func(rawConf map[string]string) (interface{}, error) {
+		return NewParseFilterConfigFromRaw(rawConf)
+	}, func(rawConf interface{}) (Filter, error) {
+		if conf, ok := rawConf.(ParseFilterConfig); ok {
+			return NewParseFilter(conf), nil
+		} else {
+			return nil, fmt.Errorf("BUG: invalid type for Parse filter configuration (expected ParseFilterConfig)")
+		}
+	})
+}
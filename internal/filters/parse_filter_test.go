@@ -0,0 +1,207 @@
+package filters_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/filters"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     map[string]string
+		fields   map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name: "json merge",
+			conf: map[string]string{"remove_field": "true"},
+			fields: map[string]interface{}{
+				clogger.MESSAGE_FIELD: `{"level":"info","message":"started","port":8080}`,
+				"host":                "web1",
+			},
+			expected: map[string]interface{}{
+				clogger.MESSAGE_FIELD: "started",
+				"level":               "info",
+				"port":                float64(8080),
+				"host":                "web1",
+			},
+		},
+		{
+			name: "json without overwriting",
+			conf: map[string]string{"overwrite": "false"},
+			fields: map[string]interface{}{
+				clogger.MESSAGE_FIELD: `{"host":"app","user":"bob"}`,
+				"host":                "web1",
+			},
+			expected: map[string]interface{}{
+				clogger.MESSAGE_FIELD: `{"host":"app","user":"bob"}`,
+				"host":                "web1",
+				"user":                "bob",
+			},
+		},
+		{
+			name: "json array under a target",
+			conf: map[string]string{"field": "raw", "target": "data.items"},
+			fields: map[string]interface{}{
+				"raw": `[1, 2]`,
+			},
+			expected: map[string]interface{}{
+				"raw": `[1, 2]`,
+				"data": map[string]interface{}{
+					"items": []interface{}{float64(1), float64(2)},
+				},
+			},
+		},
+		{
+			name: "logfmt",
+			conf: map[string]string{"format": "logfmt", "target": "app"},
+			fields: map[string]interface{}{
+				clogger.MESSAGE_FIELD: `level=warn msg="disk \"sda\" full" debug path=`,
+			},
+			expected: map[string]interface{}{
+				clogger.MESSAGE_FIELD: `level=warn msg="disk \"sda\" full" debug path=`,
+				"app": map[string]interface{}{
+					"level": "warn",
+					"msg":   `disk "sda" full`,
+					"debug": true,
+					"path":  "",
+				},
+			},
+		},
+		{
+			name: "kv with custom separators",
+			conf: map[string]string{"format": "kv", "field_split": "&", "value_split": ":", "remove_field": "true"},
+			fields: map[string]interface{}{
+				clogger.MESSAGE_FIELD: `user:bob&&flag&id:"a&b"`,
+			},
+			expected: map[string]interface{}{
+				"user": "bob",
+				"id":   "a&b",
+			},
+		},
+		{
+			name: "missing field",
+			conf: map[string]string{},
+			fields: map[string]interface{}{
+				"host": "web1",
+			},
+			expected: map[string]interface{}{
+				"host": "web1",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := filters.Construct("parse", test.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := clogger.NewMessage()
+			msg.ParsedFields = test.fields
+
+			if shouldDrop, err := filter.Filter(context.Background(), &msg); err != nil || shouldDrop {
+				t.Fatalf("Filter failed: dropped=%v, err=%v", shouldDrop, err)
+			}
+
+			if !reflect.DeepEqual(msg.ParsedFields, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, msg.ParsedFields)
+			}
+		})
+	}
+}
+
+func TestParseFilterDoesntModifyOriginal(t *testing.T) {
+	for _, conf := range []map[string]string{
+		{"field": "raw.body", "remove_field": "true"},
+		{"field": "raw.body", "target": "raw.parsed"},
+	} {
+		filter, err := filters.Construct("parse", conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		original := clogger.NewMessage()
+		original.ParsedFields["raw"] = map[string]interface{}{"body": `{"level":"info"}`}
+
+		// Messages in cloned batches share their fields
+		msg := original
+		if _, err := filter.Filter(context.Background(), &msg); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]interface{}{"raw": map[string]interface{}{"body": `{"level":"info"}`}}
+		if !reflect.DeepEqual(original.ParsedFields, expected) {
+			t.Fatalf("parsing with %v modified the original message: %v", conf, original.ParsedFields)
+		}
+
+		if reflect.DeepEqual(msg.ParsedFields, expected) {
+			t.Fatalf("expected parsing with %v to change the message", conf)
+		}
+	}
+}
+
+func TestParseFilterFailures(t *testing.T) {
+	tests := []struct {
+		onFailure   string
+		expectError bool
+		expected    map[string]interface{}
+	}{
+		{
+			onFailure:   "report",
+			expectError: true,
+			expected:    map[string]interface{}{clogger.MESSAGE_FIELD: "plain text {"},
+		},
+		{
+			onFailure: "ignore",
+			expected:  map[string]interface{}{clogger.MESSAGE_FIELD: "plain text {"},
+		},
+		{
+			onFailure: "tag",
+			expected: map[string]interface{}{
+				clogger.MESSAGE_FIELD: "plain text {",
+				"parse_error":         "invalid character 'p' looking for beginning of value",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.onFailure, func(t *testing.T) {
+			filter, err := filters.Construct("parse", map[string]string{"on_failure": test.onFailure, "remove_field": "true"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := clogger.NewMessage()
+			msg.ParsedFields[clogger.MESSAGE_FIELD] = "plain text {"
+
+			shouldDrop, err := filter.Filter(context.Background(), &msg)
+			if shouldDrop || (err != nil) != test.expectError {
+				t.Fatalf("unexpected result: dropped=%v, err=%v", shouldDrop, err)
+			}
+
+			if !reflect.DeepEqual(msg.ParsedFields, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, msg.ParsedFields)
+			}
+		})
+	}
+
+	invalid := []map[string]string{
+		{"format": "xml"},
+		{"on_failure": "panic"},
+		{"field_split": ","},
+		{"format": "kv", "value_split": ""},
+		{"overwrite": "maybe"},
+	}
+
+	for _, conf := range invalid {
+		if _, err := filters.Construct("parse", conf); err == nil {
+			t.Errorf("Expected an error constructing a parse filter with %v", conf)
+		}
+	}
+}
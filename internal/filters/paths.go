@@ -0,0 +1,151 @@
+package filters
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+// setPath sets the value at the given dotted path in the fields in place, creating any intermediate maps that don't exist
+// and replacing any intermediate values that aren't maps
+func setPath(fields map[string]interface{}, path string, value interface{}) {
+	if _, ok := fields[path]; ok || !strings.Contains(path, clogger.PATH_SEPARATOR) {
+		fields[path] = value
+		return
+	}
+
+	parts := strings.Split(path, clogger.PATH_SEPARATOR)
+	current := fields
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[part] = next
+		}
+
+		current = next
+	}
+
+	current[parts[len(parts)-1]] = value
+}
+
+// deletePath removes the value at the given dotted path in the fields in place, returning the removed value and whether it existed
+func deletePath(fields map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := fields[path]; ok {
+		delete(fields, path)
+		return value, true
+	}
+
+	index := strings.LastIndex(path, clogger.PATH_SEPARATOR)
+	if index < 0 {
+		return nil, false
+	}
+
+	parent, ok := clogger.GetPath(fields, path[:index])
+	if !ok {
+		return nil, false
+	}
+
+	parentMap, ok := parent.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	key := path[index+1:]
+	value, ok := parentMap[key]
+	delete(parentMap, key)
+	return value, ok
+}
+
+// fieldsWriter makes copy-on-write changes to the fields of a message. Messages may be shared with other branches of
+// the pipeline (batches are only shallow copied when they fan out), so filters must never change their maps in place.
+// Instead, the top level map and every nested map on the path of a change are copied the first time that they're written to
+type fieldsWriter struct {
+	fields map[string]interface{}
+
+	// owned are the maps that have been copied (or created) by this writer, and so are safe to change in place
+	owned map[uintptr]struct{}
+}
+
+func newFieldsWriter(fields map[string]interface{}) *fieldsWriter {
+	return &fieldsWriter{
+		fields: fields,
+		owned:  make(map[uintptr]struct{}),
+	}
+}
+
+// Fields returns the changed fields, which should replace the fields of the message
+func (w *fieldsWriter) Fields() map[string]interface{} {
+	return w.fields
+}
+
+// own returns a version of the given map that's safe to change, copying it if it hasn't already been
+func (w *fieldsWriter) own(m map[string]interface{}) map[string]interface{} {
+	if m != nil {
+		if _, ok := w.owned[reflect.ValueOf(m).Pointer()]; ok {
+			return m
+		}
+	}
+
+	owned := make(map[string]interface{}, len(m)+1)
+	for key, value := range m {
+		owned[key] = value
+	}
+
+	w.owned[reflect.ValueOf(owned).Pointer()] = struct{}{}
+	return owned
+}
+
+// Set is the copy-on-write equivalent of setPath
+func (w *fieldsWriter) Set(path string, value interface{}) {
+	w.fields = w.own(w.fields)
+	if _, ok := w.fields[path]; ok || !strings.Contains(path, clogger.PATH_SEPARATOR) {
+		w.fields[path] = value
+		return
+	}
+
+	parts := strings.Split(path, clogger.PATH_SEPARATOR)
+	current := w.fields
+	for _, part := range parts[:len(parts)-1] {
+		next, _ := current[part].(map[string]interface{})
+		next = w.own(next)
+		current[part] = next
+		current = next
+	}
+
+	current[parts[len(parts)-1]] = value
+}
+
+// SetKey sets the given top level key, without treating it as a path
+func (w *fieldsWriter) SetKey(key string, value interface{}) {
+	w.fields = w.own(w.fields)
+	w.fields[key] = value
+}
+
+// Delete is the copy-on-write equivalent of deletePath
+func (w *fieldsWriter) Delete(path string) (interface{}, bool) {
+	if value, ok := w.fields[path]; ok {
+		w.fields = w.own(w.fields)
+		delete(w.fields, path)
+		return value, true
+	}
+
+	value, ok := clogger.GetPath(w.fields, path)
+	if !ok {
+		return nil, false
+	}
+
+	// The value exists, so every map on the way to it does too
+	parts := strings.Split(path, clogger.PATH_SEPARATOR)
+	w.fields = w.own(w.fields)
+	current := w.fields
+	for _, part := range parts[:len(parts)-1] {
+		next := w.own(current[part].(map[string]interface{}))
+		current[part] = next
+		current = next
+	}
+
+	delete(current, parts[len(parts)-1])
+	return value, true
+}
@@ -1,20 +1,35 @@
 package filters
 
 import (
+	"container/list"
 	"context"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/metrics"
 )
 
 const MICROSECS_PER_SEC = 1_000_000
 
+// RATELIMIT_SHARDS is the number of independently locked shards that rate limit buckets are split across
+const RATELIMIT_SHARDS = 16
+
+const DEFAULT_RATELIMIT_IDLE_TIMEOUT = 5 * time.Minute
+const DEFAULT_RATELIMIT_MAX_BUCKETS = 10000
+const DEFAULT_RATELIMIT_SUMMARY_INTERVAL = time.Minute
+const DEFAULT_DROPPED_COUNT_FIELD = "dropped_count"
+
 type TokenBucket struct {
 	tokens     int
 	rate       int
+	burst      int
 	tokensLock sync.Mutex
 	lastCheck  time.Time
 }
@@ -29,8 +44,8 @@ func (t *TokenBucket) AddNewTokens() {
 	if newTokens > 0 {
 		t.tokens += int(newTokens)
 
-		if t.tokens > t.rate {
-			t.tokens = t.rate
+		if t.tokens > t.burst {
+			t.tokens = t.burst
 		}
 
 		t.lastCheck = time.Now()
@@ -50,80 +65,438 @@ func (t *TokenBucket) TryConsumeTokens(numTokens int) (withinRatelimit bool) {
 }
 
 func NewTokenBucket(rate int, startFull bool) *TokenBucket {
+	return NewTokenBucketWithBurst(rate, rate, startFull)
+}
+
+// NewTokenBucketWithBurst constructs a TokenBucket that refills at `rate` tokens per second, up to `burst` tokens
+func NewTokenBucketWithBurst(rate int, burst int, startFull bool) *TokenBucket {
 	tokens := 0
 	if startFull {
-		tokens = rate
+		tokens = burst
 	}
 
 	return &TokenBucket{
 		tokens:     tokens,
 		rate:       rate,
+		burst:      burst,
 		tokensLock: sync.Mutex{},
 		lastCheck:  time.Now(),
 	}
 }
 
 type RateLimitFilterConfig struct {
-	PartitionKey string
-	Rate         int
+	// PartitionKeys are the fields whose values pick the bucket that a message takes tokens from
+	PartitionKeys []string
+
+	// Rate is the number of messages per second let through for each partition
+	Rate int
+
+	// Burst is the most messages that can be let through at once for a partition that's been quiet. Defaults to Rate
+	Burst int
+
+	// IdleTimeout is how long a partition can go without any messages before its bucket is evicted
+	IdleTimeout time.Duration
+
+	// MaxBuckets caps the number of partitions tracked at once, across all the shards. Past this, the least recently used buckets are evicted
+	MaxBuckets int
+
+	// Summary emits a message for every partition that dropped messages, every SummaryInterval.
+	// Drops are always counted in the clogger_ratelimit_dropped metric, but only per filter.
+	// Evicted partitions are remembered for their summaries up to about MaxBuckets of them, past which their drops
+	// are summarised together under OVERFLOW_GROUP_VALUE
+	Summary         bool
+	SummaryInterval time.Duration
+}
+
+func parsePositiveInt(raw map[string]string, key string, dest *int) error {
+	if s, ok := raw[key]; ok {
+		val, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s in RateLimitFilter - expected an int, got `%s`", key, s)
+		}
+
+		if val <= 0 {
+			return fmt.Errorf("invalid %s in RateLimitFilter - expected a positive int, got %d", key, val)
+		}
+
+		*dest = val
+	}
+
+	return nil
+}
+
+func parsePositiveDuration(raw map[string]string, key string, dest *time.Duration) error {
+	if s, ok := raw[key]; ok {
+		val, err := time.ParseDuration(s)
+		if err != nil || val <= 0 {
+			return fmt.Errorf("invalid %s in RateLimitFilter - expected a positive duration, got `%s`", key, s)
+		}
+
+		*dest = val
+	}
+
+	return nil
 }
 
 func NewRateLimitFilterConfigFromRaw(raw map[string]string) (RateLimitFilterConfig, error) {
-	var partitionKey string
+	conf := RateLimitFilterConfig{
+		IdleTimeout:     DEFAULT_RATELIMIT_IDLE_TIMEOUT,
+		MaxBuckets:      DEFAULT_RATELIMIT_MAX_BUCKETS,
+		SummaryInterval: DEFAULT_RATELIMIT_SUMMARY_INTERVAL,
+	}
+
 	if key, ok := raw["partition_key"]; ok {
-		partitionKey = key
-	} else {
+		conf.PartitionKeys = splitList(key)
+	}
+
+	if len(conf.PartitionKeys) == 0 {
 		return RateLimitFilterConfig{}, fmt.Errorf("missing `partition_key` in RateLimitFilter")
 	}
 
-	var rate int
-	if rateStr, ok := raw["rate"]; ok {
-		if val, err := strconv.Atoi(rateStr); err == nil {
-			if val <= 0 {
-				return RateLimitFilterConfig{}, fmt.Errorf("invalid rate in RateLimitFilter - expected a positive int, got %d", val)
-			}
-			rate = val
-		} else {
-			return RateLimitFilterConfig{}, fmt.Errorf("invalid rate in RateLimitFilter - expected an int, got `%s`", rateStr)
-		}
-	} else {
+	if _, ok := raw["rate"]; !ok {
 		return RateLimitFilterConfig{}, fmt.Errorf("missing `rate` in RateLimitFilter")
 	}
 
-	return RateLimitFilterConfig{
-		Rate:         rate,
-		PartitionKey: partitionKey,
-	}, nil
+	if err := parsePositiveInt(raw, "rate", &conf.Rate); err != nil {
+		return RateLimitFilterConfig{}, err
+	}
+
+	conf.Burst = conf.Rate
+	if err := parsePositiveInt(raw, "burst", &conf.Burst); err != nil {
+		return RateLimitFilterConfig{}, err
+	}
+
+	if err := parsePositiveInt(raw, "max_buckets", &conf.MaxBuckets); err != nil {
+		return RateLimitFilterConfig{}, err
+	}
+
+	if err := parsePositiveDuration(raw, "idle_timeout", &conf.IdleTimeout); err != nil {
+		return RateLimitFilterConfig{}, err
+	}
+
+	if err := parsePositiveDuration(raw, "summary_interval", &conf.SummaryInterval); err != nil {
+		return RateLimitFilterConfig{}, err
+	}
+
+	if s, ok := raw["summary"]; ok {
+		var err error
+		conf.Summary, err = strconv.ParseBool(s)
+		if err != nil {
+			return RateLimitFilterConfig{}, fmt.Errorf("invalid summary in RateLimitFilter - expected true or false, got `%s`", s)
+		}
+	}
+
+	return conf, nil
+}
+
+// rateLimitPartition is the bucket, and drop count, of a single partition
+type rateLimitPartition struct {
+	key      string
+	fields   map[string]interface{}
+	bucket   *TokenBucket
+	lastSeen time.Time
+	dropped  int
 }
 
+// rateLimitShard is a set of partitions behind a single lock
+type rateLimitShard struct {
+	lock sync.Mutex
+
+	// partitions indexes the elements of lru, which is ordered least recently used first
+	partitions map[string]*list.Element
+	lru        *list.List
+
+	// evicted are partitions that dropped messages, but were evicted before their drops were summarised, by key.
+	// evictedOverflow counts the drops of evicted partitions that didn't fit in it
+	evicted         map[string]*rateLimitPartition
+	evictedOverflow int
+}
+
+// RateLimitFilter is an EmittingFilter that drops messages over a given rate, using a token bucket per partition
 type RateLimitFilter struct {
 	RateLimitFilterConfig
-	buckets     map[string]*TokenBucket
-	bucketsLock sync.Mutex
+	shards             []*rateLimitShard
+	maxEvictedPerShard int
+
+	// buckets is the number of partitions across all the shards
+	buckets int64
+
+	summaryLock sync.Mutex
+	lastSummary time.Time
 }
 
 func NewRateLimitFilter(conf RateLimitFilterConfig) *RateLimitFilter {
+	if conf.Burst <= 0 {
+		conf.Burst = conf.Rate
+	}
+
+	if conf.IdleTimeout <= 0 {
+		conf.IdleTimeout = DEFAULT_RATELIMIT_IDLE_TIMEOUT
+	}
+
+	if conf.MaxBuckets <= 0 {
+		conf.MaxBuckets = DEFAULT_RATELIMIT_MAX_BUCKETS
+	}
+
+	if conf.SummaryInterval <= 0 {
+		conf.SummaryInterval = DEFAULT_RATELIMIT_SUMMARY_INTERVAL
+	}
+
+	shards := make([]*rateLimitShard, RATELIMIT_SHARDS)
+	for i := range shards {
+		shards[i] = &rateLimitShard{
+			partitions: make(map[string]*list.Element),
+			lru:        list.New(),
+			evicted:    make(map[string]*rateLimitPartition),
+		}
+	}
+
 	return &RateLimitFilter{
 		RateLimitFilterConfig: conf,
-		buckets:               make(map[string]*TokenBucket),
-		bucketsLock:           sync.Mutex{},
+		shards:                shards,
+		maxEvictedPerShard:    (conf.MaxBuckets + RATELIMIT_SHARDS - 1) / RATELIMIT_SHARDS,
+		lastSummary:           time.Now(),
+	}
+}
+
+// partitionKey returns the key of the partition that the given message belongs to
+func (r *RateLimitFilter) partitionKey(msg *clogger.Message) string {
+	if len(r.PartitionKeys) == 1 {
+		value, _ := clogger.GetPath(msg.ParsedFields, r.PartitionKeys[0])
+		return fmt.Sprint(value)
+	}
+
+	values := make([]string, 0, len(r.PartitionKeys))
+	for _, field := range r.PartitionKeys {
+		value, _ := clogger.GetPath(msg.ParsedFields, field)
+		values = append(values, fmt.Sprint(value))
+	}
+
+	return strings.Join(values, ",")
+}
+
+func (r *RateLimitFilter) shardFor(key string) *rateLimitShard {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return r.shards[hash.Sum32()%RATELIMIT_SHARDS]
+}
+
+// evict removes the given partition from the shard. The shard lock must be held
+func (r *RateLimitFilter) evict(shard *rateLimitShard, element *list.Element) {
+	partition := shard.lru.Remove(element).(*rateLimitPartition)
+	delete(shard.partitions, partition.key)
+	atomic.AddInt64(&r.buckets, -1)
+
+	if !r.Summary || partition.dropped == 0 {
+		return
+	}
+
+	if evicted, ok := shard.evicted[partition.key]; ok {
+		evicted.dropped += partition.dropped
+	} else if len(shard.evicted) < r.maxEvictedPerShard {
+		shard.evicted[partition.key] = partition
+	} else {
+		shard.evictedOverflow += partition.dropped
+	}
+}
+
+// enforceMaxBuckets evicts the least recently used buckets across all the shards until there are at most MaxBuckets.
+// No shard locks may be held, as it takes each of them in turn
+func (r *RateLimitFilter) enforceMaxBuckets() {
+	for atomic.LoadInt64(&r.buckets) > int64(r.MaxBuckets) {
+		var oldest *rateLimitShard
+		var oldestSeen time.Time
+		for _, shard := range r.shards {
+			shard.lock.Lock()
+			if front := shard.lru.Front(); front != nil {
+				if lastSeen := front.Value.(*rateLimitPartition).lastSeen; oldest == nil || lastSeen.Before(oldestSeen) {
+					oldest, oldestSeen = shard, lastSeen
+				}
+			}
+
+			shard.lock.Unlock()
+		}
+
+		if oldest == nil {
+			return
+		}
+
+		// The shard may have changed since it was checked, but its front is still a good enough candidate
+		oldest.lock.Lock()
+		if front := oldest.lru.Front(); front != nil && atomic.LoadInt64(&r.buckets) > int64(r.MaxBuckets) {
+			r.evict(oldest, front)
+		}
+
+		oldest.lock.Unlock()
+	}
+}
+
+// evictIdle removes all the partitions in the shard that haven't seen a message since before the idle timeout.
+// The shard lock must be held
+func (r *RateLimitFilter) evictIdle(shard *rateLimitShard, now time.Time) {
+	for element := shard.lru.Front(); element != nil; element = shard.lru.Front() {
+		if now.Sub(element.Value.(*rateLimitPartition).lastSeen) < r.IdleTimeout {
+			return
+		}
+
+		r.evict(shard, element)
 	}
 }
 
 func (r *RateLimitFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldDrop bool, err error) {
-	key := fmt.Sprint(msg.ParsedFields[r.PartitionKey])
-	r.bucketsLock.Lock()
-	defer r.bucketsLock.Unlock()
+	key := r.partitionKey(msg)
+	shouldDrop, added := r.consume(r.shardFor(key), key, msg)
+	if added {
+		r.enforceMaxBuckets()
+	}
+
+	if shouldDrop {
+		// Partitions can be arbitrarily high cardinality, so the per partition counts only go in the summaries
+		metrics.RateLimitDropped.WithLabelValues(StepNameFromContext(ctx)).Inc()
+	}
+
+	return shouldDrop, nil
+}
+
+// consume takes a token for the given message from the bucket of its partition, returning whether the message should
+// be dropped, and whether a new bucket was added for it
+func (r *RateLimitFilter) consume(shard *rateLimitShard, key string, msg *clogger.Message) (shouldDrop bool, added bool) {
+	now := time.Now()
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	r.evictIdle(shard, now)
+
+	var partition *rateLimitPartition
+	if element, ok := shard.partitions[key]; ok {
+		partition = element.Value.(*rateLimitPartition)
+		shard.lru.MoveToBack(element)
+	} else {
+		partition = &rateLimitPartition{
+			key:    key,
+			bucket: NewTokenBucketWithBurst(r.Rate, r.Burst, true),
+		}
+
+		if r.Summary {
+			partition.fields = make(map[string]interface{}, len(r.PartitionKeys))
+			for _, field := range r.PartitionKeys {
+				if value, ok := clogger.GetPath(msg.ParsedFields, field); ok {
+					partition.fields[field] = value
+				}
+			}
+		}
+
+		shard.partitions[key] = shard.lru.PushBack(partition)
+		atomic.AddInt64(&r.buckets, 1)
+		added = true
+	}
+
+	partition.lastSeen = now
+	partition.bucket.AddNewTokens()
+	hadTokenForMsg := partition.bucket.TryConsumeTokens(1)
+	if !hadTokenForMsg {
+		partition.dropped++
+	}
+
+	return !hadTokenForMsg, added
+}
+
+// summarise builds the drop summary message for the given partition
+func (r *RateLimitFilter) summarise(partition *rateLimitPartition, dropped int, now time.Time) clogger.Message {
+	summary := clogger.NewMessage()
+	summary.EventTime = now
+	summary.IngestTime = now
+	for field, value := range partition.fields {
+		setPath(summary.ParsedFields, field, value)
+	}
+
+	summary.ParsedFields[clogger.MESSAGE_FIELD] = fmt.Sprintf("rate limit dropped %d messages for %s", dropped, partition.key)
+	summary.ParsedFields[DEFAULT_DROPPED_COUNT_FIELD] = dropped
+
+	return summary
+}
+
+// Flush evicts idle buckets and, if summaries are enabled and the summary interval has passed (or this is the final flush),
+// returns a message per partition that dropped messages since the last summary
+func (r *RateLimitFilter) Flush(ctx context.Context, now time.Time, final bool) []clogger.Message {
+	for _, shard := range r.shards {
+		shard.lock.Lock()
+		r.evictIdle(shard, now)
+		shard.lock.Unlock()
+	}
+
+	if !r.Summary {
+		return nil
+	}
+
+	r.summaryLock.Lock()
+	defer r.summaryLock.Unlock()
+	if !final && now.Sub(r.lastSummary) < r.SummaryInterval {
+		return nil
+	}
+
+	r.lastSummary = now
+
+	summaries := []clogger.Message{}
+	overflow := 0
+	for _, shard := range r.shards {
+		shard.lock.Lock()
+
+		// A partition can be evicted and come back before the summary, so merge the counts of the same keys
+		dropped := map[string]int{}
+		partitions := map[string]*rateLimitPartition{}
+		keys := []string{}
+		add := func(partition *rateLimitPartition) {
+			if _, ok := dropped[partition.key]; !ok {
+				keys = append(keys, partition.key)
+				partitions[partition.key] = partition
+			}
+
+			dropped[partition.key] += partition.dropped
+			partition.dropped = 0
+		}
+
+		evictedKeys := make([]string, 0, len(shard.evicted))
+		for key := range shard.evicted {
+			evictedKeys = append(evictedKeys, key)
+		}
+
+		sort.Strings(evictedKeys)
+		for _, key := range evictedKeys {
+			add(shard.evicted[key])
+		}
+
+		shard.evicted = make(map[string]*rateLimitPartition)
+		overflow += shard.evictedOverflow
+		shard.evictedOverflow = 0
+		for element := shard.lru.Front(); element != nil; element = element.Next() {
+			if partition := element.Value.(*rateLimitPartition); partition.dropped > 0 {
+				add(partition)
+			}
+		}
+
+		shard.lock.Unlock()
+
+		for _, key := range keys {
+			summaries = append(summaries, r.summarise(partitions[key], dropped[key], now))
+		}
+	}
+
+	if overflow > 0 {
+		partition := &rateLimitPartition{
+			key:    OVERFLOW_GROUP_VALUE,
+			fields: make(map[string]interface{}, len(r.PartitionKeys)),
+		}
+
+		for _, field := range r.PartitionKeys {
+			partition.fields[field] = OVERFLOW_GROUP_VALUE
+		}
 
-	tokenBucket := r.buckets[key]
-	if tokenBucket == nil {
-		r.buckets[key] = NewTokenBucket(r.Rate, true)
-		tokenBucket = r.buckets[key]
+		summaries = append(summaries, r.summarise(partition, overflow, now))
 	}
-	tokenBucket.AddNewTokens()
-	hadTokenForMsg := tokenBucket.TryConsumeTokens(1)
 
-	return !hadTokenForMsg, nil
+	return summaries
 }
 
 func init() {
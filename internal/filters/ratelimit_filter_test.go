@@ -5,18 +5,20 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/sinkingpoint/clogger/internal/clogger"
 	"github.com/sinkingpoint/clogger/internal/filters"
+	"github.com/sinkingpoint/clogger/internal/metrics"
 )
 
 func TestRateLimitFilter(t *testing.T) {
 	filter := filters.NewRateLimitFilter(filters.RateLimitFilterConfig{
-		PartitionKey: "test",
-		Rate:         1,
+		PartitionKeys: []string{"test"},
+		Rate:          1,
 	})
 
 	if shouldDrop, _ := filter.Filter(context.Background(), &clogger.Message{
-		MonoTimestamp: time.Now().UnixNano(),
+		EventTime: time.Now(),
 		ParsedFields: map[string]interface{}{
 			"test": "a",
 		},
@@ -26,7 +28,7 @@ func TestRateLimitFilter(t *testing.T) {
 
 	// Uses the same key as above so should fail
 	if shouldDrop, _ := filter.Filter(context.Background(), &clogger.Message{
-		MonoTimestamp: time.Now().UnixNano(),
+		EventTime: time.Now(),
 		ParsedFields: map[string]interface{}{
 			"test": "a",
 		},
@@ -36,7 +38,7 @@ func TestRateLimitFilter(t *testing.T) {
 
 	// Uses a different key, so should pass
 	if shouldDrop, _ := filter.Filter(context.Background(), &clogger.Message{
-		MonoTimestamp: time.Now().UnixNano(),
+		EventTime: time.Now(),
 		ParsedFields: map[string]interface{}{
 			"test": "b",
 		},
@@ -44,3 +46,186 @@ func TestRateLimitFilter(t *testing.T) {
 		t.Fatal("Message didn't get filtered when it should have")
 	}
 }
+
+func rateLimitMessage(fields map[string]interface{}) *clogger.Message {
+	msg := clogger.NewMessage()
+	msg.ParsedFields = fields
+	return &msg
+}
+
+func TestRateLimitFilterBurstAndCompositeKeys(t *testing.T) {
+	filter, err := filters.Construct("ratelimit", map[string]string{
+		"partition_key": "host, app.name",
+		"rate":          "1",
+		"burst":         "3",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := map[string]int{}
+	for i := 0; i < 5; i++ {
+		for _, host := range []string{"web1", "web2"} {
+			msg := rateLimitMessage(map[string]interface{}{
+				"host": host,
+				"app":  map[string]interface{}{"name": "api"},
+			})
+
+			if shouldDrop, _ := filter.Filter(context.Background(), msg); !shouldDrop {
+				kept[host]++
+			}
+		}
+	}
+
+	if kept["web1"] != 3 || kept["web2"] != 3 {
+		t.Fatalf("expected each partition to get a burst of 3 messages, got %v", kept)
+	}
+}
+
+func TestRateLimitFilterEviction(t *testing.T) {
+	filter := filters.NewRateLimitFilter(filters.RateLimitFilterConfig{
+		PartitionKeys: []string{"id"},
+		Rate:          1,
+		MaxBuckets:    filters.RATELIMIT_SHARDS,
+		IdleTimeout:   time.Minute,
+		Summary:       true,
+	})
+
+	// Exhaust the bucket of the first partition
+	for i := 0; i < 2; i++ {
+		filter.Filter(context.Background(), rateLimitMessage(map[string]interface{}{"id": 0}))
+	}
+
+	// Way more partitions than the cap, which should push the first one out
+	for i := 1; i < 1000; i++ {
+		filter.Filter(context.Background(), rateLimitMessage(map[string]interface{}{"id": i}))
+	}
+
+	if shouldDrop, _ := filter.Filter(context.Background(), rateLimitMessage(map[string]interface{}{"id": 0})); shouldDrop {
+		t.Fatal("expected the first partition to have been evicted, and to start with a full bucket")
+	}
+
+	// The drop from before the eviction still gets summarised
+	summaries := filter.Flush(context.Background(), time.Now(), true)
+	if len(summaries) != 1 || summaries[0].ParsedFields["id"] != 0 || summaries[0].ParsedFields[filters.DEFAULT_DROPPED_COUNT_FIELD] != 1 {
+		t.Fatalf("expected a summary of the evicted partition, got %v", summaries)
+	}
+}
+
+func TestRateLimitFilterMaxBucketsIsGlobal(t *testing.T) {
+	// Every pair of keys fits under the cap, wherever they're sharded, so neither gets its bucket back by being evicted
+	for a := 0; a < 20; a++ {
+		for b := a + 1; b < 20; b++ {
+			filter := filters.NewRateLimitFilter(filters.RateLimitFilterConfig{
+				PartitionKeys: []string{"id"},
+				Rate:          1,
+				MaxBuckets:    2,
+				IdleTimeout:   time.Minute,
+			})
+
+			for i := 0; i < 2; i++ {
+				filter.Filter(context.Background(), rateLimitMessage(map[string]interface{}{"id": a}))
+				filter.Filter(context.Background(), rateLimitMessage(map[string]interface{}{"id": b}))
+			}
+
+			for _, id := range []int{a, b} {
+				if shouldDrop, _ := filter.Filter(context.Background(), rateLimitMessage(map[string]interface{}{"id": id})); !shouldDrop {
+					t.Fatalf("expected partition %d to stay rate limited alongside %d", id, a+b-id)
+				}
+			}
+		}
+	}
+}
+
+func TestRateLimitFilterEvictedSummariesAreBounded(t *testing.T) {
+	filter := filters.NewRateLimitFilter(filters.RateLimitFilterConfig{
+		PartitionKeys: []string{"id"},
+		Rate:          1,
+		MaxBuckets:    1,
+		IdleTimeout:   time.Minute,
+		Summary:       true,
+	})
+
+	for id := 0; id < 1000; id++ {
+		for i := 0; i < 2; i++ {
+			filter.Filter(context.Background(), rateLimitMessage(map[string]interface{}{"id": id}))
+		}
+	}
+
+	summaries := filter.Flush(context.Background(), time.Now(), true)
+	if len(summaries) > filters.RATELIMIT_SHARDS+2 {
+		t.Fatalf("expected the evicted partitions to be bounded, got %d summaries", len(summaries))
+	}
+
+	total := 0
+	for _, summary := range summaries {
+		total += summary.ParsedFields[filters.DEFAULT_DROPPED_COUNT_FIELD].(int)
+	}
+
+	last := summaries[len(summaries)-1]
+	if total != 1000 || last.ParsedFields["id"] != filters.OVERFLOW_GROUP_VALUE {
+		t.Fatalf("expected every drop to be summarised, with the overflow last, got %d drops and %v", total, last.ParsedFields)
+	}
+}
+
+func TestRateLimitFilterSummary(t *testing.T) {
+	filter, err := filters.Construct("ratelimit", map[string]string{
+		"partition_key":    "host",
+		"rate":             "2",
+		"summary":          "true",
+		"summary_interval": "10s",
+		"idle_timeout":     "1m",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	emitter := filter.(filters.EmittingFilter)
+	ctx := filters.ContextWithStepName(context.Background(), "test_summary_limiter")
+	for i := 0; i < 7; i++ {
+		filter.Filter(ctx, rateLimitMessage(map[string]interface{}{"host": "web1"}))
+	}
+
+	// The metric is labelled by the filter, not the partition
+	if dropped := testutil.ToFloat64(metrics.RateLimitDropped.WithLabelValues("test_summary_limiter")); dropped != 5 {
+		t.Fatalf("expected 5 drops to be counted for the filter, got %v", dropped)
+	}
+
+	if summaries := emitter.Flush(context.Background(), time.Now(), false); len(summaries) != 0 {
+		t.Fatalf("expected no summaries before the interval, got %v", summaries)
+	}
+
+	summaries := emitter.Flush(context.Background(), time.Now().Add(10*time.Second), false)
+	if len(summaries) != 1 {
+		t.Fatalf("expected one summary, got %v", summaries)
+	}
+
+	if summaries[0].ParsedFields["host"] != "web1" || summaries[0].ParsedFields[filters.DEFAULT_DROPPED_COUNT_FIELD] != 5 {
+		t.Fatalf("got unexpected summary: %v", summaries[0].ParsedFields)
+	}
+
+	// Counts reset after each summary
+	if summaries := emitter.Flush(context.Background(), time.Now().Add(20*time.Second), false); len(summaries) != 0 {
+		t.Fatalf("expected no summaries without new drops, got %v", summaries)
+	}
+}
+
+func TestRateLimitFilterConfig(t *testing.T) {
+	invalid := []map[string]string{
+		{"rate": "1"},
+		{"partition_key": "host"},
+		{"partition_key": "host", "rate": "0"},
+		{"partition_key": "host", "rate": "1", "burst": "many"},
+		{"partition_key": "host", "rate": "1", "idle_timeout": "-1s"},
+		{"partition_key": "host", "rate": "1", "max_buckets": "0"},
+		{"partition_key": "host", "rate": "1", "summary": "maybe"},
+	}
+
+	for _, conf := range invalid {
+		if _, err := filters.Construct("ratelimit", conf); err == nil {
+			t.Errorf("Expected an error constructing a ratelimit filter with %v", conf)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package filters
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+const DEFAULT_REDACT_MASK = "[REDACTED]"
+
+// SECRET_GROUP is the name of the capture group that limits a detector to part of its match,
+// e.g. redacting the token in `Bearer <token>` but not the `Bearer`
+const SECRET_GROUP = "secret"
+
+// CUSTOM_PATTERN_PREFIX is the prefix of config keys that define custom detectors, e.g. `pattern_ssn="\d{3}-\d{2}-\d{4}"`
+const CUSTOM_PATTERN_PREFIX = "pattern_"
+
+type RedactAction string
+
+const (
+	REDACT_MASK   RedactAction = "mask"
+	REDACT_HASH   RedactAction = "hash"
+	REDACT_REMOVE RedactAction = "remove"
+)
+
+// Detector finds sensitive values in strings
+type Detector struct {
+	Name  string
+	regex *regexp.Regexp
+
+	// validate, if set, filters out matches that look right but aren't, e.g. card numbers that fail the Luhn check
+	validate func(match string) bool
+}
+
+func NewDetector(name string, pattern string, validate func(match string) bool) (Detector, error) {
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return Detector{}, err
+	}
+
+	return Detector{
+		Name:     name,
+		regex:    regex,
+		validate: validate,
+	}, nil
+}
+
+func mustDetector(name string, pattern string, validate func(match string) bool) Detector {
+	detector, err := NewDetector(name, pattern, validate)
+	if err != nil {
+		panic(err)
+	}
+
+	return detector
+}
+
+// Find returns the [start, end) spans of the sensitive values in the given string
+func (d Detector) Find(s string) [][2]int {
+	group := d.regex.SubexpIndex(SECRET_GROUP)
+	spans := [][2]int{}
+	for _, match := range d.regex.FindAllStringSubmatchIndex(s, -1) {
+		start, end := match[0], match[1]
+		if group > 0 && match[2*group] >= 0 {
+			start, end = match[2*group], match[2*group+1]
+		}
+
+		if start == end || (d.validate != nil && !d.validate(s[start:end])) {
+			continue
+		}
+
+		spans = append(spans, [2]int{start, end})
+	}
+
+	return spans
+}
+
+// luhnValid returns whether the digits in the given string pass the Luhn checksum used by payment cards
+func luhnValid(s string) bool {
+	sum := 0
+	digits := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		digits++
+	}
+
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
+
+// isIPv6 returns whether the given string is an IPv6 address. The ipv6 detector matches whole runs of letters, digits,
+// dots and colons, so that scope operators like `std::string` or `Foo::Bar` are never cut down to something that parses,
+// and addresses must contain a digit so that names made of hex letters like `Add::Bead` aren't taken for one either
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && strings.Contains(s, ":") && strings.ContainsAny(s, "0123456789")
+}
+
+// builtinDetectors are the detectors that can be enabled by name
+var builtinDetectors = map[string]Detector{
+	"email":        mustDetector("email", `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`, nil),
+	"credit_card":  mustDetector("credit_card", `\b(?:\d[ \-]?){12,18}\d\b`, luhnValid),
+	"ipv4":         mustDetector("ipv4", `\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`, nil),
+	"ipv6":         mustDetector("ipv6", `(?i)[0-9a-z.:]*:(?:[0-9a-z.:]*[0-9a-z:])?`, isIPv6),
+	"jwt":          mustDetector("jwt", `\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`, nil),
+	"aws_key":      mustDetector("aws_key", `\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b|(?i:aws_?secret_?access_?key)["']?\s*[:=]\s*["']?(?P<secret>[A-Za-z0-9/+=]{40})(?:[^A-Za-z0-9/+=]|$)`, nil),
+	"bearer_token": mustDetector("bearer_token", `(?i)\bbearer\s+(?P<secret>[A-Za-z0-9\-._~+/]+=*)`, nil),
+}
+
+// DEFAULT_DETECTORS are the detectors used when none are configured, in the order they're applied
+var DEFAULT_DETECTORS = []string{"email", "credit_card", "ipv4", "ipv6", "jwt", "aws_key", "bearer_token"}
+
+type RedactFilterConfig struct {
+	// Detectors are the detectors that find values to redact
+	Detectors []Detector
+
+	// Fields are the paths of the fields to redact. Values under nested maps and lists in those fields are also redacted.
+	// If empty, all string values are redacted
+	Fields []string
+
+	// Action is what to do with sensitive values - mask or hash them, or remove the field that contains them
+	Action RedactAction
+
+	// Mask is the string that replaces sensitive values with the mask action
+	Mask string
+
+	// HashKey is the HMAC key used to hash values with the hash action
+	HashKey []byte
+}
+
+func NewRedactFilterConfigFromRaw(raw map[string]string) (RedactFilterConfig, error) {
+	conf := RedactFilterConfig{
+		Action: REDACT_MASK,
+		Mask:   DEFAULT_REDACT_MASK,
+	}
+
+	names := DEFAULT_DETECTORS
+	if s, ok := raw["detectors"]; ok {
+		names = splitList(s)
+		if len(names) == 1 && strings.ToLower(names[0]) == "none" {
+			names = nil
+		}
+	}
+
+	for _, name := range names {
+		detector, ok := builtinDetectors[strings.ToLower(name)]
+		if !ok {
+			return RedactFilterConfig{}, fmt.Errorf("invalid detector `%s` in RedactFilter - expected one of %s", name, strings.Join(DEFAULT_DETECTORS, ", "))
+		}
+
+		conf.Detectors = append(conf.Detectors, detector)
+	}
+
+	// Sort the custom patterns so that they're applied in a consistent order
+	customNames := []string{}
+	for key := range raw {
+		if strings.HasPrefix(key, CUSTOM_PATTERN_PREFIX) {
+			customNames = append(customNames, key)
+		}
+	}
+
+	sort.Strings(customNames)
+	for _, key := range customNames {
+		name := strings.TrimPrefix(key, CUSTOM_PATTERN_PREFIX)
+		detector, err := NewDetector(name, raw[key], nil)
+		if err != nil {
+			return RedactFilterConfig{}, fmt.Errorf("invalid `%s` in RedactFilter: %w", key, err)
+		}
+
+		conf.Detectors = append(conf.Detectors, detector)
+	}
+
+	if len(conf.Detectors) == 0 {
+		return RedactFilterConfig{}, fmt.Errorf("RedactFilter requires at least one detector")
+	}
+
+	conf.Fields = splitList(raw["fields"])
+
+	if s, ok := raw["action"]; ok {
+		conf.Action = RedactAction(strings.ToLower(s))
+		switch conf.Action {
+		case REDACT_MASK, REDACT_HASH, REDACT_REMOVE:
+		default:
+			return RedactFilterConfig{}, fmt.Errorf("invalid `action` in RedactFilter - expected mask, hash or remove, got `%s`", s)
+		}
+	}
+
+	if mask, ok := raw["mask"]; ok {
+		conf.Mask = mask
+	}
+
+	if key, ok := raw["hash_key"]; ok {
+		conf.HashKey = []byte(key)
+	}
+
+	if keyFile, ok := raw["hash_key_file"]; ok {
+		if conf.HashKey != nil {
+			return RedactFilterConfig{}, fmt.Errorf("only one of `hash_key` and `hash_key_file` can be set in RedactFilter")
+		}
+
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return RedactFilterConfig{}, fmt.Errorf("failed to read `hash_key_file` in RedactFilter: %w", err)
+		}
+
+		conf.HashKey = []byte(strings.TrimSpace(string(key)))
+	}
+
+	if conf.Action == REDACT_HASH && len(conf.HashKey) == 0 {
+		return RedactFilterConfig{}, fmt.Errorf("missing `hash_key` or `hash_key_file` in RedactFilter")
+	}
+
+	return conf, nil
+}
+
+// RedactFilter is a Filter that scrubs sensitive values out of messages.
+// Only the maps that contain redacted values are copied, the rest are shared with the original message
+type RedactFilter struct {
+	RedactFilterConfig
+}
+
+func NewRedactFilter(conf RedactFilterConfig) *RedactFilter {
+	return &RedactFilter{
+		RedactFilterConfig: conf,
+	}
+}
+
+// Redact returns the given string with all the sensitive values replaced, and whether anything was found
+func (r *RedactFilter) Redact(s string) (string, bool) {
+	spans := [][2]int{}
+	for _, detector := range r.Detectors {
+		spans = append(spans, detector.Find(s)...)
+	}
+
+	if len(spans) == 0 {
+		return s, false
+	}
+
+	// Merge overlapping matches from different detectors so that we replace each sensitive region once
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+
+	var builder strings.Builder
+	last := 0
+	for i := 0; i < len(spans); i++ {
+		start, end := spans[i][0], spans[i][1]
+		for i+1 < len(spans) && spans[i+1][0] < end {
+			i++
+			if spans[i][1] > end {
+				end = spans[i][1]
+			}
+		}
+
+		builder.WriteString(s[last:start])
+		builder.WriteString(r.replacement(s[start:end]))
+		last = end
+	}
+
+	builder.WriteString(s[last:])
+	return builder.String(), true
+}
+
+func (r *RedactFilter) replacement(value string) string {
+	if r.Action == REDACT_HASH {
+		mac := hmac.New(sha256.New, r.HashKey)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	return r.Mask
+}
+
+// inScope returns whether the value at the given path should be redacted
+func (r *RedactFilter) inScope(path string) bool {
+	if len(r.Fields) == 0 {
+		return true
+	}
+
+	for _, field := range r.Fields {
+		if path == field || strings.HasPrefix(path, field+clogger.PATH_SEPARATOR) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mightContainScope returns whether there could be values in scope under the given path
+func (r *RedactFilter) mightContainScope(path string) bool {
+	if r.inScope(path) {
+		return true
+	}
+
+	for _, field := range r.Fields {
+		if strings.HasPrefix(field, path+clogger.PATH_SEPARATOR) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactValue redacts the given value, returning the new value, whether it changed, and whether it should be removed
+func (r *RedactFilter) redactValue(path string, value interface{}) (newValue interface{}, changed bool, remove bool) {
+	switch v := value.(type) {
+	case string:
+		if !r.inScope(path) {
+			return v, false, false
+		}
+
+		redacted, found := r.Redact(v)
+		if found && r.Action == REDACT_REMOVE {
+			return nil, true, true
+		}
+
+		return redacted, found, false
+	case map[string]interface{}:
+		if newMap, changed := r.redactMap(path, v); changed {
+			return newMap, true, false
+		}
+	case []interface{}:
+		var newSlice []interface{}
+		for i, elem := range v {
+			newElem, elemChanged, elemRemove := r.redactValue(path, elem)
+			if elemChanged && newSlice == nil {
+				newSlice = make([]interface{}, i, len(v))
+				copy(newSlice, v[:i])
+			}
+
+			if newSlice != nil && !elemRemove {
+				newSlice = append(newSlice, newElem)
+			}
+		}
+
+		if newSlice != nil {
+			return newSlice, true, false
+		}
+	}
+
+	return value, false, false
+}
+
+// redactMap redacts the values in the given map, returning a copy if anything changed
+func (r *RedactFilter) redactMap(prefix string, fields map[string]interface{}) (map[string]interface{}, bool) {
+	var newFields map[string]interface{}
+	for key, value := range fields {
+		path := key
+		if prefix != "" {
+			path = prefix + clogger.PATH_SEPARATOR + key
+		}
+
+		if !r.mightContainScope(path) {
+			continue
+		}
+
+		newValue, changed, remove := r.redactValue(path, value)
+		if !changed {
+			continue
+		}
+
+		if newFields == nil {
+			newFields = make(map[string]interface{}, len(fields))
+			for k, v := range fields {
+				newFields[k] = v
+			}
+		}
+
+		if remove {
+			delete(newFields, key)
+		} else {
+			newFields[key] = newValue
+		}
+	}
+
+	if newFields == nil {
+		return fields, false
+	}
+
+	return newFields, true
+}
+
+func (r *RedactFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldDrop bool, err error) {
+	msg.ParsedFields, _ = r.redactMap("", msg.ParsedFields)
+	return false, nil
+}
+
+func init() {
+	filtersRegistry.Register("redact", func(rawConf map[string]string) (interface{}, error) {
+		return NewRedactFilterConfigFromRaw(rawConf)
+	}, func(rawConf interface{}) (Filter, error) {
+		if conf, ok := rawConf.(RedactFilterConfig); ok {
+			return NewRedactFilter(conf), nil
+		} else {
+			return nil, fmt.Errorf("BUG: invalid type for Redact filter configuration (expected RedactFilterConfig)")
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package filters
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+const DEFAULT_SAMPLE_RATE_FIELD = "sample_rate"
+
+func parseSampleRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(rate) || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("expected a number between 0 and 1, got `%s`", s)
+	}
+
+	return rate, nil
+}
+
+type SampleFilterConfig struct {
+	// Rate is the fraction of messages to keep, for messages that don't match any of the Rates
+	Rate float64
+
+	// RateField is the field whose value picks the rate out of Rates, e.g. `level`
+	RateField string
+	Rates     map[string]float64
+
+	// HashField, if set, makes sampling deterministic on the value of this field, so that e.g. all the messages
+	// of one request are kept or dropped together. Messages without the field are sampled randomly
+	HashField string
+
+	// SampleRateField is the field that kept messages are annotated with their sample rate in, so that
+	// downstream counts can be re-weighted by dividing by it. Empty disables the annotation
+	SampleRateField string
+}
+
+func NewSampleFilterConfigFromRaw(raw map[string]string) (SampleFilterConfig, error) {
+	conf := SampleFilterConfig{
+		Rate:            1,
+		HashField:       raw["hash_field"],
+		SampleRateField: DEFAULT_SAMPLE_RATE_FIELD,
+	}
+
+	if field, ok := raw["sample_rate_field"]; ok {
+		conf.SampleRateField = field
+	}
+
+	if rates, ok := raw["rates"]; ok {
+		conf.RateField = raw["rate_field"]
+		if conf.RateField == "" {
+			return SampleFilterConfig{}, fmt.Errorf("missing `rate_field` in SampleFilter, which is required with `rates`")
+		}
+
+		pairs, err := splitPairs(rates, ":", "rates")
+		if err != nil {
+			return SampleFilterConfig{}, fmt.Errorf("invalid `rates` in SampleFilter - expected `value:rate` pairs, got `%s`", rates)
+		}
+
+		conf.Rates = make(map[string]float64, len(pairs))
+		for _, pair := range pairs {
+			rate, err := parseSampleRate(pair[1])
+			if err != nil {
+				return SampleFilterConfig{}, fmt.Errorf("invalid rate for `%s` in SampleFilter - %s", pair[0], err)
+			}
+
+			conf.Rates[pair[0]] = rate
+		}
+	} else if _, ok := raw["rate_field"]; ok {
+		return SampleFilterConfig{}, fmt.Errorf("missing `rates` in SampleFilter, which is required with `rate_field`")
+	}
+
+	if s, ok := raw["rate"]; ok {
+		rate, err := parseSampleRate(s)
+		if err != nil {
+			return SampleFilterConfig{}, fmt.Errorf("invalid rate in SampleFilter - %s", err)
+		}
+
+		conf.Rate = rate
+	} else if conf.Rates == nil {
+		return SampleFilterConfig{}, fmt.Errorf("missing `rate` in SampleFilter")
+	}
+
+	return conf, nil
+}
+
+// SampleFilter is a Filter that keeps a fraction of messages, either randomly or deterministically on the value of a field.
+// Unlike the RateLimitFilter, this keeps a fair share of every source no matter when it logs
+type SampleFilter struct {
+	SampleFilterConfig
+}
+
+func NewSampleFilter(conf SampleFilterConfig) *SampleFilter {
+	return &SampleFilter{
+		SampleFilterConfig: conf,
+	}
+}
+
+// RateFor returns the sample rate that applies to the given message
+func (s *SampleFilter) RateFor(msg *clogger.Message) float64 {
+	if s.RateField != "" {
+		if value, ok := clogger.GetPath(msg.ParsedFields, s.RateField); ok {
+			if rate, ok := s.Rates[fmt.Sprint(value)]; ok {
+				return rate
+			}
+		}
+	}
+
+	return s.Rate
+}
+
+// hashFraction deterministically maps the given value to a number in [0, 1)
+func hashFraction(value interface{}) float64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(fmt.Sprint(value)))
+
+	// FNV's high bits are poorly distributed for short, similar keys (e.g. incrementing IDs),
+	// so mix them with the murmur3 finalizer first
+	h := hash.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	// Use the top 53 bits so that the result fits exactly in a float64's mantissa
+	return float64(h>>11) / (1 << 53)
+}
+
+func (s *SampleFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldDrop bool, err error) {
+	rate := s.RateFor(msg)
+
+	var fraction float64
+	if value, ok := clogger.GetPath(msg.ParsedFields, s.HashField); s.HashField != "" && ok {
+		fraction = hashFraction(value)
+	} else {
+		fraction = rand.Float64()
+	}
+
+	if fraction >= rate {
+		return true, nil
+	}
+
+	if s.SampleRateField != "" {
+		// If the message has already been sampled upstream, the overall rate is the product of the two
+		if previous, ok := clogger.GetPath(msg.ParsedFields, s.SampleRateField); ok {
+			if previousRate, err := coerceFloat(previous); err == nil {
+				rate *= previousRate.(float64)
+			}
+		}
+
+		fields := newFieldsWriter(msg.ParsedFields)
+		fields.Set(s.SampleRateField, rate)
+		msg.ParsedFields = fields.Fields()
+	}
+
+	return false, nil
+}
+
+func init() {
+	filtersRegistry.Register("sample", func(rawConf map[string]string) (interface{}, error) {
+		return NewSampleFilterConfigFromRaw(rawConf)
+	}, func(rawConf interface{}) (Filter, error) {
+		if conf, ok := rawConf.(SampleFilterConfig); ok {
+			return NewSampleFilter(conf), nil
+		} else {
+			return nil, fmt.Errorf("BUG: invalid type for Sample filter configuration (expected SampleFilterConfig)")
+		}
+	})
+}
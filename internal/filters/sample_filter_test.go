@@ -0,0 +1,166 @@
+package filters_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/filters"
+)
+
+func sampleMany(t *testing.T, filter filters.Filter, n int, fields func(i int) map[string]interface{}) (kept []clogger.Message) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		msg := clogger.NewMessage()
+		msg.ParsedFields = fields(i)
+
+		shouldDrop, err := filter.Filter(context.Background(), &msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !shouldDrop {
+			kept = append(kept, msg)
+		}
+	}
+
+	return kept
+}
+
+func TestSampleFilterRandom(t *testing.T) {
+	filter, err := filters.Construct("sample", map[string]string{"rate": "0.25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := sampleMany(t, filter, 10000, func(i int) map[string]interface{} {
+		return map[string]interface{}{}
+	})
+
+	if len(kept) < 2200 || len(kept) > 2800 {
+		t.Fatalf("expected around 2500 messages to be kept, got %d", len(kept))
+	}
+
+	if kept[0].ParsedFields[filters.DEFAULT_SAMPLE_RATE_FIELD] != 0.25 {
+		t.Fatalf("expected kept messages to be annotated with their sample rate, got %v", kept[0].ParsedFields)
+	}
+}
+
+func TestSampleFilterHashField(t *testing.T) {
+	filter, err := filters.Construct("sample", map[string]string{"rate": "0.5", "hash_field": "request.id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every request has 5 lines, which should be kept or dropped together
+	kept := sampleMany(t, filter, 5000, func(i int) map[string]interface{} {
+		return map[string]interface{}{"request": map[string]interface{}{"id": fmt.Sprintf("req-%d", i/5)}}
+	})
+
+	counts := map[interface{}]int{}
+	for _, msg := range kept {
+		counts[msg.ParsedFields["request"].(map[string]interface{})["id"]]++
+	}
+
+	for id, count := range counts {
+		if count != 5 {
+			t.Fatalf("expected all the lines of %s to be kept together, got %d", id, count)
+		}
+	}
+
+	if len(counts) < 400 || len(counts) > 600 {
+		t.Fatalf("expected around 500 requests to be kept, got %d", len(counts))
+	}
+}
+
+func TestSampleFilterPerKeyRates(t *testing.T) {
+	filter, err := filters.Construct("sample", map[string]string{
+		"rate_field":        "level",
+		"rates":             "error:1, debug:0",
+		"rate":              "0.5",
+		"sample_rate_field": "weight",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	levels := []string{"error", "debug", "info"}
+	kept := sampleMany(t, filter, 3000, func(i int) map[string]interface{} {
+		return map[string]interface{}{"level": levels[i%3]}
+	})
+
+	counts := map[interface{}]int{}
+	for _, msg := range kept {
+		counts[msg.ParsedFields["level"]]++
+		if msg.ParsedFields["level"] == "error" && msg.ParsedFields["weight"] != 1.0 {
+			t.Fatalf("expected errors to be annotated with a rate of 1, got %v", msg.ParsedFields["weight"])
+		}
+	}
+
+	if counts["error"] != 1000 || counts["debug"] != 0 || counts["info"] < 400 || counts["info"] > 600 {
+		t.Fatalf("got unexpected counts of kept messages: %v", counts)
+	}
+}
+
+func TestSampleFilterChained(t *testing.T) {
+	filter, err := filters.Construct("sample", map[string]string{"rate": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := clogger.NewMessage()
+	msg.ParsedFields[filters.DEFAULT_SAMPLE_RATE_FIELD] = 0.1
+	if shouldDrop, err := filter.Filter(context.Background(), &msg); err != nil || shouldDrop {
+		t.Fatalf("Filter failed: dropped=%v, err=%v", shouldDrop, err)
+	}
+
+	if msg.ParsedFields[filters.DEFAULT_SAMPLE_RATE_FIELD] != 0.1 {
+		t.Fatalf("expected the upstream sample rate to be kept, got %v", msg.ParsedFields[filters.DEFAULT_SAMPLE_RATE_FIELD])
+	}
+}
+
+func TestSampleFilterDoesntModifyOriginal(t *testing.T) {
+	filter, err := filters.Construct("sample", map[string]string{"rate": "1", "sample_rate_field": "sampling.rate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nested := map[string]interface{}{"source": "upstream"}
+	original := clogger.NewMessage()
+	original.ParsedFields["sampling"] = nested
+
+	// Messages in cloned batches share their fields
+	msg := original
+	if shouldDrop, err := filter.Filter(context.Background(), &msg); err != nil || shouldDrop {
+		t.Fatalf("Filter failed: dropped=%v, err=%v", shouldDrop, err)
+	}
+
+	if len(nested) != 1 || len(original.ParsedFields) != 1 {
+		t.Fatalf("sampling modified the original message: %v", original.ParsedFields)
+	}
+
+	if msg.ParsedFields["sampling"].(map[string]interface{})["rate"] != 1.0 {
+		t.Fatalf("expected the sample rate to be set, got %v", msg.ParsedFields)
+	}
+}
+
+func TestSampleFilterConfig(t *testing.T) {
+	invalid := []map[string]string{
+		{},
+		{"rate": "2"},
+		{"rate": "-0.1"},
+		{"rate": "lots"},
+		{"rates": "error:1"},
+		{"rate_field": "level"},
+		{"rate_field": "level", "rates": "error"},
+		{"rate_field": "level", "rates": "error:1.5"},
+	}
+
+	for _, conf := range invalid {
+		if _, err := filters.Construct("sample", conf); err == nil {
+			t.Errorf("Expected an error constructing a sample filter with %v", conf)
+		}
+	}
+}
@@ -22,6 +22,7 @@ type TengoFilter struct {
 func NewTengoFilterFromString(s []byte) (*TengoFilter, error) {
 	script := tengo.NewScript(s)
 	script.Add("message", nil)
+	script.Add("metadata", nil)
 
 	compiled, err := script.Compile()
 	if err != nil {
@@ -50,6 +51,16 @@ func (t *TengoFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldD
 		return t.failOpen, err
 	}
 
+	// Scripts get the metadata as its own map, so that they can route on (and add to) it without touching the message
+	metadata := make(map[string]interface{}, len(msg.Metadata))
+	for key, value := range msg.Metadata {
+		metadata[key] = value
+	}
+
+	if err := t.compiled.Set("metadata", metadata); err != nil {
+		return t.failOpen, err
+	}
+
 	_, exeSpan := tracing.GetTracer().Start(ctx, "TengoFilter.Filter")
 	if err := t.compiled.Run(); err != nil {
 		return t.failOpen, err
@@ -60,6 +71,15 @@ func (t *TengoFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldD
 		msg.ParsedFields = message
 	}
 
+	if metadata := t.compiled.Get("metadata").Map(); metadata != nil {
+		msg.Metadata = make(map[string]string, len(metadata))
+		for key, value := range metadata {
+			if value != nil {
+				msg.Metadata[key] = fmt.Sprint(value)
+			}
+		}
+	}
+
 	shouldDrop = !t.failOpen
 	if t.compiled.IsDefined("shouldDrop") {
 		shouldDrop = t.compiled.Get("shouldDrop").Bool()
@@ -0,0 +1,44 @@
+package filters_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/filters"
+)
+
+func TestTengoFilterMetadata(t *testing.T) {
+	filter, err := filters.NewTengoFilterFromString([]byte(`
+shouldDrop := metadata["input"] == "debug_in"
+message["peer"] = metadata["peer_addr"]
+metadata["route"] = "archive"
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+	msg.SetMetadata(clogger.METADATA_INPUT, "tcp_in")
+	msg.SetMetadata(clogger.METADATA_PEER_ADDR, "10.0.0.1:1234")
+
+	shouldDrop, err := filter.Filter(context.Background(), &msg)
+	if err != nil || shouldDrop {
+		t.Fatalf("Expected the message to pass, got dropped=%v, err=%v", shouldDrop, err)
+	}
+
+	if msg.ParsedFields["peer"] != "10.0.0.1:1234" {
+		t.Errorf("Expected the script to be able to read metadata, got %v", msg.ParsedFields)
+	}
+
+	if route, _ := msg.GetMetadata("route"); route != "archive" {
+		t.Errorf("Expected the script to be able to set metadata, got %v", msg.Metadata)
+	}
+
+	msg.SetMetadata(clogger.METADATA_INPUT, "debug_in")
+	if shouldDrop, _ := filter.Filter(context.Background(), &msg); !shouldDrop {
+		t.Error("Expected the script to drop messages based on their metadata")
+	}
+}
@@ -0,0 +1,240 @@
+package filters
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/strftime"
+)
+
+const DEFAULT_TIMESTAMP_FIELD = "timestamp"
+
+// TIMESTAMP_LAYOUT_SEPARATOR separates the layouts in the `layouts` config. It isn't a comma because plenty of
+// layouts contain one, e.g. `%a, %d %b %Y`
+const TIMESTAMP_LAYOUT_SEPARATOR = "|"
+
+// epochLayouts maps the names of numeric timestamp layouts to the duration of one unit
+var epochLayouts = map[string]time.Duration{
+	"unix":     time.Second,
+	"unixms":   time.Millisecond,
+	"unixus":   time.Microsecond,
+	"unixnano": time.Nanosecond,
+}
+
+// namedLayouts maps the names of common layouts to their Go layouts
+var namedLayouts = map[string]string{
+	"rfc3339":     time.RFC3339Nano,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc822":      time.RFC822,
+	"rfc822z":     time.RFC822Z,
+	"stamp":       time.StampMicro,
+	"ansic":       time.ANSIC,
+}
+
+// TimestampLayout is a single way of parsing a timestamp, either as a number of units since the epoch, or a Go layout
+type TimestampLayout struct {
+	epochUnit time.Duration
+	layout    string
+}
+
+func parseTimestampLayout(s string) (TimestampLayout, error) {
+	if unit, ok := epochLayouts[strings.ToLower(s)]; ok {
+		return TimestampLayout{epochUnit: unit}, nil
+	}
+
+	if layout, ok := namedLayouts[strings.ToLower(s)]; ok {
+		return TimestampLayout{layout: layout}, nil
+	}
+
+	if strings.ContainsRune(s, '%') {
+		layout, err := strftime.ToLayout(s)
+		if err != nil {
+			return TimestampLayout{}, err
+		}
+
+		return TimestampLayout{layout: layout}, nil
+	}
+
+	return TimestampLayout{layout: s}, nil
+}
+
+// parseEpoch parses the given value as a number of the given units since the unix epoch
+func parseEpoch(value interface{}, unit time.Duration) (time.Time, error) {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case float32:
+		f = float64(v)
+	case int:
+		return time.Unix(0, int64(v)*int64(unit)), nil
+	case int64:
+		return time.Unix(0, v*int64(unit)), nil
+	case uint64:
+		return time.Unix(0, int64(v)*int64(unit)), nil
+	case string:
+		// Try parsing as an int first so that we don't lose precision on nanosecond timestamps
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(0, i*int64(unit)), nil
+		}
+
+		var err error
+		f, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+	default:
+		return time.Time{}, fmt.Errorf("can't parse `%v` as an epoch timestamp", value)
+	}
+
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return time.Time{}, fmt.Errorf("can't parse `%v` as an epoch timestamp", value)
+	}
+
+	// Split off the whole units so that we don't lose precision on the fractional part
+	whole, frac := math.Modf(f)
+	return time.Unix(0, int64(whole)*int64(unit)+int64(math.Round(frac*float64(unit)))), nil
+}
+
+type TimestampFilterConfig struct {
+	// Field is the field to parse the event time out of
+	Field string
+
+	// Layouts are tried in order until one of them successfully parses the field. They're separated by
+	// TIMESTAMP_LAYOUT_SEPARATOR in the raw config
+	Layouts []TimestampLayout
+
+	// Location is the timezone used for layouts that don't include one
+	Location *time.Location
+
+	// RemoveField removes the field from the message once it's been successfully parsed
+	RemoveField bool
+}
+
+func NewTimestampFilterConfigFromRaw(raw map[string]string) (TimestampFilterConfig, error) {
+	conf := TimestampFilterConfig{
+		Field:    DEFAULT_TIMESTAMP_FIELD,
+		Location: time.UTC,
+	}
+
+	if field, ok := raw["field"]; ok {
+		conf.Field = field
+	}
+
+	layouts := "rfc3339"
+	if s, ok := raw["layouts"]; ok {
+		layouts = s
+	}
+
+	for _, s := range strings.Split(layouts, TIMESTAMP_LAYOUT_SEPARATOR) {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		layout, err := parseTimestampLayout(s)
+		if err != nil {
+			return TimestampFilterConfig{}, fmt.Errorf("invalid layout `%s` in TimestampFilter: %w", s, err)
+		}
+
+		conf.Layouts = append(conf.Layouts, layout)
+	}
+
+	if len(conf.Layouts) == 0 {
+		return TimestampFilterConfig{}, fmt.Errorf("missing `layouts` in TimestampFilter")
+	}
+
+	if tz, ok := raw["timezone"]; ok {
+		var err error
+		conf.Location, err = time.LoadLocation(tz)
+		if err != nil {
+			return TimestampFilterConfig{}, fmt.Errorf("invalid timezone `%s` in TimestampFilter: %w", tz, err)
+		}
+	}
+
+	if s, ok := raw["remove_field"]; ok {
+		var err error
+		conf.RemoveField, err = strconv.ParseBool(s)
+		if err != nil {
+			return TimestampFilterConfig{}, fmt.Errorf("invalid `remove_field` in TimestampFilter - expected true or false, got `%s`", s)
+		}
+	}
+
+	return conf, nil
+}
+
+// TimestampFilter is a Filter that sets the event time of messages from one of their fields
+// Messages without the field keep their existing event time
+type TimestampFilter struct {
+	TimestampFilterConfig
+}
+
+func NewTimestampFilter(conf TimestampFilterConfig) *TimestampFilter {
+	return &TimestampFilter{
+		TimestampFilterConfig: conf,
+	}
+}
+
+// Parse parses the given field value into a time, using the first layout that matches
+func (t *TimestampFilter) Parse(value interface{}) (time.Time, error) {
+	if ts, ok := value.(time.Time); ok {
+		return ts, nil
+	}
+
+	for _, layout := range t.Layouts {
+		if layout.epochUnit != 0 {
+			if ts, err := parseEpoch(value, layout.epochUnit); err == nil {
+				return ts, nil
+			}
+
+			continue
+		}
+
+		if s, ok := value.(string); ok {
+			if ts, err := time.ParseInLocation(layout.layout, s, t.Location); err == nil {
+				return ts, nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("`%v` doesn't match any of the configured layouts", value)
+}
+
+func (t *TimestampFilter) Filter(ctx context.Context, msg *clogger.Message) (shouldDrop bool, err error) {
+	value, ok := msg.ParsedFields[t.Field]
+	if !ok || value == nil {
+		return false, nil
+	}
+
+	ts, err := t.Parse(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse timestamp field `%s`: %w", t.Field, err)
+	}
+
+	msg.EventTime = ts
+	if t.RemoveField {
+		fields := newFieldsWriter(msg.ParsedFields)
+		fields.Delete(t.Field)
+		msg.ParsedFields = fields.Fields()
+	}
+
+	return false, nil
+}
+
+func init() {
+	filtersRegistry.Register("timestamp", func(rawConf map[string]string) (interface{}, error) {
+		return NewTimestampFilterConfigFromRaw(rawConf)
+	}, func(rawConf interface{}) (Filter, error) {
+		if conf, ok := rawConf.(TimestampFilterConfig); ok {
+			return NewTimestampFilter(conf), nil
+		} else {
+			return nil, fmt.Errorf("BUG: invalid type for Timestamp filter configuration (expected TimestampFilterConfig)")
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package filters_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/filters"
+)
+
+func TestTimestampFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     map[string]string
+		value    interface{}
+		expected time.Time
+	}{
+		{
+			name:     "rfc3339",
+			conf:     map[string]string{},
+			value:    "2021-06-01T12:00:00.5+02:00",
+			expected: time.Date(2021, 6, 1, 10, 0, 0, 500000000, time.UTC),
+		},
+		{
+			name:     "epoch seconds",
+			conf:     map[string]string{"layouts": "unix"},
+			value:    1622548800.25,
+			expected: time.Date(2021, 6, 1, 12, 0, 0, 250000000, time.UTC),
+		},
+		{
+			name:     "epoch millis string",
+			conf:     map[string]string{"layouts": "unixms"},
+			value:    "1622548800123",
+			expected: time.Date(2021, 6, 1, 12, 0, 0, 123000000, time.UTC),
+		},
+		{
+			name:     "epoch nanos",
+			conf:     map[string]string{"layouts": "unixnano"},
+			value:    int64(1622548800000000001),
+			expected: time.Date(2021, 6, 1, 12, 0, 0, 1, time.UTC),
+		},
+		{
+			name:     "fallback to strftime with timezone",
+			conf:     map[string]string{"layouts": "rfc3339 | %d/%m/%Y %H:%M:%S", "timezone": "Australia/Sydney"},
+			value:    "01/06/2021 22:00:00",
+			expected: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "strftime with milliseconds",
+			conf:     map[string]string{"layouts": "%Y-%m-%d %H:%M:%S.%L"},
+			value:    "2024-01-02 03:04:05.123",
+			expected: time.Date(2024, 1, 2, 3, 4, 5, 123000000, time.UTC),
+		},
+		{
+			name:     "strftime with microseconds after a comma",
+			conf:     map[string]string{"layouts": "%d/%m/%Y %H:%M:%S,%f"},
+			value:    "02/01/2024 03:04:05,123456",
+			expected: time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC),
+		},
+		{
+			name:     "layouts containing commas",
+			conf:     map[string]string{"layouts": "unix | %a, %d %b %Y %H:%M:%S"},
+			value:    "Tue, 02 Jan 2024 03:04:05",
+			expected: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.conf["field"] = "ts"
+			test.conf["remove_field"] = "true"
+			filter, err := filters.Construct("timestamp", test.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			original := clogger.NewMessage()
+			original.ParsedFields["ts"] = test.value
+
+			// Messages in cloned batches share their fields, so the original shouldn't be touched
+			msg := original
+			ingestTime := msg.IngestTime
+
+			if shouldDrop, err := filter.Filter(context.Background(), &msg); err != nil || shouldDrop {
+				t.Fatalf("Filter failed: dropped=%v, err=%v", shouldDrop, err)
+			}
+
+			if !msg.EventTime.Equal(test.expected) {
+				t.Errorf("Expected event time %s, got %s", test.expected, msg.EventTime)
+			}
+
+			if !msg.IngestTime.Equal(ingestTime) {
+				t.Errorf("Filter changed the ingest time")
+			}
+
+			if _, ok := msg.ParsedFields["ts"]; ok {
+				t.Errorf("Expected the timestamp field to be removed")
+			}
+
+			if _, ok := original.ParsedFields["ts"]; !ok {
+				t.Errorf("Removing the timestamp field modified the original message")
+			}
+		})
+	}
+}
+
+func TestTimestampFilterFailures(t *testing.T) {
+	filter, err := filters.Construct("timestamp", map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages without the field are left alone
+	msg := clogger.NewMessage()
+	eventTime := msg.EventTime
+	if _, err := filter.Filter(context.Background(), &msg); err != nil || !msg.EventTime.Equal(eventTime) {
+		t.Fatalf("Expected a message without the field to pass through untouched, got err=%v", err)
+	}
+
+	// Messages where the field doesn't parse keep their event time, and the field
+	msg.ParsedFields["timestamp"] = "yesterday"
+	shouldDrop, err := filter.Filter(context.Background(), &msg)
+	if err == nil || shouldDrop || !msg.EventTime.Equal(eventTime) || msg.ParsedFields["timestamp"] != "yesterday" {
+		t.Fatalf("Expected an unparseable timestamp to be reported and left alone, got dropped=%v, err=%v", shouldDrop, err)
+	}
+
+	if _, err := filters.Construct("timestamp", map[string]string{"timezone": "Not/AZone"}); err == nil {
+		t.Fatal("Expected an error with an invalid timezone")
+	}
+
+	if _, err := filters.Construct("timestamp", map[string]string{"layouts": "%s"}); err == nil {
+		t.Fatal("Expected an error with an unparseable strftime directive")
+	}
+}
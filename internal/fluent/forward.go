@@ -0,0 +1,361 @@
+// Package fluent implements the wire format of the Fluentd Forward protocol (v1), shared by the forward input and output
+// See https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1
+package fluent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// EVENT_TIME_EXT_ID is the msgpack extension type used for nanosecond precision timestamps
+const EVENT_TIME_EXT_ID = 0
+
+// EventTime is a timestamp encoded as the Forward protocol's EventTime extension type
+type EventTime struct {
+	time.Time
+}
+
+func (e *EventTime) MarshalMsgpack() ([]byte, error) {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data[:4], uint32(e.Unix()))
+	binary.BigEndian.PutUint32(data[4:], uint32(e.Nanosecond()))
+	return data, nil
+}
+
+func (e *EventTime) UnmarshalMsgpack(data []byte) error {
+	if len(data) != 8 {
+		return fmt.Errorf("invalid EventTime - expected 8 bytes, got %d", len(data))
+	}
+
+	e.Time = time.Unix(int64(binary.BigEndian.Uint32(data[:4])), int64(binary.BigEndian.Uint32(data[4:])))
+	return nil
+}
+
+func init() {
+	msgpack.RegisterExt(EVENT_TIME_EXT_ID, (*EventTime)(nil))
+}
+
+// Entry is a single event, as sent in any of the modes
+type Entry struct {
+	Time   time.Time
+	Record map[string]interface{}
+}
+
+// Options is the option map that can be attached to any message
+type Options struct {
+	// Size is the number of events in the message
+	Size int
+
+	// Chunk is the ID that the receiver has to ack the message with, if set
+	Chunk string
+
+	// Compressed is the compression that the entries of a CompressedPackedForward message are compressed with
+	Compressed string
+}
+
+// NewDecoder returns a msgpack decoder configured the way that the rest of this package expects
+func NewDecoder(r io.Reader) *msgpack.Decoder {
+	decoder := msgpack.NewDecoder(r)
+	decoder.UseLooseInterfaceDecoding(true)
+	return decoder
+}
+
+// ReadMessage reads a single message in any of the Message, Forward, PackedForward or CompressedPackedForward modes
+func ReadMessage(decoder *msgpack.Decoder) (string, []Entry, Options, error) {
+	length, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return "", nil, Options{}, err
+	}
+
+	if length < 2 || length > 4 {
+		return "", nil, Options{}, fmt.Errorf("invalid forward message - expected 2 to 4 elements, got %d", length)
+	}
+
+	tag, err := decoder.DecodeString()
+	if err != nil {
+		return "", nil, Options{}, err
+	}
+
+	code, err := decoder.PeekCode()
+	if err != nil {
+		return "", nil, Options{}, err
+	}
+
+	var entries []Entry
+	var remaining int
+	switch {
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		// Forward mode: [tag, [[time, record], ...], option]
+		entries, err = readEntryArray(decoder)
+		remaining = length - 2
+	case msgpcode.IsString(code) || msgpcode.IsBin(code):
+		// (Compressed)PackedForward mode: [tag, <concatenated msgpack entries>, option]
+		var packed []byte
+		packed, err = decoder.DecodeBytes()
+		if err != nil {
+			break
+		}
+
+		remaining = length - 2
+		var opts Options
+		if remaining > 0 {
+			opts, err = readOptions(decoder)
+			if err != nil {
+				return "", nil, Options{}, err
+			}
+
+			remaining -= 1
+		}
+
+		entries, err = readPackedEntries(packed, opts.Compressed)
+		if err != nil {
+			return "", nil, Options{}, err
+		}
+
+		return tag, entries, opts, skip(decoder, remaining)
+	default:
+		// Message mode: [tag, time, record, option]
+		if length < 3 {
+			return "", nil, Options{}, fmt.Errorf("invalid forward message - message mode requires a time and a record")
+		}
+
+		var entry Entry
+		entry, err = readEntryBody(decoder)
+		entries = []Entry{entry}
+		remaining = length - 3
+	}
+
+	if err != nil {
+		return "", nil, Options{}, err
+	}
+
+	var opts Options
+	if remaining > 0 {
+		opts, err = readOptions(decoder)
+		if err != nil {
+			return "", nil, Options{}, err
+		}
+
+		remaining -= 1
+	}
+
+	return tag, entries, opts, skip(decoder, remaining)
+}
+
+func skip(decoder *msgpack.Decoder, n int) error {
+	for i := 0; i < n; i++ {
+		if err := decoder.Skip(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readEntryArray reads an array of [time, record] entries
+func readEntryArray(decoder *msgpack.Decoder) ([]Entry, error) {
+	length, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, length)
+	for i := 0; i < length; i++ {
+		entry, err := readEntry(decoder)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// readPackedEntries reads the entries out of the concatenated stream of a PackedForward message
+func readPackedEntries(packed []byte, compression string) ([]Entry, error) {
+	var reader io.Reader = bytes.NewReader(packed)
+	switch compression {
+	case "", "text":
+	case "gzip":
+		// The stream may be made up of multiple gzip members, which gzip.Reader handles for us
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadAll(gzipReader)
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(data)
+	default:
+		return nil, fmt.Errorf("unsupported forward compression `%s`", compression)
+	}
+
+	decoder := NewDecoder(reader)
+	entries := []Entry{}
+	for {
+		entry, err := readEntry(decoder)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+// readEntry reads a single [time, record] entry
+func readEntry(decoder *msgpack.Decoder) (Entry, error) {
+	length, err := decoder.DecodeArrayLen()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if length != 2 {
+		return Entry{}, fmt.Errorf("invalid forward entry - expected 2 elements, got %d", length)
+	}
+
+	return readEntryBody(decoder)
+}
+
+// readEntryBody reads the time and the record of an entry
+func readEntryBody(decoder *msgpack.Decoder) (Entry, error) {
+	rawTime, err := decoder.DecodeInterfaceLoose()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	var t time.Time
+	switch v := rawTime.(type) {
+	case *EventTime:
+		t = v.Time
+	case int64:
+		t = time.Unix(v, 0)
+	case uint64:
+		t = time.Unix(int64(v), 0)
+	case float64:
+		t = time.Unix(0, int64(v*float64(time.Second)))
+	default:
+		return Entry{}, fmt.Errorf("invalid forward entry time `%v`", rawTime)
+	}
+
+	record, err := decoder.DecodeMap()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if record == nil {
+		record = map[string]interface{}{}
+	}
+
+	return Entry{
+		Time:   t,
+		Record: record,
+	}, nil
+}
+
+func readOptions(decoder *msgpack.Decoder) (Options, error) {
+	raw, err := decoder.DecodeMap()
+	if err != nil {
+		return Options{}, err
+	}
+
+	opts := Options{}
+	if chunk, ok := raw["chunk"].(string); ok {
+		opts.Chunk = chunk
+	}
+
+	if compressed, ok := raw["compressed"].(string); ok {
+		opts.Compressed = compressed
+	}
+
+	switch size := raw["size"].(type) {
+	case int64:
+		opts.Size = int(size)
+	case uint64:
+		opts.Size = int(size)
+	}
+
+	return opts, nil
+}
+
+// EncodeTime encodes the given time as an EventTime
+func EncodeTime(encoder *msgpack.Encoder, t time.Time) error {
+	data, err := (&EventTime{t}).MarshalMsgpack()
+	if err != nil {
+		return err
+	}
+
+	if err := encoder.EncodeExtHeader(EVENT_TIME_EXT_ID, len(data)); err != nil {
+		return err
+	}
+
+	_, err = encoder.Writer().Write(data)
+	return err
+}
+
+// EncodeEntry encodes a single [time, record] entry
+func EncodeEntry(encoder *msgpack.Encoder, entry Entry) error {
+	if err := encoder.EncodeArrayLen(2); err != nil {
+		return err
+	}
+
+	if err := EncodeTime(encoder, entry.Time); err != nil {
+		return err
+	}
+
+	return encoder.EncodeMap(entry.Record)
+}
+
+// EncodeOptions encodes the given options as an option map, skipping unset options
+func EncodeOptions(encoder *msgpack.Encoder, opts Options) error {
+	raw := map[string]interface{}{}
+	if opts.Size > 0 {
+		raw["size"] = opts.Size
+	}
+
+	if opts.Chunk != "" {
+		raw["chunk"] = opts.Chunk
+	}
+
+	if opts.Compressed != "" {
+		raw["compressed"] = opts.Compressed
+	}
+
+	return encoder.EncodeMap(raw)
+}
+
+// EncodeAck encodes the response to a message that was sent with a chunk option
+func EncodeAck(encoder *msgpack.Encoder, chunk string) error {
+	return encoder.EncodeMap(map[string]interface{}{
+		"ack": chunk,
+	})
+}
+
+// ReadAck reads the response to a message that was sent with a chunk option, returning the acked chunk ID
+func ReadAck(decoder *msgpack.Decoder) (string, error) {
+	raw, err := decoder.DecodeMap()
+	if err != nil {
+		return "", err
+	}
+
+	ack, ok := raw["ack"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid forward ack - missing `ack`")
+	}
+
+	return ack, nil
+}
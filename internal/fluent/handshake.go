@@ -0,0 +1,158 @@
+package fluent
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// HandshakeConfig is the shared key authentication config for one side of a connection
+type HandshakeConfig struct {
+	SharedKey string
+
+	// Hostname is the hostname that this side identifies itself as
+	Hostname string
+}
+
+// digest computes the hex encoded SHA512 digest that proves knowledge of the shared key
+func (h *HandshakeConfig) digest(salt []byte, hostname string, nonce []byte) string {
+	hash := sha512.New()
+	hash.Write(salt)
+	hash.Write([]byte(hostname))
+	hash.Write(nonce)
+	hash.Write([]byte(h.SharedKey))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func randomBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// ServerHandshake performs the server side of the shared key handshake: sending a HELO, validating the client's PING,
+// and responding with a PONG. User authentication isn't supported, so the HELO doesn't request it
+func (h *HandshakeConfig) ServerHandshake(decoder *msgpack.Decoder, encoder *msgpack.Encoder) error {
+	nonce, err := randomBytes(16)
+	if err != nil {
+		return err
+	}
+
+	// ["HELO", {"nonce": nonce, "auth": salt, "keepalive": true}]
+	if err := encodeArray(encoder, "HELO", map[string]interface{}{
+		"nonce":     nonce,
+		"auth":      []byte{},
+		"keepalive": true,
+	}); err != nil {
+		return err
+	}
+
+	// ["PING", hostname, shared_key_salt, digest, username, password]
+	ping, err := decoder.DecodeSlice()
+	if err != nil {
+		return err
+	}
+
+	if len(ping) != 6 || ping[0] != "PING" {
+		return fmt.Errorf("invalid PING in forward handshake")
+	}
+
+	clientHostname, _ := ping[1].(string)
+	salt, _ := ping[2].(string)
+	clientDigest, _ := ping[3].(string)
+
+	authenticated := subtle.ConstantTimeCompare([]byte(clientDigest), []byte(h.digest([]byte(salt), clientHostname, nonce))) == 1
+	reason := ""
+	if !authenticated {
+		reason = "shared_key mismatch"
+	}
+
+	// ["PONG", auth_result, reason, hostname, digest]
+	if err := encodeArray(encoder, "PONG", authenticated, reason, h.Hostname, h.digest([]byte(salt), h.Hostname, nonce)); err != nil {
+		return err
+	}
+
+	if !authenticated {
+		return fmt.Errorf("forward handshake failed for `%s`: %s", clientHostname, reason)
+	}
+
+	return nil
+}
+
+// ClientHandshake performs the client side of the shared key handshake: receiving a HELO, sending a PING,
+// and validating the server's PONG
+func (h *HandshakeConfig) ClientHandshake(decoder *msgpack.Decoder, encoder *msgpack.Encoder) error {
+	helo, err := decoder.DecodeSlice()
+	if err != nil {
+		return err
+	}
+
+	if len(helo) != 2 || helo[0] != "HELO" {
+		return fmt.Errorf("invalid HELO in forward handshake")
+	}
+
+	options, _ := helo[1].(map[string]interface{})
+	nonce := toBytes(options["nonce"])
+	if auth := toBytes(options["auth"]); len(auth) > 0 {
+		return fmt.Errorf("forward server requested user authentication, which isn't supported")
+	}
+
+	salt, err := randomBytes(16)
+	if err != nil {
+		return err
+	}
+
+	saltString := hex.EncodeToString(salt)
+	if err := encodeArray(encoder, "PING", h.Hostname, saltString, h.digest([]byte(saltString), h.Hostname, nonce), "", ""); err != nil {
+		return err
+	}
+
+	pong, err := decoder.DecodeSlice()
+	if err != nil {
+		return err
+	}
+
+	if len(pong) != 5 || pong[0] != "PONG" {
+		return fmt.Errorf("invalid PONG in forward handshake")
+	}
+
+	if authenticated, _ := pong[1].(bool); !authenticated {
+		return fmt.Errorf("forward handshake rejected: %v", pong[2])
+	}
+
+	serverHostname, _ := pong[3].(string)
+	serverDigest, _ := pong[4].(string)
+	if subtle.ConstantTimeCompare([]byte(serverDigest), []byte(h.digest([]byte(saltString), serverHostname, nonce))) != 1 {
+		return fmt.Errorf("forward handshake failed: server `%s` doesn't know the shared key", serverHostname)
+	}
+
+	return nil
+}
+
+// encodeArray encodes the given values as a single msgpack array
+func encodeArray(encoder *msgpack.Encoder, values ...interface{}) error {
+	if err := encoder.EncodeArrayLen(len(values)); err != nil {
+		return err
+	}
+
+	return encoder.EncodeMulti(values...)
+}
+
+// toBytes converts the given value to bytes. Depending on the implementation, binary fields may be sent as bin or str
+func toBytes(v interface{}) []byte {
+	switch value := v.(type) {
+	case []byte:
+		return value
+	case string:
+		return []byte(value)
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package forwarding
+
+import (
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+// EncodeBatch encodes the given messages into the payload of a BATCH frame, using clogger's binary encoding
+func EncodeBatch(messages []clogger.Message) ([]byte, error) {
+	return clogger.MarshalBatch(messages), nil
+}
+
+// DecodeBatch decodes the payload of a BATCH frame back into messages
+func DecodeBatch(data []byte) ([]clogger.Message, error) {
+	return clogger.UnmarshalBatch(data)
+}
@@ -0,0 +1,205 @@
+// Package forwarding implements the native protocol that clogger instances use to forward batches to each other
+//
+// A connection starts with the sender writing a preamble (PREAMBLE_MAGIC followed by the protocol version), after which
+// both sides exchange frames. Each frame is a fixed size header (the frame type, the compression, the batch ID, and the
+// length of the payload) followed by the payload. Senders send BATCH frames, and receivers respond with an ACK frame
+// carrying the same batch ID once the batch has been handed off to their pipeline, or a NACK (with the reason as the
+// payload) if the batch is invalid and should not be retried. Senders resend batches that aren't acked (e.g. because
+// the connection dropped), so delivery is at least once
+package forwarding
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// PREAMBLE_MAGIC is sent at the start of every connection, followed by PROTOCOL_VERSION
+var PREAMBLE_MAGIC = []byte("CLOG")
+
+const PROTOCOL_VERSION = 1
+
+// MAX_PAYLOAD_SIZE is the largest payload that we'll accept in a frame
+const MAX_PAYLOAD_SIZE = 64 * 1024 * 1024
+
+// frameHeaderSize is the size of a frame header: 1 byte type, 1 byte compression, 8 bytes batch ID, 4 bytes payload length
+const frameHeaderSize = 14
+
+type FrameType uint8
+
+const (
+	FRAME_BATCH FrameType = iota + 1
+	FRAME_ACK
+	FRAME_NACK
+)
+
+func (f FrameType) ToString() string {
+	switch f {
+	case FRAME_BATCH:
+		return "batch"
+	case FRAME_ACK:
+		return "ack"
+	case FRAME_NACK:
+		return "nack"
+	}
+
+	return fmt.Sprintf("unknown(%d)", uint8(f))
+}
+
+type Compression uint8
+
+const (
+	COMPRESSION_NONE Compression = iota
+	COMPRESSION_SNAPPY
+	COMPRESSION_ZSTD
+)
+
+// ParseCompression parses the name of a Compression
+func ParseCompression(s string) (Compression, error) {
+	switch s {
+	case "none":
+		return COMPRESSION_NONE, nil
+	case "snappy":
+		return COMPRESSION_SNAPPY, nil
+	case "zstd":
+		return COMPRESSION_ZSTD, nil
+	}
+
+	return COMPRESSION_NONE, fmt.Errorf("invalid compression `%s` - expected none, snappy, or zstd", s)
+}
+
+// Frame is a single unit of the protocol
+type Frame struct {
+	Type        FrameType
+	Compression Compression
+	BatchID     uint64
+
+	// Payload is the uncompressed payload of the frame
+	Payload []byte
+}
+
+// WritePreamble writes the preamble that starts every connection
+func WritePreamble(w io.Writer) error {
+	_, err := w.Write(append(append([]byte(nil), PREAMBLE_MAGIC...), PROTOCOL_VERSION))
+	return err
+}
+
+// ReadPreamble reads and validates the preamble that starts every connection
+func ReadPreamble(r io.Reader) error {
+	preamble := make([]byte, len(PREAMBLE_MAGIC)+1)
+	if _, err := io.ReadFull(r, preamble); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(preamble[:len(PREAMBLE_MAGIC)], PREAMBLE_MAGIC) {
+		return fmt.Errorf("invalid preamble - not a clogger connection")
+	}
+
+	if version := preamble[len(PREAMBLE_MAGIC)]; version != PROTOCOL_VERSION {
+		return fmt.Errorf("unsupported protocol version %d - expected %d", version, PROTOCOL_VERSION)
+	}
+
+	return nil
+}
+
+// WriteFrame compresses and writes the given frame
+func WriteFrame(w io.Writer, frame Frame) error {
+	payload, err := compress(frame.Compression, frame.Payload)
+	if err != nil {
+		return err
+	}
+
+	if len(payload) > MAX_PAYLOAD_SIZE {
+		return fmt.Errorf("payload of %d bytes is larger than the maximum of %d", len(payload), MAX_PAYLOAD_SIZE)
+	}
+
+	data := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	data[0] = byte(frame.Type)
+	data[1] = byte(frame.Compression)
+	binary.BigEndian.PutUint64(data[2:10], frame.BatchID)
+	binary.BigEndian.PutUint32(data[10:14], uint32(len(payload)))
+	data = append(data, payload...)
+
+	_, err = w.Write(data)
+	return err
+}
+
+// ReadFrame reads and decompresses a single frame
+func ReadFrame(r io.Reader) (Frame, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Frame{}, err
+	}
+
+	frame := Frame{
+		Type:        FrameType(header[0]),
+		Compression: Compression(header[1]),
+		BatchID:     binary.BigEndian.Uint64(header[2:10]),
+	}
+
+	length := binary.BigEndian.Uint32(header[10:14])
+	if length > MAX_PAYLOAD_SIZE {
+		return Frame{}, fmt.Errorf("payload of %d bytes is larger than the maximum of %d", length, MAX_PAYLOAD_SIZE)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Frame{}, err
+	}
+
+	var err error
+	frame.Payload, err = decompress(frame.Compression, payload)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	return frame, nil
+}
+
+func compress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case COMPRESSION_NONE:
+		return data, nil
+	case COMPRESSION_SNAPPY:
+		return snappy.Encode(nil, data), nil
+	case COMPRESSION_ZSTD:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		defer encoder.Close()
+		return encoder.EncodeAll(data, nil), nil
+	}
+
+	return nil, fmt.Errorf("unknown compression %d", compression)
+}
+
+func decompress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case COMPRESSION_NONE:
+		return data, nil
+	case COMPRESSION_SNAPPY:
+		if length, err := snappy.DecodedLen(data); err != nil {
+			return nil, err
+		} else if length > MAX_PAYLOAD_SIZE {
+			return nil, fmt.Errorf("decompressed payload of %d bytes is larger than the maximum of %d", length, MAX_PAYLOAD_SIZE)
+		}
+
+		return snappy.Decode(nil, data)
+	case COMPRESSION_ZSTD:
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MAX_PAYLOAD_SIZE))
+		if err != nil {
+			return nil, err
+		}
+
+		defer decoder.Close()
+		return decoder.DecodeAll(data, nil)
+	}
+
+	return nil, fmt.Errorf("unknown compression %d", compression)
+}
@@ -0,0 +1,222 @@
+package inputs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/forwarding"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const DEFAULT_CLOGGER_LISTEN_ADDR = "localhost:4280"
+
+type CloggerInputConfig struct {
+	RecvConfig
+	ListenAddr string
+	TLS        *clogger.TLSConfig
+}
+
+func newCloggerInputConfigFromRaw(rawConf map[string]string) (CloggerInputConfig, error) {
+	tls, err := clogger.NewTLSConfigFromRaw(rawConf)
+	if err != nil {
+		return CloggerInputConfig{}, err
+	}
+
+	conf := CloggerInputConfig{
+		RecvConfig: NewRecvConfig(),
+		ListenAddr: DEFAULT_CLOGGER_LISTEN_ADDR,
+		TLS:        &tls,
+	}
+
+	if addr, ok := rawConf["listen"]; ok {
+		conf.ListenAddr = addr
+	}
+
+	return conf, nil
+}
+
+// CloggerInput is an Inputter that receives batches from other clogger instances over the native forwarding protocol,
+// acking each batch once all of its messages have been handed off to the pipeline
+type CloggerInput struct {
+	conf         CloggerInputConfig
+	internalChan chan clogger.Message
+	listener     net.Listener
+	wg           sync.WaitGroup
+
+	// Senders hold their connections open, so we track them in order to close them when we shut down
+	connsLock sync.Mutex
+	conns     map[net.Conn]struct{}
+
+	// closing is closed when we start shutting down, to unblock any handlers waiting on the pipeline
+	closing chan struct{}
+}
+
+func NewCloggerInput(conf CloggerInputConfig) *CloggerInput {
+	return &CloggerInput{
+		conf:         conf,
+		internalChan: make(chan clogger.Message, 10),
+		wg:           sync.WaitGroup{},
+		conns:        make(map[net.Conn]struct{}),
+		closing:      make(chan struct{}),
+	}
+}
+
+func (c *CloggerInput) handleConn(ctx context.Context, conn net.Conn) {
+	ctx, span := tracing.GetTracer().Start(ctx, "CloggerInput.handleConn")
+	defer span.End()
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	if err := forwarding.ReadPreamble(reader); err != nil {
+		span.RecordError(err)
+		log.Warn().Err(err).Str("remote_addr", conn.RemoteAddr().String()).Msg("Rejecting connection")
+		return
+	}
+
+	for {
+		frame, err := forwarding.ReadFrame(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				span.RecordError(err)
+				log.Debug().Err(err).Msg("Failed to read frame")
+			}
+
+			return
+		}
+
+		if frame.Type != forwarding.FRAME_BATCH {
+			log.Warn().Str("type", frame.Type.ToString()).Msg("Got unexpected frame from sender")
+			return
+		}
+
+		reply := forwarding.Frame{
+			Type:    forwarding.FRAME_ACK,
+			BatchID: frame.BatchID,
+		}
+
+		messages, err := forwarding.DecodeBatch(frame.Payload)
+		if err != nil {
+			// Retrying an invalid batch won't make it valid, so tell the sender not to bother
+			reply.Type = forwarding.FRAME_NACK
+			reply.Payload = []byte(err.Error())
+		}
+
+		for _, msg := range messages {
+			// Messages keep whatever metadata they were sent with (e.g. the node they came from), with the
+			// details of this hop on top
+			msg.SetMetadata(clogger.METADATA_INPUT_TYPE, "clogger")
+			msg.SetMetadata(clogger.METADATA_PEER_ADDR, conn.RemoteAddr().String())
+
+			select {
+			case <-ctx.Done():
+				// We're shutting down without acking, so the sender will resend this batch
+				return
+			case <-c.closing:
+				return
+			case c.internalChan <- msg:
+			}
+		}
+
+		if err := forwarding.WriteFrame(conn, reply); err != nil {
+			span.RecordError(err)
+			return
+		}
+	}
+}
+
+func (c *CloggerInput) Init(ctx context.Context) error {
+	listener, err := net.Listen("tcp", c.conf.ListenAddr)
+	if err != nil {
+		return err
+	}
+
+	c.listener = c.conf.TLS.WrapListener(listener)
+
+	go func() {
+		for {
+			conn, err := c.listener.Accept()
+			if err != nil {
+				break
+			}
+
+			c.connsLock.Lock()
+			c.conns[conn] = struct{}{}
+			c.connsLock.Unlock()
+
+			c.wg.Add(1)
+			go func() {
+				defer c.wg.Done()
+				c.handleConn(ctx, conn)
+
+				c.connsLock.Lock()
+				delete(c.conns, conn)
+				c.connsLock.Unlock()
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address that the input is listening on
+func (c *CloggerInput) Addr() net.Addr {
+	return c.listener.Addr()
+}
+
+func (c *CloggerInput) Close(ctx context.Context) error {
+	c.listener.Close()
+	close(c.closing)
+
+	// Any batches that were read from these connections but not yet acked will be resent by the senders
+	c.connsLock.Lock()
+	for conn := range c.conns {
+		conn.Close()
+	}
+	c.connsLock.Unlock()
+
+	c.wg.Wait()
+	close(c.internalChan)
+
+	return nil
+}
+
+func (c *CloggerInput) GetBatch(ctx context.Context) (*clogger.MessageBatch, error) {
+	_, span := tracing.GetTracer().Start(ctx, "CloggerInput.GetBatch")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("listen_addr", c.conf.ListenAddr))
+
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	case msg := <-c.internalChan:
+		numMessages := len(c.internalChan) + 1
+		batch := clogger.GetMessageBatch(numMessages)
+		batch.Messages = append(batch.Messages, msg)
+		for i := 0; i < numMessages-1; i++ {
+			batch.Messages = append(batch.Messages, <-c.internalChan)
+		}
+
+		return batch, nil
+	}
+}
+
+func init() {
+	inputsRegistry.Register("clogger", func(rawConf map[string]string) (interface{}, error) {
+		return newCloggerInputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Inputter, error) {
+		if c, ok := conf.(CloggerInputConfig); ok {
+			return NewCloggerInput(c), nil
+		}
+
+		return nil, fmt.Errorf("invalid config passed to clogger input")
+	})
+}
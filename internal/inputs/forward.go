@@ -0,0 +1,284 @@
+package inputs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/fluent"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const DEFAULT_FORWARD_LISTEN_ADDR = "localhost:24224"
+
+// DEFAULT_FORWARD_MESSAGE_KEY is the record key that Fluentd and Fluent Bit put log lines in
+const DEFAULT_FORWARD_MESSAGE_KEY = "log"
+const DEFAULT_FORWARD_TAG_FIELD = "tag"
+
+type ForwardInputConfig struct {
+	RecvConfig
+	ListenAddr string
+	TLS        *clogger.TLSConfig
+
+	// Handshake is the shared key config, or nil if clients don't need to authenticate
+	Handshake *fluent.HandshakeConfig
+
+	// MessageKey is the record key that gets mapped to the message field
+	MessageKey string
+
+	// TagField is the field that the tag of each event gets put in
+	TagField string
+}
+
+func newForwardInputConfigFromRaw(rawConf map[string]string) (ForwardInputConfig, error) {
+	tls, err := clogger.NewTLSConfigFromRaw(rawConf)
+	if err != nil {
+		return ForwardInputConfig{}, err
+	}
+
+	conf := ForwardInputConfig{
+		RecvConfig: NewRecvConfig(),
+		ListenAddr: DEFAULT_FORWARD_LISTEN_ADDR,
+		TLS:        &tls,
+		MessageKey: DEFAULT_FORWARD_MESSAGE_KEY,
+		TagField:   DEFAULT_FORWARD_TAG_FIELD,
+	}
+
+	if addr, ok := rawConf["listen"]; ok {
+		conf.ListenAddr = addr
+	}
+
+	if key, ok := rawConf["message_key"]; ok {
+		conf.MessageKey = key
+	}
+
+	if field, ok := rawConf["tag_field"]; ok {
+		conf.TagField = field
+	}
+
+	conf.Handshake, err = NewForwardHandshakeConfigFromRaw(rawConf)
+	if err != nil {
+		return ForwardInputConfig{}, err
+	}
+
+	return conf, nil
+}
+
+// NewForwardHandshakeConfigFromRaw parses the `shared_key` and `self_hostname` from the given config,
+// returning nil if no shared key is configured
+func NewForwardHandshakeConfigFromRaw(rawConf map[string]string) (*fluent.HandshakeConfig, error) {
+	sharedKey, ok := rawConf["shared_key"]
+	if !ok {
+		return nil, nil
+	}
+
+	hostname, ok := rawConf["self_hostname"]
+	if !ok {
+		var err error
+		hostname, err = os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &fluent.HandshakeConfig{
+		SharedKey: sharedKey,
+		Hostname:  hostname,
+	}, nil
+}
+
+// ForwardInput is an Inputter that accepts events over the Fluentd Forward protocol, acking chunks
+// once they have been handed off to the pipeline
+type ForwardInput struct {
+	conf         ForwardInputConfig
+	internalChan chan clogger.Message
+	listener     net.Listener
+	wg           sync.WaitGroup
+
+	// Forward clients hold their connections open, so we track them in order to close them when we shut down
+	connsLock sync.Mutex
+	conns     map[net.Conn]struct{}
+
+	// closing is closed when we start shutting down, to unblock any handlers waiting on the pipeline
+	closing chan struct{}
+}
+
+func NewForwardInput(conf ForwardInputConfig) *ForwardInput {
+	return &ForwardInput{
+		conf:         conf,
+		internalChan: make(chan clogger.Message, 10),
+		wg:           sync.WaitGroup{},
+		conns:        make(map[net.Conn]struct{}),
+		closing:      make(chan struct{}),
+	}
+}
+
+func (f *ForwardInput) handleConn(ctx context.Context, conn net.Conn) {
+	ctx, span := tracing.GetTracer().Start(ctx, "ForwardInput.handleConn")
+	defer span.End()
+	defer conn.Close()
+
+	decoder := fluent.NewDecoder(bufio.NewReader(conn))
+	encoder := msgpack.NewEncoder(conn)
+
+	ctx = clogger.ContextWithMetadata(ctx, map[string]string{
+		clogger.METADATA_INPUT_TYPE: "forward",
+		clogger.METADATA_PEER_ADDR:  conn.RemoteAddr().String(),
+	})
+
+	if f.conf.Handshake != nil {
+		if err := f.conf.Handshake.ServerHandshake(decoder, encoder); err != nil {
+			span.RecordError(err)
+			log.Warn().Err(err).Str("remote_addr", conn.RemoteAddr().String()).Msg("Forward handshake failed")
+			return
+		}
+	}
+
+	for {
+		tag, entries, opts, err := fluent.ReadMessage(decoder)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				span.RecordError(err)
+				log.Debug().Err(err).Msg("Failed to parse incoming forward message")
+			}
+
+			return
+		}
+
+		for _, entry := range entries {
+			select {
+			case <-ctx.Done():
+				return
+			case <-f.closing:
+				return
+			case f.internalChan <- f.toMessage(ctx, tag, entry):
+			}
+		}
+
+		if opts.Chunk != "" {
+			if err := fluent.EncodeAck(encoder, opts.Chunk); err != nil {
+				span.RecordError(err)
+				return
+			}
+		}
+	}
+}
+
+// toMessage converts the given event into a Message, tagged with the metadata of the connection it came from
+func (f *ForwardInput) toMessage(ctx context.Context, tag string, entry fluent.Entry) clogger.Message {
+	message := clogger.NewMessage()
+	message.EventTime = entry.Time
+	message.AddMetadataFromContext(ctx)
+	message.SetMetadata(clogger.METADATA_TAG, tag)
+	for key, value := range entry.Record {
+		if key == f.conf.MessageKey {
+			key = clogger.MESSAGE_FIELD
+		}
+
+		message.ParsedFields[key] = value
+	}
+
+	if f.conf.TagField != "" {
+		message.ParsedFields[f.conf.TagField] = tag
+	}
+
+	return message
+}
+
+func (f *ForwardInput) Init(ctx context.Context) error {
+	listener, err := net.Listen("tcp", f.conf.ListenAddr)
+	if err != nil {
+		return err
+	}
+
+	f.listener = f.conf.TLS.WrapListener(listener)
+
+	go func() {
+		for {
+			conn, err := f.listener.Accept()
+			if err != nil {
+				break
+			}
+
+			f.connsLock.Lock()
+			f.conns[conn] = struct{}{}
+			f.connsLock.Unlock()
+
+			f.wg.Add(1)
+			go func() {
+				defer f.wg.Done()
+				f.handleConn(ctx, conn)
+
+				f.connsLock.Lock()
+				delete(f.conns, conn)
+				f.connsLock.Unlock()
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address that the input is listening on
+func (f *ForwardInput) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+func (f *ForwardInput) Close(ctx context.Context) error {
+	f.listener.Close()
+	close(f.closing)
+
+	// Any events that were read from these connections but not yet acked will be resent by the clients
+	f.connsLock.Lock()
+	for conn := range f.conns {
+		conn.Close()
+	}
+	f.connsLock.Unlock()
+
+	f.wg.Wait()
+	close(f.internalChan)
+
+	return nil
+}
+
+func (f *ForwardInput) GetBatch(ctx context.Context) (*clogger.MessageBatch, error) {
+	_, span := tracing.GetTracer().Start(ctx, "ForwardInput.GetBatch")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("listen_addr", f.conf.ListenAddr))
+
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	case msg := <-f.internalChan:
+		numMessages := len(f.internalChan) + 1
+		batch := clogger.GetMessageBatch(numMessages)
+		batch.Messages = append(batch.Messages, msg)
+		for i := 0; i < numMessages-1; i++ {
+			batch.Messages = append(batch.Messages, <-f.internalChan)
+		}
+
+		return batch, nil
+	}
+}
+
+func init() {
+	inputsRegistry.Register("forward", func(rawConf map[string]string) (interface{}, error) {
+		return newForwardInputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Inputter, error) {
+		if c, ok := conf.(ForwardInputConfig); ok {
+			return NewForwardInput(c), nil
+		}
+
+		return nil, fmt.Errorf("invalid config passed to forward input")
+	})
+}
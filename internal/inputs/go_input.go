@@ -2,7 +2,6 @@ package inputs
 
 import (
 	"context"
-	"time"
 
 	"github.com/sinkingpoint/clogger/internal/clogger"
 	"github.com/sinkingpoint/clogger/internal/tracing"
@@ -31,6 +30,12 @@ func (s *GoInput) Enqueue(msg string) {
 	s.c <- msg
 }
 
+func newGoMessage(msg string) clogger.Message {
+	message := clogger.NewMessage()
+	message.ParsedFields[clogger.MESSAGE_FIELD] = msg
+	return message
+}
+
 func (g *GoInput) GetBatch(ctx context.Context) (*clogger.MessageBatch, error) {
 	_, span := tracing.GetTracer().Start(ctx, "GoInput.Run")
 	defer span.End()
@@ -41,20 +46,10 @@ func (g *GoInput) GetBatch(ctx context.Context) (*clogger.MessageBatch, error) {
 	case msg := <-g.c:
 		numMessages := len(g.c)
 		batch := clogger.GetMessageBatch(numMessages + 1)
-		batch.Messages = append(batch.Messages, clogger.Message{
-			MonoTimestamp: time.Now().UnixNano(),
-			ParsedFields: map[string]interface{}{
-				clogger.MESSAGE_FIELD: msg,
-			},
-		})
+		batch.Messages = append(batch.Messages, newGoMessage(msg))
 
 		for i := 0; i < numMessages; i++ {
-			batch.Messages = append(batch.Messages, clogger.Message{
-				MonoTimestamp: time.Now().UnixNano(),
-				ParsedFields: map[string]interface{}{
-					clogger.MESSAGE_FIELD: msg,
-				},
-			})
+			batch.Messages = append(batch.Messages, newGoMessage(msg))
 		}
 
 		return batch, nil
@@ -3,6 +3,7 @@ package inputs
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/coreos/go-systemd/v22/sdjournal"
 	"github.com/sinkingpoint/clogger/internal/clogger"
@@ -86,10 +87,13 @@ func (c *coreOSJournalDReader) GetEntry(ctx context.Context) (clogger.Message, e
 		m2[k] = v
 	}
 
-	return clogger.Message{
-		MonoTimestamp: int64(entry.MonotonicTimestamp * 1000),
-		ParsedFields:  m2,
-	}, nil
+	message := clogger.NewMessage()
+	message.EventTime = time.Unix(0, int64(entry.RealtimeTimestamp)*int64(time.Microsecond))
+	message.ParsedFields = m2
+	message.SetMetadata(clogger.METADATA_INPUT_TYPE, "journald")
+	message.SetMetadata(clogger.METADATA_JOURNALD_CURSOR, entry.Cursor)
+
+	return message, nil
 }
 
 // JournalDInput is an Input that reads off of the JournalD stream
@@ -3,6 +3,7 @@ package inputs_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/sinkingpoint/clogger/internal/clogger"
@@ -17,7 +18,7 @@ func TestJournalDInput(t *testing.T) {
 	mockJournalD := mock_inputs.NewMockJournalDReader(ctrl)
 	mockJournalD.EXPECT().GetEntry(context.Background()).DoAndReturn(func(ctx context.Context) (clogger.Message, error) {
 		return clogger.Message{
-			MonoTimestamp: 10,
+			EventTime: time.Unix(10, 0),
 		}, nil
 	}).MinTimes(2)
 
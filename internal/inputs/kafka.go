@@ -0,0 +1,357 @@
+package inputs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const DEFAULT_KAFKA_BROKERS = "localhost:9092"
+const DEFAULT_KAFKA_VERSION = "2.1.0"
+const DEFAULT_KAFKA_GROUP_ID = "clogger"
+
+// The metadata keys that messages from the Kafka input get the position of the record they were parsed from under
+const (
+	KAFKA_TOPIC_METADATA     = "kafka_topic"
+	KAFKA_PARTITION_METADATA = "kafka_partition"
+	KAFKA_OFFSET_METADATA    = "kafka_offset"
+)
+
+// NewKafkaSaramaConfigFromRaw constructs the base sarama config shared by the Kafka input and output
+// from the given raw config
+func NewKafkaSaramaConfigFromRaw(rawConf map[string]string) (*sarama.Config, error) {
+	saramaConf := sarama.NewConfig()
+	saramaConf.ClientID = "clogger"
+
+	version := DEFAULT_KAFKA_VERSION
+	if v, ok := rawConf["version"]; ok {
+		version = v
+	}
+
+	var err error
+	saramaConf.Version, err = sarama.ParseKafkaVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	tls, err := clogger.NewTLSConfigFromRaw(rawConf)
+	if err != nil {
+		return nil, err
+	}
+
+	useTLS := tls.IsEnabled()
+	if t, ok := rawConf["tls"]; ok {
+		useTLS, err = strconv.ParseBool(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool `%s` for `tls` in Kafka config - expected true or false", t)
+		}
+	}
+
+	if useTLS {
+		saramaConf.Net.TLS.Enable = true
+		saramaConf.Net.TLS.Config = tls.ClientConfig()
+	}
+
+	return saramaConf, nil
+}
+
+type KafkaInputConfig struct {
+	RecvConfig
+	Brokers []string
+	Topics  []string
+	GroupID string
+	Parser  parse.InputParser
+	Sarama  *sarama.Config
+}
+
+// NewKafkaInputConfigFromRaw constructs a KafkaInputConfig from the given raw config, validating the resulting consumer config
+func NewKafkaInputConfigFromRaw(rawConf map[string]string) (KafkaInputConfig, error) {
+	saramaConf, err := NewKafkaSaramaConfigFromRaw(rawConf)
+	if err != nil {
+		return KafkaInputConfig{}, err
+	}
+
+	// Offsets are only marked once the messages have been delivered by the outputs, and the marked offsets get committed periodically
+	saramaConf.Consumer.Offsets.AutoCommit.Enable = true
+	saramaConf.Consumer.Return.Errors = true
+
+	if initial, ok := rawConf["initial_offset"]; ok {
+		switch initial {
+		case "oldest":
+			saramaConf.Consumer.Offsets.Initial = sarama.OffsetOldest
+		case "newest":
+			saramaConf.Consumer.Offsets.Initial = sarama.OffsetNewest
+		default:
+			return KafkaInputConfig{}, fmt.Errorf("invalid `initial_offset` for Kafka input - expected oldest or newest, got `%s`", initial)
+		}
+	}
+
+	if err := saramaConf.Validate(); err != nil {
+		return KafkaInputConfig{}, err
+	}
+
+	topics, ok := rawConf["topics"]
+	if !ok {
+		return KafkaInputConfig{}, fmt.Errorf("missing `topics` required for Kafka input")
+	}
+
+	brokers := DEFAULT_KAFKA_BROKERS
+	if b, ok := rawConf["brokers"]; ok {
+		brokers = b
+	}
+
+	groupID := DEFAULT_KAFKA_GROUP_ID
+	if g, ok := rawConf["group_id"]; ok {
+		groupID = g
+	}
+
+	parser, _ := parse.GetParserFromString("json", rawConf)
+	if parserName, ok := rawConf["parser"]; ok {
+		parser, err = parse.GetParserFromString(parserName, rawConf)
+		if err != nil {
+			return KafkaInputConfig{}, err
+		}
+	}
+
+	return KafkaInputConfig{
+		RecvConfig: NewRecvConfig(),
+		Brokers:    strings.Split(brokers, ","),
+		Topics:     strings.Split(topics, ","),
+		GroupID:    groupID,
+		Parser:     parser,
+		Sarama:     saramaConf,
+	}, nil
+}
+
+// kafkaRecord is a single Kafka message, parsed into clogger messages
+type kafkaRecord struct {
+	source    *sarama.ConsumerMessage
+	messages  []clogger.Message
+	delivered bool
+}
+
+// kafkaClaimOffsets tracks the records read from a claim that are still being delivered. Offsets are committed
+// per partition, so a record is only marked once it and all the records before it have been delivered
+type kafkaClaimOffsets struct {
+	session sarama.ConsumerGroupSession
+
+	lock    sync.Mutex
+	records []*kafkaRecord
+}
+
+// add tracks the given record, which must be the latest one read from the claim
+func (k *kafkaClaimOffsets) add(record *kafkaRecord) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	k.records = append(k.records, record)
+}
+
+// deliver marks the given record as delivered, marking the offsets of all the records up to the first undelivered one
+func (k *kafkaClaimOffsets) deliver(record *kafkaRecord) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	record.delivered = true
+	for len(k.records) > 0 && k.records[0].delivered {
+		k.session.MarkMessage(k.records[0].source, "")
+		k.records = k.records[1:]
+	}
+}
+
+// KafkaInput is an Inputter that consumes messages from Kafka topics as part of a consumer group
+// Offsets are committed at least once with respect to delivery: a record's offset is only marked once all the messages
+// parsed from it (and every record before it in its partition) have been delivered by the outputs they were sent to,
+// or deliberately dropped by a filter. Records that haven't been delivered when clogger stops, or when the group
+// rebalances, will be consumed again
+type KafkaInput struct {
+	conf         KafkaInputConfig
+	group        sarama.ConsumerGroup
+	internalChan chan *kafkaRecord
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+func NewKafkaInput(conf KafkaInputConfig) (*KafkaInput, error) {
+	group, err := sarama.NewConsumerGroup(conf.Brokers, conf.GroupID, conf.Sarama)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKafkaInputWithGroup(conf, group), nil
+}
+
+// NewKafkaInputWithGroup constructs a KafkaInput with the given consumer group, incase
+// we want to use something other than the default sarama one
+func NewKafkaInputWithGroup(conf KafkaInputConfig, group sarama.ConsumerGroup) *KafkaInput {
+	return &KafkaInput{
+		conf:         conf,
+		group:        group,
+		internalChan: make(chan *kafkaRecord, 10),
+		wg:           sync.WaitGroup{},
+	}
+}
+
+func (k *KafkaInput) Init(ctx context.Context) error {
+	ctx, k.cancel = context.WithCancel(context.Background())
+
+	k.wg.Add(2)
+	go func() {
+		defer k.wg.Done()
+		for err := range k.group.Errors() {
+			log.Warn().Err(err).Msg("Kafka consumer error")
+		}
+	}()
+
+	go func() {
+		defer k.wg.Done()
+
+		// Consume returns whenever the group rebalances, so we need to keep calling it until we're cancelled
+		for ctx.Err() == nil {
+			if err := k.group.Consume(ctx, k.conf.Topics, k); err != nil {
+				log.Warn().Err(err).Msg("Kafka consumer group failed")
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Setup is called by sarama at the beginning of a new consumer group session
+func (k *KafkaInput) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup is called by sarama at the end of a consumer group session
+func (k *KafkaInput) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim is called by sarama for each partition claimed in a consumer group session
+func (k *KafkaInput) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	offsets := &kafkaClaimOffsets{session: session}
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			record := &kafkaRecord{
+				source:   msg,
+				messages: k.parseRecord(session.Context(), msg),
+			}
+
+			offsets.add(record)
+			if len(record.messages) == 0 {
+				offsets.deliver(record)
+				continue
+			}
+
+			delivery := clogger.NewDelivery(len(record.messages), func() {
+				offsets.deliver(record)
+			})
+
+			for i := range record.messages {
+				record.messages[i].Delivery = delivery
+			}
+
+			select {
+			case k.internalChan <- record:
+			case <-session.Context().Done():
+				return nil
+			}
+		}
+	}
+}
+
+// parseRecord parses the value of the given Kafka message with the configured parser
+func (k *KafkaInput) parseRecord(ctx context.Context, msg *sarama.ConsumerMessage) []clogger.Message {
+	ctx = clogger.ContextWithMetadata(ctx, map[string]string{
+		clogger.METADATA_INPUT_TYPE: "kafka",
+		KAFKA_TOPIC_METADATA:        msg.Topic,
+		KAFKA_PARTITION_METADATA:    strconv.FormatInt(int64(msg.Partition), 10),
+		KAFKA_OFFSET_METADATA:       strconv.FormatInt(msg.Offset, 10),
+	})
+
+	parsed := make(chan clogger.Message, 1)
+	var err error
+	go func() {
+		err = k.conf.Parser.ParseStream(ctx, ioutil.NopCloser(bytes.NewReader(msg.Value)), parsed)
+		close(parsed)
+	}()
+
+	messages := []clogger.Message{}
+	for m := range parsed {
+		messages = append(messages, m)
+	}
+
+	if err != nil {
+		log.Debug().Err(err).Str("topic", msg.Topic).Int32("partition", msg.Partition).Int64("offset", msg.Offset).Msg("Failed to parse Kafka message")
+	}
+
+	return messages
+}
+
+func (k *KafkaInput) GetBatch(ctx context.Context) (*clogger.MessageBatch, error) {
+	_, span := tracing.GetTracer().Start(ctx, "KafkaInput.GetBatch")
+	defer span.End()
+
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	case record := <-k.internalChan:
+		numRecords := len(k.internalChan)
+		records := []*kafkaRecord{record}
+		for i := 0; i < numRecords; i++ {
+			records = append(records, <-k.internalChan)
+		}
+
+		numMessages := 0
+		for _, record := range records {
+			numMessages += len(record.messages)
+		}
+
+		batch := clogger.GetMessageBatch(numMessages)
+		for _, record := range records {
+			batch.Messages = append(batch.Messages, record.messages...)
+		}
+
+		span.SetAttributes(attribute.Int("num_records", len(records)), attribute.Int("num_messages", numMessages))
+
+		return batch, nil
+	}
+}
+
+func (k *KafkaInput) Close(ctx context.Context) error {
+	k.cancel()
+	err := k.group.Close()
+	k.wg.Wait()
+
+	return err
+}
+
+func init() {
+	inputsRegistry.Register("kafka", func(rawConf map[string]string) (interface{}, error) {
+		return NewKafkaInputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Inputter, error) {
+		if c, ok := conf.(KafkaInputConfig); ok {
+			return NewKafkaInput(c)
+		}
+
+		return nil, fmt.Errorf("invalid config passed to kafka input")
+	})
+}
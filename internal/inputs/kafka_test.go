@@ -0,0 +1,171 @@
+package inputs_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs"
+)
+
+// fakeConsumerGroup is a sarama.ConsumerGroup that consumes a single claim, fed through the messages channel
+type fakeConsumerGroup struct {
+	messages chan *sarama.ConsumerMessage
+	errors   chan error
+
+	lock   sync.Mutex
+	marked []int64
+}
+
+func newFakeConsumerGroup() *fakeConsumerGroup {
+	return &fakeConsumerGroup{
+		messages: make(chan *sarama.ConsumerMessage, 10),
+		errors:   make(chan error),
+	}
+}
+
+func (f *fakeConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	session := &fakeConsumerGroupSession{ctx: ctx, group: f}
+	if err := handler.Setup(session); err != nil {
+		return err
+	}
+
+	err := handler.ConsumeClaim(session, &fakeConsumerGroupClaim{messages: f.messages})
+	<-ctx.Done()
+	handler.Cleanup(session)
+	return err
+}
+
+func (f *fakeConsumerGroup) Errors() <-chan error {
+	return f.errors
+}
+
+func (f *fakeConsumerGroup) Close() error {
+	close(f.errors)
+	return nil
+}
+
+func (f *fakeConsumerGroup) getMarked() []int64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]int64{}, f.marked...)
+}
+
+type fakeConsumerGroupSession struct {
+	ctx   context.Context
+	group *fakeConsumerGroup
+}
+
+func (f *fakeConsumerGroupSession) Claims() map[string][]int32 { return nil }
+func (f *fakeConsumerGroupSession) MemberID() string           { return "test" }
+func (f *fakeConsumerGroupSession) GenerationID() int32        { return 1 }
+func (f *fakeConsumerGroupSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (f *fakeConsumerGroupSession) Commit() {}
+func (f *fakeConsumerGroupSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (f *fakeConsumerGroupSession) Context() context.Context { return f.ctx }
+
+func (f *fakeConsumerGroupSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	f.group.lock.Lock()
+	defer f.group.lock.Unlock()
+	f.group.marked = append(f.group.marked, msg.Offset)
+}
+
+type fakeConsumerGroupClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (f *fakeConsumerGroupClaim) Topic() string                            { return "logs" }
+func (f *fakeConsumerGroupClaim) Partition() int32                         { return 0 }
+func (f *fakeConsumerGroupClaim) InitialOffset() int64                     { return 0 }
+func (f *fakeConsumerGroupClaim) HighWaterMarkOffset() int64               { return 0 }
+func (f *fakeConsumerGroupClaim) Messages() <-chan *sarama.ConsumerMessage { return f.messages }
+
+func TestKafkaInputMarksOffsetsAfterDelivery(t *testing.T) {
+	conf, err := inputs.NewKafkaInputConfigFromRaw(map[string]string{"topics": "logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := newFakeConsumerGroup()
+	input := inputs.NewKafkaInputWithGroup(conf, group)
+	if err := input.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for offset, message := range []string{"zero", "one", "two"} {
+		group.messages <- &sarama.ConsumerMessage{Topic: "logs", Offset: int64(offset), Value: []byte(`{"message": "` + message + `"}`)}
+	}
+
+	messages := []clogger.Message{}
+	for len(messages) < 3 {
+		batch, err := input.GetBatch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		messages = append(messages, batch.Messages...)
+	}
+
+	if messages[1].ParsedFields["message"] != "one" {
+		t.Fatalf("Expected the parsed records in order, got %v", messages)
+	}
+
+	if offset, _ := messages[1].GetMetadata(inputs.KAFKA_OFFSET_METADATA); offset != "1" {
+		t.Fatalf("Expected the message to have the offset of its record in its metadata, got `%s`", offset)
+	}
+
+	if marked := group.getMarked(); len(marked) != 0 {
+		t.Fatalf("Expected no offsets to be marked before the messages are delivered, got %v", marked)
+	}
+
+	// The last record can't be marked until the one before it has been delivered too
+	messages[0].Delivery.Done()
+	messages[2].Delivery.Done()
+	if marked := group.getMarked(); !reflect.DeepEqual(marked, []int64{0}) {
+		t.Fatalf("Expected only the first record to be marked, got %v", marked)
+	}
+
+	// An undelivered record doesn't get committed when the input closes
+	if err := input.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if marked := group.getMarked(); !reflect.DeepEqual(marked, []int64{0}) {
+		t.Fatalf("Expected the undelivered record not to be marked on close, got %v", marked)
+	}
+
+	messages[1].Delivery.Done()
+	if marked := group.getMarked(); !reflect.DeepEqual(marked, []int64{0, 1, 2}) {
+		t.Fatalf("Expected the rest of the records to be marked once they were all delivered, got %v", marked)
+	}
+}
+
+func TestKafkaInputConfig(t *testing.T) {
+	invalid := []map[string]string{
+		{},
+		{"topics": "logs", "initial_offset": "latest"},
+		{"topics": "logs", "version": "not a version"},
+		{"topics": "logs", "tls": "maybe"},
+		{"topics": "logs", "parser": "not a parser"},
+	}
+
+	for _, conf := range invalid {
+		if _, err := inputs.NewKafkaInputConfigFromRaw(conf); err == nil {
+			t.Errorf("Expected an error constructing a Kafka input config with %v", conf)
+		}
+	}
+
+	conf, err := inputs.NewKafkaInputConfigFromRaw(map[string]string{"topics": "a,b", "brokers": "k1:9092,k2:9092", "initial_offset": "oldest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conf.Topics) != 2 || len(conf.Brokers) != 2 || conf.GroupID != inputs.DEFAULT_KAFKA_GROUP_ID || conf.Sarama.Consumer.Offsets.Initial != sarama.OffsetOldest {
+		t.Fatalf("Got unexpected Kafka input config: %+v", conf)
+	}
+}
@@ -0,0 +1,320 @@
+package inputs
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/otlp"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+const DEFAULT_OTLP_HTTP_LISTEN_ADDR = "localhost:4318"
+const DEFAULT_OTLP_GRPC_LISTEN_ADDR = "localhost:4317"
+
+// OTLP_LOGS_PATH is the path that OTLP/HTTP log exports get sent to
+const OTLP_LOGS_PATH = "/v1/logs"
+
+// MAX_OTLP_REQUEST_SIZE is the largest (decompressed) OTLP/HTTP request body that we'll accept
+const MAX_OTLP_REQUEST_SIZE = 32 * 1024 * 1024
+
+type OTLPInputConfig struct {
+	RecvConfig
+
+	// HTTPListenAddr is the address to accept OTLP/HTTP exports on, or empty to disable OTLP/HTTP
+	HTTPListenAddr string
+
+	// GRPCListenAddr is the address to accept OTLP/gRPC exports on, or empty to disable OTLP/gRPC
+	GRPCListenAddr string
+	TLS            *clogger.TLSConfig
+}
+
+func newOTLPInputConfigFromRaw(rawConf map[string]string) (OTLPInputConfig, error) {
+	tls, err := clogger.NewTLSConfigFromRaw(rawConf)
+	if err != nil {
+		return OTLPInputConfig{}, err
+	}
+
+	conf := OTLPInputConfig{
+		RecvConfig:     NewRecvConfig(),
+		HTTPListenAddr: DEFAULT_OTLP_HTTP_LISTEN_ADDR,
+		GRPCListenAddr: DEFAULT_OTLP_GRPC_LISTEN_ADDR,
+		TLS:            &tls,
+	}
+
+	if addr, ok := rawConf["http_listen"]; ok {
+		conf.HTTPListenAddr = addr
+	}
+
+	if addr, ok := rawConf["grpc_listen"]; ok {
+		conf.GRPCListenAddr = addr
+	}
+
+	if conf.HTTPListenAddr == "" && conf.GRPCListenAddr == "" {
+		return OTLPInputConfig{}, fmt.Errorf("at least one of `http_listen` and `grpc_listen` is required for the otlp input")
+	}
+
+	return conf, nil
+}
+
+// OTLPInput is an Inputter that receives OpenTelemetry log exports over OTLP/HTTP (protobuf and JSON) and OTLP/gRPC
+// Exports are acknowledged once all of their records have been handed off to the pipeline
+type OTLPInput struct {
+	conf         OTLPInputConfig
+	internalChan chan clogger.Message
+	httpServer   *http.Server
+	grpcServer   *grpc.Server
+	wg           sync.WaitGroup
+}
+
+func NewOTLPInput(conf OTLPInputConfig) *OTLPInput {
+	return &OTLPInput{
+		conf:         conf,
+		internalChan: make(chan clogger.Message, 10),
+		wg:           sync.WaitGroup{},
+	}
+}
+
+// otlpLogsServer implements the OTLP/gRPC logs service on top of an OTLPInput
+type otlpLogsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	input *OTLPInput
+}
+
+func (o *otlpLogsServer) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		ctx = clogger.ContextWithMetadata(ctx, map[string]string{
+			clogger.METADATA_PEER_ADDR: p.Addr.String(),
+		})
+	}
+
+	if err := o.input.queue(ctx, otlp.ToMessages(req.GetResourceLogs())); err != nil {
+		return nil, err
+	}
+
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+// queue hands the Messages from an export off to the pipeline
+func (o *OTLPInput) queue(ctx context.Context, messages []clogger.Message) error {
+	ctx, span := tracing.GetTracer().Start(ctx, "OTLPInput.queue")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("num_messages", len(messages)))
+
+	for _, msg := range messages {
+		msg.SetMetadata(clogger.METADATA_INPUT_TYPE, "otlp")
+		msg.AddMetadataFromContext(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case o.internalChan <- msg:
+		}
+	}
+
+	return nil
+}
+
+// ServeHTTP handles OTLP/HTTP exports. JSON payloads are decoded as OTLP/JSON, so trace and span IDs are expected to be hex.
+// Requests with a body that doesn't contain any log records we understand are rejected, rather than silently dropped
+func (o *OTLPInput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != "application/x-protobuf" && contentType != "application/json") {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		defer gzipReader.Close()
+		body = gzipReader
+	default:
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, MAX_OTLP_REQUEST_SIZE+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(data) > MAX_OTLP_REQUEST_SIZE {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	req := &collogspb.ExportLogsServiceRequest{}
+	if contentType == "application/json" {
+		err = otlp.UnmarshalJSON(data, req)
+	} else {
+		err = proto.Unmarshal(data, req)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Unknown fields are ignored, so a body from an incompatible version of OTLP can decode to nothing
+	messages := otlp.ToMessages(req.GetResourceLogs())
+	if len(messages) == 0 && len(data) > 0 {
+		http.Error(w, "request contains no log records", http.StatusBadRequest)
+		return
+	}
+
+	ctx := clogger.ContextWithMetadata(r.Context(), map[string]string{
+		clogger.METADATA_PEER_ADDR: r.RemoteAddr,
+	})
+
+	if err := o.queue(ctx, messages); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	// Respond in the same encoding that the request was sent in
+	var resp []byte
+	if contentType == "application/json" {
+		resp, err = otlp.MarshalJSON(&collogspb.ExportLogsServiceResponse{})
+	} else {
+		resp, err = proto.Marshal(&collogspb.ExportLogsServiceResponse{})
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (o *OTLPInput) Init(ctx context.Context) error {
+	if o.conf.HTTPListenAddr != "" {
+		listener, err := net.Listen("tcp", o.conf.HTTPListenAddr)
+		if err != nil {
+			return err
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle(OTLP_LOGS_PATH, o)
+		o.httpServer = &http.Server{
+			Handler: mux,
+		}
+
+		listener = o.conf.TLS.WrapListener(listener)
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			if err := o.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Warn().Err(err).Msg("OTLP/HTTP server failed")
+			}
+		}()
+	}
+
+	if o.conf.GRPCListenAddr != "" {
+		listener, err := net.Listen("tcp", o.conf.GRPCListenAddr)
+		if err != nil {
+			if o.httpServer != nil {
+				o.httpServer.Close()
+			}
+
+			return err
+		}
+
+		options := []grpc.ServerOption{}
+		if o.conf.TLS.IsEnabled() {
+			options = append(options, grpc.Creds(credentials.NewTLS(o.conf.TLS.ServerConfig())))
+		}
+
+		o.grpcServer = grpc.NewServer(options...)
+		collogspb.RegisterLogsServiceServer(o.grpcServer, &otlpLogsServer{input: o})
+
+		o.wg.Add(1)
+		go func() {
+			defer o.wg.Done()
+			if err := o.grpcServer.Serve(listener); err != nil {
+				log.Warn().Err(err).Msg("OTLP/gRPC server failed")
+			}
+		}()
+	}
+
+	return nil
+}
+
+func (o *OTLPInput) Close(ctx context.Context) error {
+	var err error
+	if o.httpServer != nil {
+		err = o.httpServer.Shutdown(ctx)
+	}
+
+	if o.grpcServer != nil {
+		o.grpcServer.GracefulStop()
+	}
+
+	o.wg.Wait()
+	close(o.internalChan)
+
+	return err
+}
+
+func (o *OTLPInput) GetBatch(ctx context.Context) (*clogger.MessageBatch, error) {
+	_, span := tracing.GetTracer().Start(ctx, "OTLPInput.GetBatch")
+	defer span.End()
+
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	case msg := <-o.internalChan:
+		numMessages := len(o.internalChan) + 1
+		batch := clogger.GetMessageBatch(numMessages)
+		batch.Messages = append(batch.Messages, msg)
+		for i := 0; i < numMessages-1; i++ {
+			batch.Messages = append(batch.Messages, <-o.internalChan)
+		}
+
+		return batch, nil
+	}
+}
+
+func init() {
+	inputsRegistry.Register("otlp", func(rawConf map[string]string) (interface{}, error) {
+		return newOTLPInputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Inputter, error) {
+		if c, ok := conf.(OTLPInputConfig); ok {
+			return NewOTLPInput(c), nil
+		}
+
+		return nil, fmt.Errorf("invalid config passed to otlp input")
+	})
+}
@@ -0,0 +1,96 @@
+package inputs_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs"
+)
+
+// otlpJSONExport is shaped like an export from a current OpenTelemetry SDK or collector
+const otlpJSONExport = `{
+  "resourceLogs": [{
+    "resource": {
+      "attributes": [{"key": "service.name", "value": {"stringValue": "checkout"}}]
+    },
+    "scopeLogs": [{
+      "scope": {"name": "com.example.checkout", "version": "1.2.0"},
+      "logRecords": [{
+        "timeUnixNano": "1704164645123000000",
+        "observedTimeUnixNano": "1704164645124000000",
+        "severityNumber": 17,
+        "severityText": "ERROR",
+        "traceId": "5b8efff798038103d269b633813fc60c",
+        "spanId": "eee19b7ec3c1b174",
+        "body": {"stringValue": "payment failed"},
+        "attributes": [
+          {"key": "http.status_code", "value": {"intValue": "502"}},
+          {"key": "retry", "value": {"boolValue": true}}
+        ]
+      }]
+    }]
+  }]
+}`
+
+func postOTLP(input *inputs.OTLPInput, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, inputs.OTLP_LOGS_PATH, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	input.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestOTLPInputJSON(t *testing.T) {
+	input := inputs.NewOTLPInput(inputs.OTLPInputConfig{})
+	if resp := postOTLP(input, otlpJSONExport); resp.Code != http.StatusOK {
+		t.Fatalf("Expected the export to be accepted, got %d: %s", resp.Code, resp.Body.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	batch, err := input.GetBatch(ctx)
+	if err != nil || batch == nil || len(batch.Messages) != 1 {
+		t.Fatalf("Expected a batch with one message, got %v (%v)", batch, err)
+	}
+
+	msg := batch.Messages[0]
+	expected := map[string]interface{}{
+		clogger.MESSAGE_FIELD:   "payment failed",
+		"resource.service.name": "checkout",
+		"scope.name":            "com.example.checkout",
+		"scope.version":         "1.2.0",
+		"severity":              "ERROR",
+		"severity_number":       int64(17),
+		"trace_id":              "5b8efff798038103d269b633813fc60c",
+		"span_id":               "eee19b7ec3c1b174",
+		"http.status_code":      int64(502),
+		"retry":                 true,
+	}
+
+	for key, value := range expected {
+		if msg.ParsedFields[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, msg.ParsedFields[key])
+		}
+	}
+
+	if !msg.EventTime.Equal(time.Unix(0, 1704164645123000000)) {
+		t.Errorf("Expected the event time to come from the record, got %s", msg.EventTime)
+	}
+}
+
+func TestOTLPInputRejectsUnknownPayloads(t *testing.T) {
+	input := inputs.NewOTLPInput(inputs.OTLPInputConfig{})
+
+	// This decodes without error (unknown fields are ignored), but doesn't contain any records that we understand
+	unknown := `{"resourceLogs": [{"futureLogs": [{"records": [{"body": {"stringValue": "lost"}}]}]}]}`
+	if resp := postOTLP(input, unknown); resp.Code != http.StatusBadRequest {
+		t.Fatalf("Expected an export without any log records to be rejected, got %d", resp.Code)
+	}
+}
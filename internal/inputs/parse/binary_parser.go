@@ -0,0 +1,37 @@
+package parse
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+)
+
+// BinaryParser parses messages in clogger's binary encoding, each prefixed with its length as a uvarint
+type BinaryParser struct{}
+
+func (b *BinaryParser) ParseStream(ctx context.Context, stream io.ReadCloser, flushChan chan clogger.Message) error {
+	_, span := tracing.GetTracer().Start(ctx, "BinaryParser.ParseStream")
+	defer span.End()
+
+	reader := bufio.NewReader(stream)
+	for {
+		data, err := readLengthPrefixed(reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		message := clogger.Message{}
+		if err := message.UnmarshalBinary(data); err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		emit(ctx, flushChan, message)
+	}
+}
@@ -0,0 +1,46 @@
+package parse_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+)
+
+func TestBinaryParser(t *testing.T) {
+	var stream bytes.Buffer
+	for _, status := range []int64{200, 500} {
+		msg := clogger.NewMessage()
+		msg.ParsedFields["status"] = status
+
+		data, err := msg.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		length := make([]byte, binary.MaxVarintLen64)
+		stream.Write(length[:binary.PutUvarint(length, uint64(len(data)))])
+		stream.Write(data)
+	}
+
+	parser := parse.BinaryParser{}
+	c := make(chan clogger.Message, 10)
+	if err := parser.ParseStream(context.Background(), ioutil.NopCloser(&stream), c); err != nil {
+		t.Fatal(err)
+	}
+
+	close(c)
+
+	statuses := []int64{}
+	for msg := range c {
+		statuses = append(statuses, msg.ParsedFields["status"].(int64))
+	}
+
+	if len(statuses) != 2 || statuses[0] != 200 || statuses[1] != 500 {
+		t.Fatalf("Got unexpected statuses: %v", statuses)
+	}
+}
@@ -0,0 +1,57 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+)
+
+// CBORParser parses a stream of CBOR maps
+type CBORParser struct {
+	Framing Framing
+}
+
+func (c *CBORParser) ParseStream(ctx context.Context, stream io.ReadCloser, flushChan chan clogger.Message) error {
+	_, span := tracing.GetTracer().Start(ctx, "CBORParser.ParseStream")
+	defer span.End()
+
+	reader := bufio.NewReader(stream)
+	decoder := cbor.NewDecoder(reader)
+	for {
+		if c.Framing == FRAMING_LENGTH {
+			data, err := readLengthPrefixed(reader)
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				span.RecordError(err)
+				return err
+			}
+
+			decoder = cbor.NewDecoder(bytes.NewReader(data))
+		}
+
+		var value interface{}
+		if err := decoder.Decode(&value); err == io.EOF {
+			return nil
+		} else if err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		fields, err := toFields(value)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		message := clogger.NewMessage()
+		message.ParsedFields = fields
+
+		emit(ctx, flushChan, message)
+	}
+}
@@ -0,0 +1,124 @@
+package parse
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// MAX_FRAME_SIZE is the largest length prefixed message that we'll accept
+const MAX_FRAME_SIZE = 16 * 1024 * 1024
+
+// Framing is how messages are delimited in a stream of a self describing binary format
+type Framing int
+
+const (
+	// FRAMING_NONE relies on the format being self delimiting
+	FRAMING_NONE Framing = iota
+
+	// FRAMING_LENGTH prefixes each message with its length as a uvarint
+	FRAMING_LENGTH
+)
+
+// ParseFraming parses the `framing` option out of the given config, defaulting to FRAMING_NONE
+func ParseFraming(args map[string]string) (Framing, error) {
+	framing, ok := args["framing"]
+	if !ok {
+		return FRAMING_NONE, nil
+	}
+
+	switch framing {
+	case "none":
+		return FRAMING_NONE, nil
+	case "length":
+		return FRAMING_LENGTH, nil
+	}
+
+	return FRAMING_NONE, fmt.Errorf("invalid `framing` `%s` - expected none or length", framing)
+}
+
+// readLengthPrefixed reads a single uvarint length prefixed message, returning io.EOF if the stream ended cleanly
+func readLengthPrefixed(reader *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if length > MAX_FRAME_SIZE {
+		return nil, fmt.Errorf("message of %d bytes is larger than the maximum of %d", length, MAX_FRAME_SIZE)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// normalizeValue converts a value decoded from msgpack or CBOR into the types that the rest of clogger expects:
+// integers become int64 (or uint64 if they don't fit), floats become float64, and maps get string keys
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint:
+		return normalizeValue(uint64(v))
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+
+		return v
+	case float32:
+		return float64(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = normalizeValue(v[i])
+		}
+
+		return v
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeValue(item)
+		}
+
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeValue(item)
+		}
+
+		return m
+	case time.Time:
+		return v
+	}
+
+	return value
+}
+
+// toFields converts a decoded top level value into the fields of a message
+func toFields(value interface{}) (map[string]interface{}, error) {
+	fields, ok := normalizeValue(value).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a map, got %T", value)
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,221 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+)
+
+// GELF_CHUNK_TIMEOUT is how long we wait for all the chunks of a message to arrive, as per the spec
+const GELF_CHUNK_TIMEOUT = 5 * time.Second
+
+// GELF_MAX_CHUNKS is the maximum number of chunks in a single message, as per the spec
+const GELF_MAX_CHUNKS = 128
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// gelfChunkedMessage is a message that we're still waiting on chunks for
+type gelfChunkedMessage struct {
+	chunks    [][]byte
+	received  int
+	firstSeen time.Time
+}
+
+// GELFParser parses Graylog Extended Log Format messages, either null byte delimited over
+// a stream, or as (optionally chunked and compressed) datagrams
+type GELFParser struct {
+	chunksLock sync.Mutex
+	chunks     map[string]*gelfChunkedMessage
+}
+
+func NewGELFParser() *GELFParser {
+	return &GELFParser{
+		chunks: make(map[string]*gelfChunkedMessage),
+	}
+}
+
+// scanNullDelimited is a bufio.SplitFunc that splits on null bytes
+func scanNullDelimited(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+func (g *GELFParser) ParseStream(ctx context.Context, stream io.ReadCloser, flushChan chan clogger.Message) error {
+	_, span := tracing.GetTracer().Start(ctx, "GELFParser.ParseStream")
+	defer span.End()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	scanner.Split(scanNullDelimited)
+	for scanner.Scan() {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		msg, err := decodeGELF(data)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		emit(ctx, flushChan, msg)
+	}
+
+	return scanner.Err()
+}
+
+// ParseDatagram parses a single GELF datagram, which may be one chunk of a larger message
+// and may be compressed with zlib or gzip
+func (g *GELFParser) ParseDatagram(ctx context.Context, data []byte, flushChan chan clogger.Message) error {
+	_, span := tracing.GetTracer().Start(ctx, "GELFParser.ParseDatagram")
+	defer span.End()
+
+	if bytes.HasPrefix(data, gelfChunkMagic) {
+		var complete bool
+		var err error
+		data, complete, err = g.addChunk(data)
+		if err != nil || !complete {
+			return err
+		}
+	}
+
+	data, err := decompressGELF(data)
+	if err != nil {
+		return err
+	}
+
+	msg, err := decodeGELF(data)
+	if err != nil {
+		return err
+	}
+
+	emit(ctx, flushChan, msg)
+	return nil
+}
+
+// addChunk adds the given chunk to the message it belongs to, returning the reassembled message
+// if this was the last chunk we were waiting on
+func (g *GELFParser) addChunk(chunk []byte) ([]byte, bool, error) {
+	// Chunk header: 2 bytes magic, 8 bytes message ID, 1 byte sequence number, 1 byte sequence count
+	if len(chunk) < 12 {
+		return nil, false, fmt.Errorf("GELF chunk too short")
+	}
+
+	id := string(chunk[2:10])
+	seq := int(chunk[10])
+	count := int(chunk[11])
+	if count == 0 || count > GELF_MAX_CHUNKS || seq >= count {
+		return nil, false, fmt.Errorf("invalid GELF chunk %d/%d", seq, count)
+	}
+
+	g.chunksLock.Lock()
+	defer g.chunksLock.Unlock()
+
+	// Throw away any messages that we've given up on
+	for key, message := range g.chunks {
+		if time.Since(message.firstSeen) > GELF_CHUNK_TIMEOUT {
+			delete(g.chunks, key)
+		}
+	}
+
+	message, ok := g.chunks[id]
+	if !ok {
+		message = &gelfChunkedMessage{
+			chunks:    make([][]byte, count),
+			firstSeen: time.Now(),
+		}
+
+		g.chunks[id] = message
+	}
+
+	if len(message.chunks) != count {
+		delete(g.chunks, id)
+		return nil, false, fmt.Errorf("GELF chunks for the same message disagree on the number of chunks")
+	}
+
+	if message.chunks[seq] == nil {
+		message.chunks[seq] = append([]byte(nil), chunk[12:]...)
+		message.received += 1
+	}
+
+	if message.received < count {
+		return nil, false, nil
+	}
+
+	delete(g.chunks, id)
+	return bytes.Join(message.chunks, nil), true, nil
+}
+
+// decompressGELF decompresses the given datagram if it's compressed with zlib or gzip
+func decompressGELF(data []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case len(data) >= 2 && data[0] == 0x78 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// decodeGELF converts the given GELF payload into a Message, stripping the `_` prefix off of
+// additional fields and normalising `short_message` to our message field
+func decodeGELF(data []byte) (clogger.Message, error) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return clogger.Message{}, err
+	}
+
+	message := clogger.NewMessage()
+	for k, v := range raw {
+		switch {
+		case k == "short_message":
+			message.ParsedFields[clogger.MESSAGE_FIELD] = v
+		case k == "version":
+			continue
+		case k == "timestamp":
+			if ts, ok := v.(float64); ok {
+				message.EventTime = time.Unix(0, int64(ts*float64(time.Second)))
+			}
+		case strings.HasPrefix(k, "_"):
+			message.ParsedFields[k[1:]] = v
+		default:
+			message.ParsedFields[k] = v
+		}
+	}
+
+	return message, nil
+}
@@ -0,0 +1,82 @@
+package parse_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+)
+
+func TestGELFParserStream(t *testing.T) {
+	data := `{"version":"1.1","host":"web1","short_message":"first","timestamp":1600000000.5,"_service":"nginx"}` + "\x00" +
+		`{"version":"1.1","host":"web1","short_message":"second","level":3}` + "\x00"
+
+	parser := parse.NewGELFParser()
+	c := make(chan clogger.Message, 10)
+
+	if err := parser.ParseStream(context.Background(), ioutil.NopCloser(bytes.NewReader([]byte(data))), c); err != nil {
+		t.Fatal(err)
+	}
+
+	close(c)
+
+	first := <-c
+	if first.ParsedFields[clogger.MESSAGE_FIELD] != "first" || first.ParsedFields["service"] != "nginx" || first.ParsedFields["host"] != "web1" {
+		t.Errorf("Got unexpected fields: %v", first.ParsedFields)
+	}
+
+	if _, ok := first.ParsedFields["version"]; ok {
+		t.Errorf("Expected version to be dropped")
+	}
+
+	if first.EventTime.UnixNano() != 1600000000500000000 {
+		t.Errorf("Expected timestamp to be parsed, got %s", first.EventTime)
+	}
+
+	second := <-c
+	if second.ParsedFields[clogger.MESSAGE_FIELD] != "second" {
+		t.Errorf("Got unexpected fields: %v", second.ParsedFields)
+	}
+}
+
+func TestGELFParserChunkedDatagram(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write([]byte(`{"version":"1.1","host":"web1","short_message":"chunked message"}`))
+	writer.Close()
+
+	payload := compressed.Bytes()
+	id := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	split := len(payload) / 2
+	chunks := [][]byte{payload[:split], payload[split:]}
+
+	parser := parse.NewGELFParser()
+	c := make(chan clogger.Message, 10)
+
+	// Send the chunks out of order
+	for _, i := range []int{1, 0} {
+		datagram := append([]byte{0x1e, 0x0f}, id...)
+		datagram = append(datagram, byte(i), byte(len(chunks)))
+		datagram = append(datagram, chunks[i]...)
+		if err := parser.ParseDatagram(context.Background(), datagram, c); err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 1 && len(c) != 0 {
+			t.Fatal("Got a message before all the chunks arrived")
+		}
+	}
+
+	if len(c) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(c))
+	}
+
+	msg := <-c
+	if msg.ParsedFields[clogger.MESSAGE_FIELD] != "chunked message" {
+		t.Errorf("Got unexpected fields: %v", msg.ParsedFields)
+	}
+}
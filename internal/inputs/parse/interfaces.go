@@ -12,12 +12,44 @@ type InputParser interface {
 	ParseStream(ctx context.Context, bytes io.ReadCloser, flushChan chan clogger.Message) error
 }
 
+// A DatagramParser is an InputParser that needs to know about datagram boundaries (e.g. because messages can be chunked
+// across datagrams). Parsers that don't implement this get each datagram passed to ParseStream as its own stream
+type DatagramParser interface {
+	InputParser
+	ParseDatagram(ctx context.Context, data []byte, flushChan chan clogger.Message) error
+}
+
+// emit sends the given message to the flushChan, tagging it with any metadata that the input attached to the context
+// (see clogger.ContextWithMetadata)
+func emit(ctx context.Context, flushChan chan clogger.Message, message clogger.Message) {
+	message.AddMetadataFromContext(ctx)
+	flushChan <- message
+}
+
 func GetParserFromString(s string, args map[string]string) (InputParser, error) {
 	switch s {
 	case "json":
 		return &JSONParser{}, nil
 	case "newline":
 		return &NewlineParser{}, nil
+	case "gelf":
+		return NewGELFParser(), nil
+	case "binary":
+		return &BinaryParser{}, nil
+	case "msgpack":
+		framing, err := ParseFraming(args)
+		if err != nil {
+			return nil, err
+		}
+
+		return &MsgpackParser{Framing: framing}, nil
+	case "cbor":
+		framing, err := ParseFraming(args)
+		if err != nil {
+			return nil, err
+		}
+
+		return &CBORParser{Framing: framing}, nil
 	}
 
 	return nil, fmt.Errorf("no formatter named `%s` found", s)
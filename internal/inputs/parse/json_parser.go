@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"io"
-	"time"
 
 	"github.com/sinkingpoint/clogger/internal/clogger"
 	"github.com/sinkingpoint/clogger/internal/tracing"
@@ -32,9 +31,8 @@ func (j *JSONParser) ParseStream(ctx context.Context, bytes io.ReadCloser, flush
 
 		message := clogger.NewMessage()
 		message.ParsedFields = rawMessage
-		message.MonoTimestamp = time.Now().UnixNano()
 
-		flushChan <- message
+		emit(ctx, flushChan, message)
 	}
 
 	return nil
@@ -0,0 +1,57 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackParser parses a stream of MessagePack maps
+type MsgpackParser struct {
+	Framing Framing
+}
+
+func (m *MsgpackParser) ParseStream(ctx context.Context, stream io.ReadCloser, flushChan chan clogger.Message) error {
+	_, span := tracing.GetTracer().Start(ctx, "MsgpackParser.ParseStream")
+	defer span.End()
+
+	reader := bufio.NewReader(stream)
+	decoder := msgpack.NewDecoder(reader)
+	for {
+		if m.Framing == FRAMING_LENGTH {
+			data, err := readLengthPrefixed(reader)
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				span.RecordError(err)
+				return err
+			}
+
+			decoder.Reset(bytes.NewReader(data))
+		}
+
+		value, err := decoder.DecodeInterface()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		fields, err := toFields(value)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+
+		message := clogger.NewMessage()
+		message.ParsedFields = fields
+
+		emit(ctx, flushChan, message)
+	}
+}
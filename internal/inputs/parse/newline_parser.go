@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"context"
 	"io"
-	"time"
 
 	"github.com/sinkingpoint/clogger/internal/clogger"
 	"github.com/sinkingpoint/clogger/internal/tracing"
@@ -18,13 +17,9 @@ func (j *NewlineParser) ParseStream(ctx context.Context, bytes io.ReadCloser, fl
 
 	scanner := bufio.NewScanner(bytes)
 	for scanner.Scan() {
-		line := scanner.Text()
-		flushChan <- clogger.Message{
-			MonoTimestamp: time.Now().UnixNano(),
-			ParsedFields: map[string]interface{}{
-				clogger.MESSAGE_FIELD: line,
-			},
-		}
+		message := clogger.NewMessage()
+		message.ParsedFields[clogger.MESSAGE_FIELD] = scanner.Text()
+		emit(ctx, flushChan, message)
 	}
 
 	return scanner.Err()
@@ -22,6 +22,16 @@ const (
 	TCP_SOCKET_INPUT
 )
 
+// network returns the name of the network that sockets of this type listen on, as understood by net.Listen
+func (s SocketInputType) network() string {
+	switch s {
+	case UNIX_SOCKET_INPUT:
+		return "unix"
+	default:
+		return "tcp"
+	}
+}
+
 const DEFAULT_SOCKET_PATH = "/run/clogger/clogger.sock"
 const DEFAULT_LISTEN_ADDR = "localhost:4279"
 
@@ -88,6 +98,16 @@ func (s *socketInput) handleConn(ctx context.Context, conn net.Conn) {
 	ctx, span := tracing.GetTracer().Start(ctx, "SocketInput.handleConn")
 	defer span.End()
 	defer conn.Close()
+
+	metadata := map[string]string{
+		clogger.METADATA_INPUT_TYPE: s.conf.Type.network(),
+	}
+
+	if addr := conn.RemoteAddr(); addr != nil && addr.String() != "" {
+		metadata[clogger.METADATA_PEER_ADDR] = addr.String()
+	}
+
+	ctx = clogger.ContextWithMetadata(ctx, metadata)
 	if err := s.conf.Parser.ParseStream(ctx, conn, s.internalChan); err != nil {
 		span.RecordError(err)
 		log.Debug().Err(err).Msg("Failed to parse incoming stream")
@@ -95,15 +115,7 @@ func (s *socketInput) handleConn(ctx context.Context, conn net.Conn) {
 }
 
 func (s *socketInput) Init(ctx context.Context) error {
-	var ty string
-	switch s.conf.Type {
-	case UNIX_SOCKET_INPUT:
-		ty = "unix"
-	case TCP_SOCKET_INPUT:
-		ty = "tcp"
-	}
-
-	listener, err := net.Listen(ty, s.conf.ListenAddr)
+	listener, err := net.Listen(s.conf.Type.network(), s.conf.ListenAddr)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,172 @@
+package inputs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MAX_DATAGRAM_SIZE is the largest UDP datagram that we can receive
+const MAX_DATAGRAM_SIZE = 65535
+
+type UDPInputConfig struct {
+	RecvConfig
+	ListenAddr string
+	Parser     parse.InputParser
+}
+
+func newUDPInputConfigFromRaw(rawConf map[string]string) (UDPInputConfig, error) {
+	var err error
+	listenAddr := DEFAULT_LISTEN_ADDR
+	if addr, ok := rawConf["listen"]; ok {
+		listenAddr = addr
+	}
+
+	parser, _ := parse.GetParserFromString("newline", rawConf)
+	if parserName, ok := rawConf["parser"]; ok {
+		parser, err = parse.GetParserFromString(parserName, rawConf)
+		if err != nil {
+			return UDPInputConfig{}, err
+		}
+	}
+
+	return UDPInputConfig{
+		RecvConfig: NewRecvConfig(),
+		ListenAddr: listenAddr,
+		Parser:     parser,
+	}, nil
+}
+
+// UDPInput is an Inputter that receives datagrams over UDP, parsing each one with the configured parser
+type UDPInput struct {
+	conf         UDPInputConfig
+	conn         net.PacketConn
+	internalChan chan clogger.Message
+	wg           sync.WaitGroup
+
+	// closing is closed when we start shutting down, to unblock the reader if it's waiting on the pipeline
+	closing chan struct{}
+}
+
+func NewUDPInput(conf UDPInputConfig) *UDPInput {
+	return &UDPInput{
+		conf:         conf,
+		internalChan: make(chan clogger.Message, 10),
+		wg:           sync.WaitGroup{},
+		closing:      make(chan struct{}),
+	}
+}
+
+func (u *UDPInput) Init(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", u.conf.ListenAddr)
+	if err != nil {
+		return err
+	}
+
+	u.conn = conn
+
+	u.wg.Add(1)
+	go func() {
+		defer u.wg.Done()
+		buffer := make([]byte, MAX_DATAGRAM_SIZE)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				break
+			}
+
+			datagramCtx := clogger.ContextWithMetadata(ctx, map[string]string{
+				clogger.METADATA_INPUT_TYPE: "udp",
+				clogger.METADATA_PEER_ADDR:  addr.String(),
+			})
+
+			// Parsers are allowed to hold onto the data, so we can't reuse the buffer
+			data := append([]byte(nil), buffer[:n]...)
+			if err := u.parseDatagram(datagramCtx, data); err != nil {
+				log.Debug().Err(err).Msg("Failed to parse incoming datagram")
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (u *UDPInput) parseDatagram(ctx context.Context, data []byte) error {
+	parsed := make(chan clogger.Message, 1)
+	var err error
+	go func() {
+		if parser, ok := u.conf.Parser.(parse.DatagramParser); ok {
+			err = parser.ParseDatagram(ctx, data, parsed)
+		} else {
+			err = u.conf.Parser.ParseStream(ctx, ioutil.NopCloser(bytes.NewReader(data)), parsed)
+		}
+
+		close(parsed)
+	}()
+
+	for msg := range parsed {
+		select {
+		case u.internalChan <- msg:
+		case <-u.closing:
+			// Nothing is reading from us anymore, so drop the rest of the datagram
+		}
+	}
+
+	return err
+}
+
+// Addr returns the address that the input is listening on
+func (u *UDPInput) Addr() net.Addr {
+	return u.conn.LocalAddr()
+}
+
+func (u *UDPInput) Close(ctx context.Context) error {
+	err := u.conn.Close()
+	close(u.closing)
+	u.wg.Wait()
+	close(u.internalChan)
+
+	return err
+}
+
+func (u *UDPInput) GetBatch(ctx context.Context) (*clogger.MessageBatch, error) {
+	_, span := tracing.GetTracer().Start(ctx, "UDPInput.GetBatch")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("listen_addr", u.conf.ListenAddr))
+
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	case msg := <-u.internalChan:
+		numMessages := len(u.internalChan) + 1
+		batch := clogger.GetMessageBatch(numMessages)
+		batch.Messages = append(batch.Messages, msg)
+		for i := 0; i < numMessages-1; i++ {
+			batch.Messages = append(batch.Messages, <-u.internalChan)
+		}
+
+		return batch, nil
+	}
+}
+
+func init() {
+	inputsRegistry.Register("udp", func(rawConf map[string]string) (interface{}, error) {
+		return newUDPInputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Inputter, error) {
+		if c, ok := conf.(UDPInputConfig); ok {
+			return NewUDPInput(c), nil
+		}
+
+		return nil, fmt.Errorf("invalid config passed to udp input")
+	})
+}
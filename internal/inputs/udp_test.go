@@ -0,0 +1,54 @@
+package inputs_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/inputs"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+)
+
+func TestUDPInputCloseWithStalledPipeline(t *testing.T) {
+	parser, err := parse.GetParserFromString("newline", map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := inputs.NewUDPInput(inputs.UDPInputConfig{
+		ListenAddr: "127.0.0.1:0",
+		Parser:     parser,
+	})
+
+	if err := input.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.Dial("udp", input.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	// Send more messages than the input can buffer, without ever reading a batch
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(conn, "message %d\n", i)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		input.Close(context.Background())
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the UDP input to close")
+	}
+}
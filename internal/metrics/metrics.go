@@ -25,6 +25,22 @@ var (
 		"step_name",
 	})
 
+	RateLimitDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "clogger",
+		Name:      "ratelimit_dropped",
+		Help:      "The number of messages dropped by the given rate limit filter for going over the rate",
+	}, []string{
+		"step_name",
+	})
+
+	AggregateLateDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "clogger",
+		Name:      "aggregate_late_dropped",
+		Help:      "The number of messages dropped by the given aggregate filter for arriving after all their windows had closed",
+	}, []string{
+		"step_name",
+	})
+
 	OutputState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: "clogger",
 		Name:      "output_state",
@@ -36,7 +52,7 @@ var (
 )
 
 func InitMetrics(listenAddress string) {
-	prometheus.MustRegister(MessagesProcessed, FilterDropped, OutputState)
+	prometheus.MustRegister(MessagesProcessed, FilterDropped, RateLimitDropped, AggregateLateDropped, OutputState)
 
 	http.Handle("/metrics", promhttp.Handler())
 	go http.ListenAndServe(listenAddress, nil)
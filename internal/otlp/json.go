@@ -0,0 +1,94 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// idFields are the JSON keys of the trace and span IDs, which OTLP/JSON encodes as hex rather than the base64
+// that the standard protobuf JSON mapping uses for bytes
+var idFields = map[string]bool{
+	"traceId":  true,
+	"spanId":   true,
+	"trace_id": true,
+	"span_id":  true,
+}
+
+// MarshalJSON encodes the given OTLP message as OTLP/JSON, i.e. the protobuf JSON mapping with hex trace and span IDs
+// and integer enums
+func MarshalJSON(m proto.Message) ([]byte, error) {
+	data, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertIDs(data, func(id string) (string, bool) {
+		decoded, err := base64.StdEncoding.DecodeString(id)
+		if err != nil {
+			return "", false
+		}
+
+		return hex.EncodeToString(decoded), true
+	})
+}
+
+// UnmarshalJSON decodes the given OTLP/JSON into the given OTLP message, ignoring any fields that we don't know about
+func UnmarshalJSON(data []byte, m proto.Message) error {
+	data, err := convertIDs(data, func(id string) (string, bool) {
+		decoded, err := hex.DecodeString(id)
+		if err != nil {
+			return "", false
+		}
+
+		return base64.StdEncoding.EncodeToString(decoded), true
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+}
+
+// convertIDs rewrites every trace and span ID in the given JSON with the given function,
+// leaving any IDs that it can't convert alone
+func convertIDs(data []byte, convert func(string) (string, bool)) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	// Keep numbers as they are, so that we don't lose precision on e.g. timestamps
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	convertIDsIn(value, convert)
+	return json.Marshal(value)
+}
+
+func convertIDsIn(value interface{}, convert func(string) (string, bool)) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if id, ok := child.(string); ok && idFields[key] {
+				if converted, ok := convert(id); ok {
+					v[key] = converted
+				}
+
+				continue
+			}
+
+			convertIDsIn(child, convert)
+		}
+	case []interface{}:
+		for _, child := range v {
+			convertIDsIn(child, convert)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+// Package otlp converts between OpenTelemetry log records and clogger Messages, so that the
+// otlp input and output agree on how the OTLP data model maps onto ParsedFields
+package otlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	// RESOURCE_PREFIX is prepended to resource attributes, e.g. `resource.service.name`
+	RESOURCE_PREFIX = "resource."
+
+	SCOPE_NAME_FIELD      = "scope.name"
+	SCOPE_VERSION_FIELD   = "scope.version"
+	SEVERITY_FIELD        = "severity"
+	SEVERITY_NUMBER_FIELD = "severity_number"
+	TRACE_ID_FIELD        = "trace_id"
+	SPAN_ID_FIELD         = "span_id"
+)
+
+// severityNumbers maps severity texts onto the base severity number of their range
+var severityNumbers = map[string]logspb.SeverityNumber{
+	"trace":   logspb.SeverityNumber_SEVERITY_NUMBER_TRACE,
+	"debug":   logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG,
+	"info":    logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+	"warn":    logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+	"warning": logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+	"error":   logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	"fatal":   logspb.SeverityNumber_SEVERITY_NUMBER_FATAL,
+}
+
+// ToMessages flattens the given OTLP logs into Messages. The body becomes the message field, log attributes become
+// top level fields, resource attributes get prefixed with RESOURCE_PREFIX, and the instrumentation scope,
+// severity, and trace context get their own fields
+func ToMessages(resourceLogs []*logspb.ResourceLogs) []clogger.Message {
+	messages := []clogger.Message{}
+	for _, resourceLog := range resourceLogs {
+		resourceFields := attributesToMap(resourceLog.GetResource().GetAttributes())
+		for _, scopeLog := range scopeLogs(resourceLog) {
+			scope := scopeLog.GetScope()
+			for _, record := range scopeLog.GetLogRecords() {
+				message := clogger.NewMessage()
+				if record.TimeUnixNano != 0 {
+					message.EventTime = time.Unix(0, int64(record.TimeUnixNano))
+				}
+
+				for key, value := range attributesToMap(record.GetAttributes()) {
+					message.ParsedFields[key] = value
+				}
+
+				for key, value := range resourceFields {
+					message.ParsedFields[RESOURCE_PREFIX+key] = value
+				}
+
+				if scope.GetName() != "" {
+					message.ParsedFields[SCOPE_NAME_FIELD] = scope.GetName()
+				}
+
+				if scope.GetVersion() != "" {
+					message.ParsedFields[SCOPE_VERSION_FIELD] = scope.GetVersion()
+				}
+
+				if record.SeverityText != "" {
+					message.ParsedFields[SEVERITY_FIELD] = record.SeverityText
+				}
+
+				if record.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+					message.ParsedFields[SEVERITY_NUMBER_FIELD] = int64(record.SeverityNumber)
+				}
+
+				if len(record.TraceId) > 0 {
+					message.ParsedFields[TRACE_ID_FIELD] = hex.EncodeToString(record.TraceId)
+				}
+
+				if len(record.SpanId) > 0 {
+					message.ParsedFields[SPAN_ID_FIELD] = hex.EncodeToString(record.SpanId)
+				}
+
+				if record.Body != nil {
+					message.ParsedFields[clogger.MESSAGE_FIELD] = anyValueToInterface(record.Body)
+				}
+
+				messages = append(messages, message)
+			}
+		}
+	}
+
+	return messages
+}
+
+// scopeLogs returns the scope logs of the given resource, converting any from senders that still use the deprecated
+// InstrumentationLibraryLogs
+func scopeLogs(resourceLog *logspb.ResourceLogs) []*logspb.ScopeLogs {
+	scopeLogs := resourceLog.GetScopeLogs()
+	for _, libraryLog := range resourceLog.GetInstrumentationLibraryLogs() {
+		scopeLogs = append(scopeLogs, &logspb.ScopeLogs{
+			Scope: &commonpb.InstrumentationScope{
+				Name:    libraryLog.GetInstrumentationLibrary().GetName(),
+				Version: libraryLog.GetInstrumentationLibrary().GetVersion(),
+			},
+			LogRecords: libraryLog.GetLogRecords(),
+			SchemaUrl:  libraryLog.GetSchemaUrl(),
+		})
+	}
+
+	return scopeLogs
+}
+
+// FromMessages is the inverse of ToMessages, grouping the given messages by their resource and scope
+func FromMessages(messages []clogger.Message) []*logspb.ResourceLogs {
+	resourceLogs := []*logspb.ResourceLogs{}
+	resourceIndex := map[string]*logspb.ResourceLogs{}
+	scopeIndex := map[string]*logspb.ScopeLogs{}
+
+	for i := range messages {
+		message := &messages[i]
+		resourceAttributes := []*commonpb.KeyValue{}
+		scope := &commonpb.InstrumentationScope{}
+		record := &logspb.LogRecord{}
+		if !message.EventTime.IsZero() {
+			record.TimeUnixNano = uint64(message.EventTime.UnixNano())
+		}
+
+		for key, value := range message.ParsedFields {
+			switch {
+			case strings.HasPrefix(key, RESOURCE_PREFIX):
+				resourceAttributes = append(resourceAttributes, &commonpb.KeyValue{
+					Key:   strings.TrimPrefix(key, RESOURCE_PREFIX),
+					Value: interfaceToAnyValue(value),
+				})
+			case key == SCOPE_NAME_FIELD:
+				scope.Name = fmt.Sprint(value)
+			case key == SCOPE_VERSION_FIELD:
+				scope.Version = fmt.Sprint(value)
+			case key == SEVERITY_FIELD:
+				record.SeverityText = fmt.Sprint(value)
+			case key == SEVERITY_NUMBER_FIELD:
+				if number, ok := toInt64(value); ok {
+					record.SeverityNumber = logspb.SeverityNumber(number)
+				}
+			case key == TRACE_ID_FIELD:
+				record.TraceId = decodeID(value, 16)
+			case key == SPAN_ID_FIELD:
+				record.SpanId = decodeID(value, 8)
+			case key == clogger.MESSAGE_FIELD:
+				record.Body = interfaceToAnyValue(value)
+			default:
+				record.Attributes = append(record.Attributes, &commonpb.KeyValue{
+					Key:   key,
+					Value: interfaceToAnyValue(value),
+				})
+			}
+		}
+
+		if record.SeverityNumber == logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED && record.SeverityText != "" {
+			record.SeverityNumber = severityNumbers[strings.ToLower(record.SeverityText)]
+		}
+
+		// Sort everything so that the output (and the resource keys) are stable
+		sort.Slice(resourceAttributes, func(i, j int) bool {
+			return resourceAttributes[i].Key < resourceAttributes[j].Key
+		})
+
+		sort.Slice(record.Attributes, func(i, j int) bool {
+			return record.Attributes[i].Key < record.Attributes[j].Key
+		})
+
+		resourceKey := attributesKey(resourceAttributes)
+		resourceLog, ok := resourceIndex[resourceKey]
+		if !ok {
+			resourceLog = &logspb.ResourceLogs{
+				Resource: &resourcepb.Resource{
+					Attributes: resourceAttributes,
+				},
+			}
+
+			resourceIndex[resourceKey] = resourceLog
+			resourceLogs = append(resourceLogs, resourceLog)
+		}
+
+		scopeKey := resourceKey + "\x00" + scope.Name + "\x00" + scope.Version
+		scopeLog, ok := scopeIndex[scopeKey]
+		if !ok {
+			scopeLog = &logspb.ScopeLogs{
+				Scope: scope,
+			}
+
+			scopeIndex[scopeKey] = scopeLog
+			resourceLog.ScopeLogs = append(resourceLog.ScopeLogs, scopeLog)
+		}
+
+		scopeLog.LogRecords = append(scopeLog.LogRecords, record)
+	}
+
+	return resourceLogs
+}
+
+// attributesKey generates a key that uniquely identifies the given (sorted) attributes
+func attributesKey(attributes []*commonpb.KeyValue) string {
+	var builder strings.Builder
+	for _, attribute := range attributes {
+		builder.WriteString(attribute.Key)
+		builder.WriteByte('=')
+		builder.WriteString(fmt.Sprint(anyValueToInterface(attribute.Value)))
+		builder.WriteByte(0)
+	}
+
+	return builder.String()
+}
+
+// decodeID decodes a hex encoded trace or span ID, returning nil if it isn't valid
+func decodeID(value interface{}, length int) []byte {
+	s, ok := value.(string)
+	if !ok {
+		return nil
+	}
+
+	id, err := hex.DecodeString(s)
+	if err != nil || len(id) != length {
+		return nil
+	}
+
+	return id
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	}
+
+	return 0, false
+}
+
+func attributesToMap(attributes []*commonpb.KeyValue) map[string]interface{} {
+	fields := make(map[string]interface{}, len(attributes))
+	for _, attribute := range attributes {
+		fields[attribute.Key] = anyValueToInterface(attribute.Value)
+	}
+
+	return fields
+}
+
+func anyValueToInterface(value *commonpb.AnyValue) interface{} {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return v.BytesValue
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]interface{}, 0, len(v.ArrayValue.GetValues()))
+		for _, value := range v.ArrayValue.GetValues() {
+			values = append(values, anyValueToInterface(value))
+		}
+
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		return attributesToMap(v.KvlistValue.GetValues())
+	}
+
+	return nil
+}
+
+func interfaceToAnyValue(value interface{}) *commonpb.AnyValue {
+	switch v := value.(type) {
+	case nil:
+		return &commonpb.AnyValue{}
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case float32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case []byte:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: v}}
+	case time.Time:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Format(time.RFC3339Nano)}}
+	case []interface{}:
+		values := make([]*commonpb.AnyValue, 0, len(v))
+		for _, value := range v {
+			values = append(values, interfaceToAnyValue(value))
+		}
+
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]interface{}:
+		values := make([]*commonpb.KeyValue, 0, len(v))
+		for key, value := range v {
+			values = append(values, &commonpb.KeyValue{Key: key, Value: interfaceToAnyValue(value)})
+		}
+
+		sort.Slice(values, func(i, j int) bool {
+			return values[i].Key < values[j].Key
+		})
+
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: values}}}
+	}
+
+	if i, ok := toInt64(value); ok {
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: i}}
+	}
+
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(value)}}
+}
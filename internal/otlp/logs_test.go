@@ -0,0 +1,90 @@
+package otlp_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/otlp"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+func TestFromMessagesGroupsByResource(t *testing.T) {
+	messages := []clogger.Message{}
+	for _, service := range []string{"api", "web", "api"} {
+		msg := clogger.NewMessage()
+		msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello from " + service
+		msg.ParsedFields["resource.service.name"] = service
+		msg.ParsedFields["scope.name"] = "clogger"
+		msg.ParsedFields["severity"] = "ERROR"
+		msg.ParsedFields["trace_id"] = "0102030405060708090a0b0c0d0e0f10"
+		msg.ParsedFields["status"] = int64(500)
+		messages = append(messages, msg)
+	}
+
+	resourceLogs := otlp.FromMessages(messages)
+	if len(resourceLogs) != 2 {
+		t.Fatalf("Expected 2 resources, got %d", len(resourceLogs))
+	}
+
+	api := resourceLogs[0]
+	if len(api.ScopeLogs) != 1 || len(api.ScopeLogs[0].LogRecords) != 2 {
+		t.Fatalf("Expected both api messages to be grouped together, got %v", api)
+	}
+
+	record := api.ScopeLogs[0].LogRecords[0]
+	if record.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_ERROR {
+		t.Errorf("Expected the severity number to be derived from the text, got %s", record.SeverityNumber)
+	}
+
+	if len(record.TraceId) != 16 {
+		t.Errorf("Expected the trace ID to be decoded, got %v", record.TraceId)
+	}
+
+	roundTripped := otlp.ToMessages(resourceLogs)
+	if len(roundTripped) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(roundTripped))
+	}
+
+	for key, value := range messages[0].ParsedFields {
+		if key == "severity_number" {
+			continue
+		}
+
+		if roundTripped[0].ParsedFields[key] != value {
+			t.Errorf("Expected %s to round trip as %v, got %v", key, value, roundTripped[0].ParsedFields[key])
+		}
+	}
+
+	if !roundTripped[0].EventTime.Equal(messages[0].EventTime) {
+		t.Errorf("Expected the timestamp to round trip")
+	}
+}
+
+func TestJSONUsesHexIDs(t *testing.T) {
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "test"
+	msg.ParsedFields["trace_id"] = "5b8efff798038103d269b633813fc60c"
+	msg.ParsedFields["span_id"] = "eee19b7ec3c1b174"
+
+	data, err := otlp.MarshalJSON(&logspb.LogsData{ResourceLogs: otlp.FromMessages([]clogger.Message{msg})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{`"scopeLogs"`, `"logRecords"`, `"traceId":"5b8efff798038103d269b633813fc60c"`, `"spanId":"eee19b7ec3c1b174"`} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %s in the encoded JSON, got %s", expected, data)
+		}
+	}
+
+	decoded := &logspb.LogsData{}
+	if err := otlp.UnmarshalJSON(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	roundTripped := otlp.ToMessages(decoded.ResourceLogs)
+	if len(roundTripped) != 1 || roundTripped[0].ParsedFields["trace_id"] != msg.ParsedFields["trace_id"] || roundTripped[0].ParsedFields["span_id"] != msg.ParsedFields["span_id"] {
+		t.Fatalf("Expected the IDs to round trip, got %v", roundTripped)
+	}
+}
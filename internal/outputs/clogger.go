@@ -0,0 +1,213 @@
+package outputs
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/forwarding"
+	"github.com/sinkingpoint/clogger/internal/inputs"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const DEFAULT_CLOGGER_TIMEOUT = 30 * time.Second
+
+type CloggerOutputConfig struct {
+	SendConfig
+	Destination string
+	Compression forwarding.Compression
+	UseTLS      bool
+	TLS         *clogger.TLSConfig
+
+	// Timeout is how long we wait for a batch to be acked before giving up and resending it
+	Timeout time.Duration
+}
+
+func newCloggerOutputConfigFromRaw(rawConf map[string]string) (CloggerOutputConfig, error) {
+	conf, err := NewSendConfigFromRaw(rawConf)
+	if err != nil {
+		return CloggerOutputConfig{}, err
+	}
+
+	tlsConf, err := clogger.NewTLSConfigFromRaw(rawConf)
+	if err != nil {
+		return CloggerOutputConfig{}, err
+	}
+
+	cloggerConf := CloggerOutputConfig{
+		SendConfig:  conf,
+		Destination: inputs.DEFAULT_CLOGGER_LISTEN_ADDR,
+		Compression: forwarding.COMPRESSION_SNAPPY,
+		UseTLS:      tlsConf.IsEnabled(),
+		TLS:         &tlsConf,
+		Timeout:     DEFAULT_CLOGGER_TIMEOUT,
+	}
+
+	if destination, ok := rawConf["destination"]; ok {
+		cloggerConf.Destination = destination
+	}
+
+	if compression, ok := rawConf["compression"]; ok {
+		cloggerConf.Compression, err = forwarding.ParseCompression(compression)
+		if err != nil {
+			return CloggerOutputConfig{}, err
+		}
+	}
+
+	if t, ok := rawConf["tls"]; ok {
+		cloggerConf.UseTLS, err = strconv.ParseBool(t)
+		if err != nil {
+			return CloggerOutputConfig{}, fmt.Errorf("invalid bool `%s` for `tls` in clogger output - expected true or false", t)
+		}
+	}
+
+	if timeout, ok := rawConf["timeout"]; ok {
+		cloggerConf.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return CloggerOutputConfig{}, err
+		}
+	}
+
+	return cloggerConf, nil
+}
+
+// CloggerOutput is an Outputter that forwards batches to another clogger instance over the native forwarding protocol,
+// only considering a batch sent once the receiver has acked it
+type CloggerOutput struct {
+	conf   CloggerOutputConfig
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// lastBatchID is the ID of the last batch we sent. IDs only need to be unique within a connection
+	lastBatchID uint64
+}
+
+func NewCloggerOutput(conf CloggerOutputConfig) (*CloggerOutput, error) {
+	return &CloggerOutput{
+		conf: conf,
+	}, nil
+}
+
+func (c *CloggerOutput) GetSendConfig() SendConfig {
+	return c.conf.SendConfig
+}
+
+func (c *CloggerOutput) Close(ctx context.Context) error {
+	if c.conn != nil {
+		err := c.conn.Close()
+		c.conn = nil
+		c.reader = nil
+		return err
+	}
+
+	return nil
+}
+
+func (c *CloggerOutput) connect() error {
+	dialer := net.Dialer{
+		Timeout: c.conf.Timeout,
+	}
+
+	var conn net.Conn
+	var err error
+	if c.conf.UseTLS {
+		conn, err = tls.DialWithDialer(&dialer, "tcp", c.conf.Destination, c.conf.TLS.ClientConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", c.conf.Destination)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := forwarding.WritePreamble(conn); err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	return nil
+}
+
+func (c *CloggerOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	_, span := tracing.GetTracer().Start(ctx, "CloggerOutput.FlushToOutput")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch_size", len(messages.Messages)))
+	if len(messages.Messages) == 0 {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	payload, err := forwarding.EncodeBatch(messages.Messages)
+	if err != nil {
+		return OUTPUT_REJECTED, err
+	}
+
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return OUTPUT_TRANSIENT_FAILURE, err
+		}
+	}
+
+	c.lastBatchID += 1
+	batchID := c.lastBatchID
+	span.SetAttributes(attribute.Int64("batch_id", int64(batchID)))
+
+	c.conn.SetDeadline(time.Now().Add(c.conf.Timeout))
+	defer func() {
+		if c.conn != nil {
+			c.conn.SetDeadline(time.Time{})
+		}
+	}()
+
+	if err := forwarding.WriteFrame(c.conn, forwarding.Frame{
+		Type:        forwarding.FRAME_BATCH,
+		Compression: c.conf.Compression,
+		BatchID:     batchID,
+		Payload:     payload,
+	}); err != nil {
+		c.Close(ctx)
+		return OUTPUT_TRANSIENT_FAILURE, err
+	}
+
+	reply, err := forwarding.ReadFrame(c.reader)
+	if err != nil {
+		// We don't know whether the receiver got the batch or not, so we have to resend it
+		c.Close(ctx)
+		return OUTPUT_TRANSIENT_FAILURE, err
+	}
+
+	if reply.BatchID != batchID {
+		c.Close(ctx)
+		return OUTPUT_TRANSIENT_FAILURE, fmt.Errorf("got %s for batch %d, expected %d", reply.Type.ToString(), reply.BatchID, batchID)
+	}
+
+	switch reply.Type {
+	case forwarding.FRAME_ACK:
+		return OUTPUT_SUCCESS, nil
+	case forwarding.FRAME_NACK:
+		return OUTPUT_REJECTED, fmt.Errorf("receiver rejected batch %d: %s", batchID, string(reply.Payload))
+	default:
+		c.Close(ctx)
+		return OUTPUT_TRANSIENT_FAILURE, fmt.Errorf("got unexpected %s frame from receiver", reply.Type.ToString())
+	}
+}
+
+func init() {
+	outputsRegistry.Register("clogger", func(rawConf map[string]string) (interface{}, error) {
+		return newCloggerOutputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Outputter, error) {
+		if c, ok := conf.(CloggerOutputConfig); ok {
+			return NewCloggerOutput(c)
+		}
+
+		return nil, fmt.Errorf("invalid config passed to clogger output")
+	})
+}
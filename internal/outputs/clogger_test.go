@@ -0,0 +1,142 @@
+package outputs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+)
+
+func TestCloggerForwardingRoundTrip(t *testing.T) {
+	for _, compression := range []string{"none", "snappy", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			input, err := inputs.Construct("clogger", map[string]string{
+				"listen": "127.0.0.1:0",
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := input.Init(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			defer input.Close(context.Background())
+
+			output, err := outputs.Construct("clogger", map[string]string{
+				"destination": input.(*inputs.CloggerInput).Addr().String(),
+				"compression": compression,
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer output.Close(context.Background())
+
+			msg := clogger.NewMessage()
+			msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+			msg.ParsedFields["status"] = int64(200)
+			msg.ParsedFields["duration"] = 1.5
+
+			// Send a couple of batches over the same connection
+			for i := 0; i < 2; i++ {
+				batch := clogger.SizeOneBatch(msg)
+				if result, err := output.FlushToOutput(context.Background(), batch); result != outputs.OUTPUT_SUCCESS {
+					t.Fatalf("Failed to flush to clogger output: %s", err)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				received, err := input.GetBatch(ctx)
+				cancel()
+
+				if err != nil || received == nil || len(received.Messages) != 1 {
+					t.Fatalf("Failed to receive batch: %v", err)
+				}
+
+				if !received.Messages[0].EventTime.Equal(msg.EventTime) {
+					t.Errorf("Expected the timestamp to round trip")
+				}
+
+				for key, value := range msg.ParsedFields {
+					if received.Messages[0].ParsedFields[key] != value {
+						t.Errorf("Expected %s to be %v (%T), got %v (%T)", key, value, value, received.Messages[0].ParsedFields[key], received.Messages[0].ParsedFields[key])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCloggerOutputUnreachable(t *testing.T) {
+	output, err := outputs.Construct("clogger", map[string]string{
+		"destination": freePort(t),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result, _ := output.FlushToOutput(context.Background(), clogger.SizeOneBatch(clogger.NewMessage())); result != outputs.OUTPUT_TRANSIENT_FAILURE {
+		t.Fatalf("Expected a transient failure, got %s", result.ToString())
+	}
+}
+
+func TestCloggerInputCloseWithStalledPipeline(t *testing.T) {
+	input, err := inputs.Construct("clogger", map[string]string{
+		"listen": "127.0.0.1:0",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := input.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := outputs.Construct("clogger", map[string]string{
+		"destination": input.(*inputs.CloggerInput).Addr().String(),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer output.Close(context.Background())
+
+	// Send more messages than the input can buffer, without ever reading a batch
+	batch := clogger.GetMessageBatch(20)
+	for i := 0; i < 20; i++ {
+		msg := clogger.NewMessage()
+		msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+		batch.Messages = append(batch.Messages, msg)
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		output.FlushToOutput(context.Background(), batch)
+		close(flushed)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		input.Close(context.Background())
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the clogger input to close")
+	}
+
+	// The batch was never acked, so the flush fails once the input closes the connection
+	<-flushed
+}
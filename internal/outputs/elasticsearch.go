@@ -0,0 +1,290 @@
+package outputs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const DEFAULT_ELASTICSEARCH_URL = "http://localhost:9200"
+const DEFAULT_ELASTICSEARCH_INDEX = "clogger-%Y.%m.%d"
+const DEFAULT_ELASTICSEARCH_TIMEOUT = 30 * time.Second
+
+type ElasticsearchOutputConfig struct {
+	SendConfig
+
+	// URL is the base URL of the Elasticsearch/OpenSearch cluster, e.g. http://localhost:9200
+	URL string
+
+	// Index is the template used to generate the index name for each message
+	Index *FieldTemplate
+
+	// IDField is the (optional) field to use as the document ID, so that retries don't create duplicates
+	IDField string
+
+	// Action is the bulk action to use for each document, either `index` or `create`
+	Action string
+
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+func newElasticsearchOutputConfigFromRaw(rawConf map[string]string) (ElasticsearchOutputConfig, error) {
+	conf, err := NewSendConfigFromRaw(rawConf)
+	if err != nil {
+		return ElasticsearchOutputConfig{}, err
+	}
+
+	esConf := ElasticsearchOutputConfig{
+		SendConfig: conf,
+		URL:        DEFAULT_ELASTICSEARCH_URL,
+		Action:     "index",
+		IDField:    rawConf["id_field"],
+		Username:   rawConf["username"],
+		Password:   rawConf["password"],
+		Timeout:    DEFAULT_ELASTICSEARCH_TIMEOUT,
+	}
+
+	if url, ok := rawConf["url"]; ok {
+		esConf.URL = strings.TrimSuffix(url, "/")
+	}
+
+	index := DEFAULT_ELASTICSEARCH_INDEX
+	if i, ok := rawConf["index"]; ok {
+		index = i
+	}
+
+	esConf.Index, err = NewFieldTemplate(index)
+	if err != nil {
+		return ElasticsearchOutputConfig{}, err
+	}
+
+	if action, ok := rawConf["action"]; ok {
+		if action != "index" && action != "create" {
+			return ElasticsearchOutputConfig{}, fmt.Errorf("invalid `action` for Elasticsearch output - expected `index` or `create`, got `%s`", action)
+		}
+
+		esConf.Action = action
+	}
+
+	if timeout, ok := rawConf["timeout"]; ok {
+		esConf.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return ElasticsearchOutputConfig{}, err
+		}
+	}
+
+	return esConf, nil
+}
+
+// bulkResponse is the subset of the `_bulk` API response that we care about
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkResponseItem `json:"items"`
+}
+
+type bulkResponseItem struct {
+	Index  string          `json:"_index"`
+	ID     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// ElasticsearchOutput is an Outputter that pushes messages to Elasticsearch (or OpenSearch)
+// using the `_bulk` API
+type ElasticsearchOutput struct {
+	conf   ElasticsearchOutputConfig
+	client *http.Client
+}
+
+func NewElasticsearchOutput(conf ElasticsearchOutputConfig) (*ElasticsearchOutput, error) {
+	return &ElasticsearchOutput{
+		conf: conf,
+		client: &http.Client{
+			Timeout: conf.Timeout,
+		},
+	}, nil
+}
+
+func (e *ElasticsearchOutput) GetSendConfig() SendConfig {
+	return e.conf.SendConfig
+}
+
+func (e *ElasticsearchOutput) Close(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// buildBulkBody constructs the ndjson body of a bulk request from the given messages, returning
+// the body and the indexes of the messages that were added to it (in order)
+func (e *ElasticsearchOutput) buildBulkBody(messages []clogger.Message) ([]byte, []int) {
+	body := bytes.Buffer{}
+	sent := make([]int, 0, len(messages))
+
+	for i := range messages {
+		msg := &messages[i]
+		index, err := e.conf.Index.Render(msg, msg.EventTime.UTC())
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to generate index for message")
+			continue
+		}
+
+		meta := map[string]string{
+			"_index": index,
+		}
+
+		if e.conf.IDField != "" {
+			if id, ok := msg.ParsedFields[e.conf.IDField]; ok {
+				meta["_id"] = fmt.Sprint(id)
+			}
+		}
+
+		action, err := json.Marshal(map[string]interface{}{
+			e.conf.Action: meta,
+		})
+
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to format bulk action")
+			continue
+		}
+
+		data, err := e.conf.Formatter.Format(msg)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to format message")
+			continue
+		}
+
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(bytes.TrimRight(data, "\n"))
+		body.WriteByte('\n')
+		sent = append(sent, i)
+	}
+
+	return body.Bytes(), sent
+}
+
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+func (e *ElasticsearchOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	ctx, span := tracing.GetTracer().Start(ctx, "ElasticsearchOutput.FlushToOutput")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch_size", len(messages.Messages)))
+
+	body, sent := e.buildBulkBody(messages.Messages)
+	if len(sent) == 0 {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.conf.URL+"/_bulk", bytes.NewReader(body))
+	if err != nil {
+		return OUTPUT_LONG_FAILURE, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if e.conf.Username != "" {
+		req.SetBasicAuth(e.conf.Username, e.conf.Password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return OUTPUT_TRANSIENT_FAILURE, err
+	}
+
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return OUTPUT_TRANSIENT_FAILURE, err
+	}
+
+	if isRetryableStatus(resp.StatusCode) {
+		return OUTPUT_TRANSIENT_FAILURE, fmt.Errorf("bulk request failed with status %d", resp.StatusCode)
+	} else if resp.StatusCode >= 300 {
+		return OUTPUT_LONG_FAILURE, fmt.Errorf("bulk request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var bulkResp bulkResponse
+	if err := json.Unmarshal(respBody, &bulkResp); err != nil {
+		return OUTPUT_LONG_FAILURE, fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+
+	if !bulkResp.Errors {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	if len(bulkResp.Items) != len(sent) {
+		return OUTPUT_TRANSIENT_FAILURE, fmt.Errorf("bulk response had %d items, expected %d", len(bulkResp.Items), len(sent))
+	}
+
+	// Compact the batch down to just the retryable documents, and split the permanently rejected ones out to be dead lettered
+	retryable := 0
+	rejected := []clogger.Message{}
+	var firstError error
+	for i, item := range bulkResp.Items {
+		for _, result := range item {
+			if result.Status < 300 || (result.Status == http.StatusConflict && e.conf.Action == "create") {
+				// A conflict on create means that the document already exists, i.e. a previous attempt made it through
+				continue
+			}
+
+			if firstError == nil {
+				firstError = fmt.Errorf("document rejected with status %d: %s", result.Status, string(result.Error))
+			}
+
+			if isRetryableStatus(result.Status) {
+				messages.Messages[retryable] = messages.Messages[sent[i]]
+				retryable += 1
+			} else {
+				rejected = append(rejected, messages.Messages[sent[i]])
+			}
+		}
+	}
+
+	messages.Messages = messages.Messages[:retryable]
+
+	span.SetAttributes(attribute.Int("retryable", retryable), attribute.Int("rejected", len(rejected)))
+
+	switch {
+	case retryable > 0 && len(rejected) > 0:
+		rejectedBatch := clogger.GetMessageBatch(len(rejected))
+		rejectedBatch.Messages = append(rejectedBatch.Messages, rejected...)
+		return OUTPUT_TRANSIENT_FAILURE, &PartialRejectionError{Rejected: rejectedBatch, Err: firstError}
+	case retryable > 0:
+		return OUTPUT_TRANSIENT_FAILURE, firstError
+	case len(rejected) > 0:
+		messages.Messages = append(messages.Messages, rejected...)
+		return OUTPUT_REJECTED, firstError
+	}
+
+	return OUTPUT_SUCCESS, nil
+}
+
+func init() {
+	// OpenSearch speaks the same bulk API, so we just register it as an alias
+	for _, name := range []string{"elasticsearch", "opensearch"} {
+		outputsRegistry.Register(name, func(rawConf map[string]string) (interface{}, error) {
+			return newElasticsearchOutputConfigFromRaw(rawConf)
+		}, func(conf interface{}) (Outputter, error) {
+			if c, ok := conf.(ElasticsearchOutputConfig); ok {
+				return NewElasticsearchOutput(c)
+			}
+
+			return nil, fmt.Errorf("invalid config passed to elasticsearch output")
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package outputs_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+)
+
+// newBulkServer constructs a stand in for the `_bulk` API that rejects any documents
+// with a `status` field with that status
+func newBulkServer(t *testing.T, indexes *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			t.Errorf("Expected request to /_bulk, got %s", r.URL.Path)
+		}
+
+		scanner := bufio.NewScanner(r.Body)
+		items := []map[string]interface{}{}
+		hasErrors := false
+		for scanner.Scan() {
+			action := map[string]map[string]string{}
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				t.Errorf("Failed to parse action: %s", err)
+				return
+			}
+
+			scanner.Scan()
+			doc := map[string]interface{}{}
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+				t.Errorf("Failed to parse document: %s", err)
+				return
+			}
+
+			*indexes = append(*indexes, action["index"]["_index"])
+
+			status := 201
+			if s, ok := doc["status"]; ok {
+				status = int(s.(float64))
+				hasErrors = true
+			}
+
+			items = append(items, map[string]interface{}{
+				"index": map[string]interface{}{
+					"_index": action["index"]["_index"],
+					"status": status,
+				},
+			})
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"errors": hasErrors,
+			"items":  items,
+		})
+	}))
+}
+
+func newTestElasticsearchOutput(t *testing.T, url string) *outputs.ElasticsearchOutput {
+	index, err := outputs.NewFieldTemplate("logs-{service}-%Y")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := outputs.NewElasticsearchOutput(outputs.ElasticsearchOutputConfig{
+		SendConfig: outputs.SendConfig{
+			Formatter: &format.JSONFormatter{},
+		},
+		URL:     url,
+		Index:   index,
+		Action:  "index",
+		Timeout: time.Second,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output
+}
+
+func TestElasticsearchOutputRetriesOnlyFailedDocuments(t *testing.T) {
+	indexes := []string{}
+	server := newBulkServer(t, &indexes)
+	defer server.Close()
+
+	output := newTestElasticsearchOutput(t, server.URL)
+	batch := clogger.GetMessageBatch(4)
+	for _, status := range []int{0, 429, 0, 400} {
+		msg := clogger.NewMessage()
+		msg.ParsedFields["service"] = "test"
+		if status != 0 {
+			msg.ParsedFields["status"] = status
+		}
+		batch.Messages = append(batch.Messages, msg)
+	}
+
+	result, err := output.FlushToOutput(context.Background(), batch)
+	if result != outputs.OUTPUT_TRANSIENT_FAILURE {
+		t.Fatalf("Expected a transient failure, got %s", result.ToString())
+	}
+
+	if len(batch.Messages) != 1 || batch.Messages[0].ParsedFields["status"] != 429 {
+		t.Fatalf("Expected the batch to be compacted to the retryable document, got %v", batch.Messages)
+	}
+
+	// The rejected document is split out to be dead lettered, rather than retried
+	var rejection *outputs.PartialRejectionError
+	if !errors.As(err, &rejection) || len(rejection.Rejected.Messages) != 1 || rejection.Rejected.Messages[0].ParsedFields["status"] != 400 {
+		t.Fatalf("Expected the rejected document to be returned separately, got %v", err)
+	}
+
+	expectedIndex := fmt.Sprintf("logs-test-%d", time.Now().UTC().Year())
+	if indexes[0] != expectedIndex {
+		t.Errorf("Expected index `%s`, got `%s`", expectedIndex, indexes[0])
+	}
+
+	// A batch of only rejected documents is rejected as a whole
+	batch.Messages = append(batch.Messages[:0], rejection.Rejected.Messages...)
+	result, _ = output.FlushToOutput(context.Background(), batch)
+	if result != outputs.OUTPUT_REJECTED {
+		t.Fatalf("Expected the remaining document to be rejected, got %s", result.ToString())
+	}
+}
+
+func TestElasticsearchOutputSkipsMessagesMissingIndexFields(t *testing.T) {
+	indexes := []string{}
+	server := newBulkServer(t, &indexes)
+	defer server.Close()
+
+	output := newTestElasticsearchOutput(t, server.URL)
+	batch := clogger.GetMessageBatch(2)
+	batch.Messages = append(batch.Messages, clogger.NewMessage(), clogger.NewMessage())
+	batch.Messages[0].ParsedFields["service"] = "test"
+
+	result, _ := output.FlushToOutput(context.Background(), batch)
+	if result != outputs.OUTPUT_SUCCESS {
+		t.Fatalf("Expected success, got %s", result.ToString())
+	}
+
+	if len(indexes) != 1 || !strings.HasPrefix(indexes[0], "logs-test-") {
+		t.Fatalf("Expected one document to be sent, got %v", indexes)
+	}
+}
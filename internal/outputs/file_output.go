@@ -1,22 +1,60 @@
 package outputs
 
 import (
+	"container/list"
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/sinkingpoint/clogger/internal/clogger"
 )
 
+const DEFAULT_MAX_OPEN_FILES = 64
+const DEFAULT_FILE_IDLE_TIMEOUT = 5 * time.Minute
+
 type FileOutputConfig struct {
 	SendConfig
-	Path string
+	Rotation RotationConfig
+
+	// Path is the template used to generate the path of the file each message gets written to
+	// e.g. `/logs/{host}/{service}/%Y-%m-%d.log`
+	Path *FieldTemplate
+
+	// MaxOpenFiles is the maximum number of file handles to keep open at once
+	MaxOpenFiles int
+
+	// IdleTimeout is how long a file handle can go without being written to before it gets closed
+	IdleTimeout time.Duration
+}
+
+// openFile is an entry in the LRU of open file handles
+type openFile struct {
+	path     string
+	file     *rotatingFile
+	lastUsed time.Time
 }
 
 type FileOutput struct {
 	SendConfig
-	file *os.File
+	conf FileOutputConfig
+
+	// filesLock protects the LRU of open files, which gets touched both by flushes and the idle/SIGHUP handling
+	filesLock sync.Mutex
+	files     map[string]*list.Element
+	lru       *list.List
+
+	sighup  chan os.Signal
+	closing chan struct{}
+
+	compressions sync.WaitGroup
 }
 
 func newFileOutputConfigFromRaw(rawConf map[string]string) (FileOutputConfig, error) {
@@ -25,31 +63,200 @@ func newFileOutputConfigFromRaw(rawConf map[string]string) (FileOutputConfig, er
 		return FileOutputConfig{}, err
 	}
 
+	rotation, err := NewRotationConfigFromRaw(rawConf)
+	if err != nil {
+		return FileOutputConfig{}, err
+	}
+
+	fileConf := FileOutputConfig{
+		SendConfig:   conf,
+		Rotation:     rotation,
+		MaxOpenFiles: DEFAULT_MAX_OPEN_FILES,
+		IdleTimeout:  DEFAULT_FILE_IDLE_TIMEOUT,
+	}
+
+	if s, ok := rawConf["max_open_files"]; ok {
+		fileConf.MaxOpenFiles, err = strconv.Atoi(s)
+		if err != nil || fileConf.MaxOpenFiles <= 0 {
+			return FileOutputConfig{}, fmt.Errorf("invalid `max_open_files` for FileOutput - expected a positive int, got `%s`", s)
+		}
+	}
+
+	if s, ok := rawConf["idle_timeout"]; ok {
+		fileConf.IdleTimeout, err = time.ParseDuration(s)
+		if err != nil {
+			return FileOutputConfig{}, err
+		}
+	}
+
 	if path, ok := rawConf["path"]; ok {
-		return FileOutputConfig{
-			SendConfig: conf,
-			Path:       path,
-		}, nil
+		fileConf.Path, err = NewFieldTemplate(path)
+		if err != nil {
+			return FileOutputConfig{}, err
+		}
+
+		return fileConf, nil
 	}
 
 	return FileOutputConfig{}, fmt.Errorf("missing `path` required for FileOutput")
 }
 
+// checkPathComponent rejects field values that could be used to escape the templated directory
+func checkPathComponent(value string) error {
+	if value == "" || value == "." || value == ".." {
+		return fmt.Errorf("`%s` is not a valid path component", value)
+	}
+
+	if strings.ContainsAny(value, "/\\\x00") {
+		return fmt.Errorf("path components can't contain separators or null bytes")
+	}
+
+	return nil
+}
+
 func NewFileOutput(conf FileOutputConfig) (*FileOutput, error) {
-	file, err := os.OpenFile(conf.Path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
+	if conf.MaxOpenFiles <= 0 {
+		conf.MaxOpenFiles = DEFAULT_MAX_OPEN_FILES
+	}
+
+	f := &FileOutput{
+		SendConfig: conf.SendConfig,
+		conf:       conf,
+		files:      make(map[string]*list.Element),
+		lru:        list.New(),
+		sighup:     make(chan os.Signal, 1),
+		closing:    make(chan struct{}),
+	}
+
+	// If the path doesn't depend on the messages, open it up front so that we fail fast on a bad path
+	if conf.Path.IsStatic() {
+		path, _ := conf.Path.Render(&clogger.Message{}, time.Now())
+		if _, err := f.getFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reopen the files on SIGHUP so that we play nicely with an external logrotate
+	signal.Notify(f.sighup, syscall.SIGHUP)
+
+	idleCheckInterval := time.Minute
+	if conf.IdleTimeout > 0 && conf.IdleTimeout < idleCheckInterval {
+		idleCheckInterval = conf.IdleTimeout
+	}
+
+	go func() {
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-f.sighup:
+				f.reopenAll()
+			case <-ticker.C:
+				f.closeIdle()
+			case <-f.closing:
+				return
+			}
+		}
+	}()
+
+	return f, nil
+}
+
+// getFile returns the open file for the given path, opening it (and evicting the least recently used file if
+// we have too many open) if necessary. Must be called with the filesLock held
+func (f *FileOutput) getFile(path string) (*rotatingFile, error) {
+	if elem, ok := f.files[path]; ok {
+		f.lru.MoveToFront(elem)
+		open := elem.Value.(*openFile)
+		open.lastUsed = time.Now()
+		return open.file, nil
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
 
+	file, err := openRotatingFile(path, f.conf.Rotation, &f.compressions)
 	if err != nil {
 		return nil, err
 	}
 
-	return &FileOutput{
-		SendConfig: conf.SendConfig,
-		file:       file,
-	}, nil
+	f.files[path] = f.lru.PushFront(&openFile{
+		path:     path,
+		file:     file,
+		lastUsed: time.Now(),
+	})
+
+	for f.lru.Len() > f.conf.MaxOpenFiles {
+		f.closeElement(f.lru.Back())
+	}
+
+	return file, nil
+}
+
+// closeElement closes the file in the given LRU element and removes it. Must be called with the filesLock held
+func (f *FileOutput) closeElement(elem *list.Element) {
+	open := elem.Value.(*openFile)
+	if err := open.file.Close(); err != nil {
+		log.Warn().Err(err).Str("path", open.path).Msg("Failed to close file")
+	}
+
+	f.lru.Remove(elem)
+	delete(f.files, open.path)
+}
+
+// closeIdle closes any files that haven't been written to within the idle timeout
+func (f *FileOutput) closeIdle() {
+	if f.conf.IdleTimeout <= 0 {
+		return
+	}
+
+	f.filesLock.Lock()
+	defer f.filesLock.Unlock()
+
+	for elem := f.lru.Back(); elem != nil; elem = f.lru.Back() {
+		if time.Since(elem.Value.(*openFile).lastUsed) < f.conf.IdleTimeout {
+			break
+		}
+
+		f.closeElement(elem)
+	}
+}
+
+// reopenAll reopens all the open files, e.g. after they've been moved by an external logrotate
+func (f *FileOutput) reopenAll() {
+	f.filesLock.Lock()
+	defer f.filesLock.Unlock()
+
+	for elem := f.lru.Front(); elem != nil; elem = elem.Next() {
+		open := elem.Value.(*openFile)
+		if err := open.file.Reopen(); err != nil {
+			log.Warn().Err(err).Str("path", open.path).Msg("Failed to reopen file")
+		}
+	}
 }
 
 func (f *FileOutput) Close(ctx context.Context) error {
-	return f.file.Close()
+	signal.Stop(f.sighup)
+	close(f.closing)
+
+	f.filesLock.Lock()
+	var firstErr error
+	for elem := f.lru.Front(); elem != nil; elem = elem.Next() {
+		if err := elem.Value.(*openFile).file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	f.files = make(map[string]*list.Element)
+	f.lru.Init()
+	f.filesLock.Unlock()
+
+	f.compressions.Wait()
+
+	return firstErr
 }
 
 func (f *FileOutput) GetSendConfig() SendConfig {
@@ -57,20 +264,48 @@ func (f *FileOutput) GetSendConfig() SendConfig {
 }
 
 func (f *FileOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	f.filesLock.Lock()
+	defer f.filesLock.Unlock()
+
+	touched := make(map[string]struct{})
+
 	for _, msg := range messages.Messages {
+		path, err := f.conf.Path.RenderWith(&msg, msg.EventTime, checkPathComponent)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to generate path for message")
+			continue
+		}
+
+		file, err := f.getFile(path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to open file")
+			continue
+		}
+
+		touched[path] = struct{}{}
+
 		data, err := f.SendConfig.Formatter.Format(&msg)
 		if err != nil {
 			log.Warn().Err(err).Msg("Failed to format message")
 			continue
 		}
 
-		_, err = f.file.Write(data)
+		_, err = file.Write(data)
 		if err != nil {
 			log.Warn().Err(err).Msg("Failed to write message")
 			continue
 		}
 	}
 
+	for path := range touched {
+		// The file might have been evicted from the LRU (and closed) part way through the batch
+		if elem, ok := f.files[path]; ok {
+			if err := elem.Value.(*openFile).file.Flush(); err != nil {
+				log.Warn().Err(err).Str("path", path).Msg("Failed to sync file")
+			}
+		}
+	}
+
 	return OUTPUT_SUCCESS, nil
 }
 
@@ -0,0 +1,140 @@
+package outputs_test
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+)
+
+func TestFileOutputRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+
+	// A rotated file left uncompressed by an earlier run should still fall out of retention
+	if err := ioutil.WriteFile(path+".20000101T000000.000000000", []byte("leftover\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	pathTemplate, err := outputs.NewFieldTemplate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := outputs.NewFileOutput(outputs.FileOutputConfig{
+		SendConfig: outputs.SendConfig{
+			Formatter: &format.JSONFormatter{NewlineDelimited: true},
+		},
+		Rotation: outputs.RotationConfig{
+			// Enough room for exactly one message
+			MaxSize:     20,
+			Compression: outputs.FILE_COMPRESSION_GZIP,
+			MaxFiles:    2,
+		},
+		Path: pathTemplate,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		msg := clogger.NewMessage()
+		msg.ParsedFields[clogger.MESSAGE_FIELD] = "test"
+		if result, err := output.FlushToOutput(context.Background(), clogger.SizeOneBatch(msg)); result != outputs.OUTPUT_SUCCESS {
+			t.Fatalf("Failed to flush: %s", err)
+		}
+	}
+
+	// Close waits for all the compressions to finish
+	if err := output.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 2 {
+		t.Fatalf("Expected 2 rotated files to be retained, got %v", rotated)
+	}
+
+	for _, file := range rotated {
+		if !strings.HasSuffix(file, ".gz") {
+			t.Errorf("Expected rotated file `%s` to be compressed", file)
+			continue
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := ioutil.ReadAll(reader)
+		f.Close()
+		if string(data) != "{\"message\":\"test\"}\n" {
+			t.Errorf("Got unexpected contents in rotated file: %q", string(data))
+		}
+	}
+}
+
+func TestFileOutputTemplatedPaths(t *testing.T) {
+	dir := t.TempDir()
+	pathTemplate, err := outputs.NewFieldTemplate(filepath.Join(dir, "{service}", "%Y.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := outputs.NewFileOutput(outputs.FileOutputConfig{
+		SendConfig: outputs.SendConfig{
+			Formatter: &format.JSONFormatter{NewlineDelimited: true},
+		},
+		Path:         pathTemplate,
+		MaxOpenFiles: 1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := clogger.GetMessageBatch(4)
+	for _, service := range []string{"a", "b", "a", "../escape"} {
+		msg := clogger.NewMessage()
+		msg.ParsedFields["service"] = service
+		batch.Messages = append(batch.Messages, msg)
+	}
+
+	if result, err := output.FlushToOutput(context.Background(), batch); result != outputs.OUTPUT_SUCCESS {
+		t.Fatalf("Failed to flush: %s", err)
+	}
+
+	if err := output.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	year := time.Now().Format("2006")
+	for service, expectedLines := range map[string]int{"a": 2, "b": 1} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, service, year+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if lines := strings.Count(string(data), "\n"); lines != expectedLines {
+			t.Errorf("Expected %d lines for service `%s`, got %d", expectedLines, service, lines)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape")); !os.IsNotExist(err) {
+		t.Error("Expected unsafe path components to be rejected")
+	}
+}
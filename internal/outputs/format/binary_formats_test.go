@@ -0,0 +1,75 @@
+package format_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+)
+
+func TestSelfDescribingFormatsRoundTrip(t *testing.T) {
+	fields := map[string]interface{}{
+		clogger.MESSAGE_FIELD: "hello",
+		"status":              int64(200),
+		"offset":              int64(-1),
+		"duration":            1.5,
+		"ok":                  true,
+		"blob":                []byte{0xde, 0xad, 0xbe, 0xef},
+		"tags":                []interface{}{"a", int64(1)},
+		"nested":              map[string]interface{}{"key": "value"},
+	}
+
+	for _, name := range []string{"msgpack", "cbor"} {
+		for _, framing := range []string{"none", "length"} {
+			t.Run(name+"/"+framing, func(t *testing.T) {
+				args := map[string]string{"framing": framing}
+				formatter, err := format.GetFormatterFromString(name, args)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				parser, err := parse.GetParserFromString(name, args)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				msg := clogger.NewMessage()
+				msg.ParsedFields = fields
+
+				var stream bytes.Buffer
+				for i := 0; i < 2; i++ {
+					data, err := formatter.Format(&msg)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					stream.Write(data)
+				}
+
+				c := make(chan clogger.Message, 10)
+				if err := parser.ParseStream(context.Background(), ioutil.NopCloser(&stream), c); err != nil {
+					t.Fatal(err)
+				}
+
+				close(c)
+
+				numMessages := 0
+				for received := range c {
+					numMessages += 1
+					if !reflect.DeepEqual(received.ParsedFields, fields) {
+						t.Errorf("Message didn't round trip.\nExpected: %#v\nGot:      %#v", fields, received.ParsedFields)
+					}
+				}
+
+				if numMessages != 2 {
+					t.Errorf("Expected 2 messages, got %d", numMessages)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package format
+
+import (
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+)
+
+// BinaryFormatter is a Formatter that formats messages in clogger's binary encoding, each prefixed
+// with its length as a uvarint so that they can be streamed
+type BinaryFormatter struct{}
+
+func (b *BinaryFormatter) Format(m *clogger.Message) ([]byte, error) {
+	encoded, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return frame(parse.FRAMING_LENGTH, encoded), nil
+}
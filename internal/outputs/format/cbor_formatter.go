@@ -0,0 +1,39 @@
+package format
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+)
+
+// CBORFormatter is a Formatter that formats messages as CBOR maps
+type CBORFormatter struct {
+	Framing parse.Framing
+	encMode cbor.EncMode
+}
+
+func NewCBORFormatter(framing parse.Framing) (*CBORFormatter, error) {
+	encMode, err := cbor.EncOptions{
+		Sort:    cbor.SortCanonical,
+		Time:    cbor.TimeRFC3339Nano,
+		TimeTag: cbor.EncTagRequired,
+	}.EncMode()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &CBORFormatter{
+		Framing: framing,
+		encMode: encMode,
+	}, nil
+}
+
+func (c *CBORFormatter) Format(m *clogger.Message) ([]byte, error) {
+	data, err := c.encMode.Marshal(m.ParsedFields)
+	if err != nil {
+		return nil, err
+	}
+
+	return frame(c.Framing, data), nil
+}
@@ -1,51 +1,240 @@
 package format
 
 import (
+	"encoding/json"
 	"fmt"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/sinkingpoint/clogger/internal/clogger"
 )
 
 const termReset = "\033[0m"
+const termRed = "\033[31m"
 const termGreen = "\033[32m"
+const termYellow = "\033[33m"
 const termCyan = "\033[36m"
+const termGray = "\033[90m"
 
+// DEFAULT_CONSOLE_TIME_FORMAT is the layout used for the leading timestamp of console lines
+const DEFAULT_CONSOLE_TIME_FORMAT = "2006-01-02T15:04:05.000Z07:00"
+
+// DEFAULT_CONSOLE_LEVEL_FIELD is the field that console lines get coloured by
+const DEFAULT_CONSOLE_LEVEL_FIELD = "level"
+
+// ConsoleFormatter is a Formatter that formats messages as human readable `<time> <message> key=value...` lines
+// Keys are printed in FieldOrder, followed by the rest of the fields sorted alphabetically
 type ConsoleFormatter struct {
-	color bool
+	Color bool
+
+	// TimeFormat is the layout of the leading timestamp, defaulting to DEFAULT_CONSOLE_TIME_FORMAT
+	TimeFormat    string
+	HideTimestamp bool
+
+	// LevelField is the field used to colour the line, defaulting to DEFAULT_CONSOLE_LEVEL_FIELD
+	LevelField string
+
+	// FieldOrder are the fields to print first (in order), before all the others
+	FieldOrder []string
+}
+
+// NewConsoleFormatterFromRaw constructs a ConsoleFormatter from the given raw config
+func NewConsoleFormatterFromRaw(args map[string]string) (*ConsoleFormatter, error) {
+	formatter := &ConsoleFormatter{
+		TimeFormat: DEFAULT_CONSOLE_TIME_FORMAT,
+		LevelField: DEFAULT_CONSOLE_LEVEL_FIELD,
+	}
+
+	var err error
+	if c, ok := args["color"]; ok {
+		formatter.Color, err = strconv.ParseBool(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool `%s` for color in Console output - expected true or false", c)
+		}
+	}
+
+	if ts, ok := args["timestamp"]; ok {
+		show, err := strconv.ParseBool(ts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool `%s` for timestamp in Console output - expected true or false", ts)
+		}
+
+		formatter.HideTimestamp = !show
+	}
+
+	if layout, ok := args["time_format"]; ok {
+		formatter.TimeFormat = layout
+	}
+
+	if field, ok := args["level_field"]; ok {
+		formatter.LevelField = field
+	}
+
+	if order, ok := args["field_order"]; ok {
+		for _, field := range strings.Split(order, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				formatter.FieldOrder = append(formatter.FieldOrder, field)
+			}
+		}
+	}
+
+	return formatter, nil
+}
+
+func (j *ConsoleFormatter) colorize(s string, color string) string {
+	if !j.Color || color == "" || runtime.GOOS == "windows" {
+		return s
+	}
+
+	return color + s + termReset
 }
 
-func (j *ConsoleFormatter) ColorOutput(s interface{}, field string) string {
-	sStr := fmt.Sprint(s)
-	if !j.color || runtime.GOOS == "windows" {
-		return sStr
+// levelColor returns the color to use for a message at the given level - red for errors and worse, yellow for warnings
+func levelColor(level interface{}) string {
+	if level == nil {
+		return ""
+	}
+
+	severity, err := parseSyslogSeverity(fmt.Sprint(level))
+	if err != nil {
+		return ""
 	}
 
-	switch field {
-	case "key":
-		return fmt.Sprintf("%s%s%s", termGreen, sStr, termReset)
-	case "message":
-		return fmt.Sprintf("%s%s%s", termCyan, sStr, termReset)
+	switch {
+	case severity <= syslogSeverities["error"]:
+		return termRed
+	case severity == syslogSeverities["warn"]:
+		return termYellow
 	default:
-		return sStr
+		return ""
 	}
 }
 
+// needsQuoting returns true if the given value would be ambiguous as the value of a key=value pair.
+// Plain spaces are only ambiguous in values, so the message (which can't be confused with a key) can allow them
+func needsQuoting(s string, allowSpaces bool) bool {
+	if s == "" {
+		return true
+	}
+
+	for _, r := range s {
+		if r == ' ' && allowSpaces {
+			continue
+		}
+
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// consoleString converts the given value to a string, encoding nested values as JSON
+func consoleString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case map[string]interface{}, []interface{}:
+		if data, err := json.Marshal(value); err == nil {
+			return string(data)
+		}
+	}
+
+	return fmt.Sprint(v)
+}
+
+// consoleValue formats the given value for use in a key=value pair, quoting anything that contains spaces, `=`,
+// quotes, or control characters
+func consoleValue(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+
+	s := consoleString(v)
+	if needsQuoting(s, false) {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// consoleMessage formats the given message for the front of the line, quoting it if it contains anything
+// (newlines, `=` etc) that could make it look like extra lines or fields
+func consoleMessage(v interface{}) string {
+	s := consoleString(v)
+	if needsQuoting(s, true) {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// orderedKeys returns the keys of the message in the order they should be printed, skipping the message field
+func (j *ConsoleFormatter) orderedKeys(m *clogger.Message) []string {
+	keys := make([]string, 0, len(m.ParsedFields))
+	seen := make(map[string]struct{}, len(j.FieldOrder))
+	for _, key := range j.FieldOrder {
+		if _, ok := m.ParsedFields[key]; !ok || key == clogger.MESSAGE_FIELD {
+			continue
+		}
+
+		if _, ok := seen[key]; !ok {
+			keys = append(keys, key)
+			seen[key] = struct{}{}
+		}
+	}
+
+	rest := make([]string, 0, len(m.ParsedFields))
+	for key := range m.ParsedFields {
+		if _, ok := seen[key]; !ok && key != clogger.MESSAGE_FIELD {
+			rest = append(rest, key)
+		}
+	}
+
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
 func (j *ConsoleFormatter) Format(m *clogger.Message) ([]byte, error) {
-	parts := make([]string, 0, len(m.ParsedFields))
+	parts := make([]string, 0, len(m.ParsedFields)+1)
+
+	if !j.HideTimestamp {
+		layout := j.TimeFormat
+		if layout == "" {
+			layout = DEFAULT_CONSOLE_TIME_FORMAT
+		}
+
+		parts = append(parts, j.colorize(formatTimestamp(m.EventTime, layout), termGray))
+	}
+
+	levelField := j.LevelField
+	if levelField == "" {
+		levelField = DEFAULT_CONSOLE_LEVEL_FIELD
+	}
+
+	color := levelColor(m.ParsedFields[levelField])
 
 	// Hoist the message field to the front
-	if msg, ok := m.ParsedFields[clogger.MESSAGE_FIELD]; ok {
-		parts = append(parts, j.ColorOutput(msg, "message"))
+	if msg, ok := m.ParsedFields[clogger.MESSAGE_FIELD]; ok && msg != nil {
+		msgColor := color
+		if msgColor == "" {
+			msgColor = termCyan
+		}
+
+		parts = append(parts, j.colorize(consoleMessage(msg), msgColor))
 	}
 
-	for k, v := range m.ParsedFields {
-		if k == clogger.MESSAGE_FIELD {
-			continue
+	for _, key := range j.orderedKeys(m) {
+		value := consoleValue(m.ParsedFields[key])
+		if key == levelField {
+			value = j.colorize(value, color)
 		}
 
-		parts = append(parts, fmt.Sprintf("%s=%s", j.ColorOutput(k, "key"), j.ColorOutput(v, "value")))
+		parts = append(parts, fmt.Sprintf("%s=%s", j.colorize(consoleValue(key), termGreen), value))
 	}
 
 	return []byte(strings.Join(parts, " ")), nil
@@ -0,0 +1,121 @@
+package format_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+)
+
+func TestConsoleFormatter(t *testing.T) {
+	formatter, err := format.NewConsoleFormatterFromRaw(map[string]string{
+		"time_format": "rfc3339",
+		"field_order": "level,host",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := clogger.NewMessage()
+	msg.EventTime = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello world"
+	msg.ParsedFields["zone"] = "a"
+	msg.ParsedFields["host"] = "web1"
+	msg.ParsedFields["level"] = "info"
+	msg.ParsedFields["query"] = "a=b c"
+	msg.ParsedFields["empty"] = ""
+	msg.ParsedFields["nested"] = map[string]interface{}{"a": 1}
+
+	expectedSuffix := ` hello world level=info host=web1 empty="" nested="{\"a\":1}" query="a=b c" zone=a`
+
+	// Run it a few times so that we'd notice any map ordering leaking into the output
+	for i := 0; i < 10; i++ {
+		data, err := formatter.Format(&msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line := string(data)
+		ts := msg.EventTime.Format(time.RFC3339)
+		if line != ts+expectedSuffix {
+			t.Fatalf("Got unexpected console line: %s", line)
+		}
+	}
+}
+
+func TestConsoleFormatterLevelColors(t *testing.T) {
+	formatter, err := format.NewConsoleFormatterFromRaw(map[string]string{
+		"color":     "true",
+		"timestamp": "false",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"error":   "\033[31m",
+		"warning": "\033[33m",
+		"info":    "\033[36m",
+	}
+
+	for level, color := range tests {
+		msg := clogger.NewMessage()
+		msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+		msg.ParsedFields["level"] = level
+
+		data, err := formatter.Format(&msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(string(data), color+"hello") {
+			t.Errorf("expected %s message to start with color %q, got %q", level, color, string(data))
+		}
+	}
+}
+
+func TestConsoleFormatterZeroValue(t *testing.T) {
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+	msg.ParsedFields["b"] = 2
+	msg.ParsedFields["a"] = 1
+
+	data, err := (&format.ConsoleFormatter{HideTimestamp: true}).Format(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "hello a=1 b=2" {
+		t.Fatalf("Got unexpected console line: %s", string(data))
+	}
+}
+
+func TestConsoleFormatterEscapesMessage(t *testing.T) {
+	tests := map[string]string{
+		"hello world":      "hello world a=1",
+		"hello\nfake line": `"hello\nfake line" a=1`,
+		"hello a=2":        `"hello a=2" a=1`,
+		"say \"hi\"":       `"say \"hi\"" a=1`,
+		"\033[31mred":      `"\x1b[31mred" a=1`,
+		"":                 `"" a=1`,
+	}
+
+	for message, expected := range tests {
+		msg := clogger.NewMessage()
+		msg.ParsedFields[clogger.MESSAGE_FIELD] = message
+		msg.ParsedFields["a"] = 1
+
+		data, err := (&format.ConsoleFormatter{HideTimestamp: true}).Format(&msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != expected {
+			t.Errorf("Expected %q to be formatted as %s, got %s", message, expected, string(data))
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package format
+
+import (
+	"encoding/binary"
+
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+)
+
+// frame frames the given encoded message according to the given framing
+func frame(framing parse.Framing, data []byte) []byte {
+	if framing != parse.FRAMING_LENGTH {
+		return data
+	}
+
+	framed := make([]byte, binary.MaxVarintLen64, len(data)+binary.MaxVarintLen64)
+	n := binary.PutUvarint(framed, uint64(len(data)))
+	return append(framed[:n], data...)
+}
@@ -0,0 +1,126 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+// GELF_VERSION is the version of the GELF spec that we emit
+const GELF_VERSION = "1.1"
+
+// GELFFormatter is a Formatter that formats messages as Graylog Extended Log Format payloads
+type GELFFormatter struct {
+	// HostField is the field to take the `host` from, falling back to the hostname of this machine
+	HostField string
+
+	// LevelField is the field that gets mapped to a syslog severity for the `level`
+	LevelField string
+
+	// FullMessageField is the field to take the `full_message` from, if it exists
+	FullMessageField string
+
+	// NullDelimited terminates each message with a null byte, as required by GELF over TCP
+	NullDelimited bool
+
+	hostname string
+}
+
+// NewGELFFormatterFromRaw constructs a GELFFormatter from the given raw config
+func NewGELFFormatterFromRaw(args map[string]string) (*GELFFormatter, error) {
+	hostname, _ := os.Hostname()
+	formatter := &GELFFormatter{
+		HostField:        "host",
+		LevelField:       "level",
+		FullMessageField: "full_message",
+		hostname:         hostname,
+	}
+
+	if host, ok := args["host_field"]; ok {
+		formatter.HostField = host
+	}
+
+	if level, ok := args["level_field"]; ok {
+		formatter.LevelField = level
+	}
+
+	if fullMessage, ok := args["full_message_field"]; ok {
+		formatter.FullMessageField = fullMessage
+	}
+
+	if n, ok := args["null_delimited"]; ok {
+		var err error
+		formatter.NullDelimited, err = strconv.ParseBool(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool `%s` for null_delimited in GELF format - expected true or false", n)
+		}
+	}
+
+	return formatter, nil
+}
+
+func (g *GELFFormatter) Format(m *clogger.Message) ([]byte, error) {
+	payload := make(map[string]interface{}, len(m.ParsedFields)+4)
+	payload["version"] = GELF_VERSION
+	payload["timestamp"] = float64(m.EventTime.UnixNano()) / 1e9
+
+	host := g.hostname
+	if value, ok := m.ParsedFields[g.HostField]; ok && value != nil {
+		host = fmt.Sprint(value)
+	}
+
+	if host == "" {
+		host = "unknown"
+	}
+
+	payload["host"] = host
+
+	// short_message is required, and must not be empty
+	shortMessage := "-"
+	if value, ok := m.ParsedFields[clogger.MESSAGE_FIELD]; ok && value != nil {
+		if s := fmt.Sprint(value); s != "" {
+			shortMessage = s
+		}
+	}
+
+	payload["short_message"] = shortMessage
+
+	for key, value := range m.ParsedFields {
+		switch key {
+		case clogger.MESSAGE_FIELD, g.HostField:
+			continue
+		case g.FullMessageField:
+			if value != nil {
+				payload["full_message"] = fmt.Sprint(value)
+			}
+		case g.LevelField:
+			if value != nil {
+				if severity, err := parseSyslogSeverity(fmt.Sprint(value)); err == nil {
+					payload["level"] = severity
+					continue
+				}
+			}
+
+			payload["_"+key] = value
+		case "id":
+			// `_id` is reserved by the spec
+			payload["__id"] = value
+		default:
+			payload["_"+key] = value
+		}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.NullDelimited {
+		data = append(data, 0)
+	}
+
+	return data, nil
+}
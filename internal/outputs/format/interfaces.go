@@ -5,13 +5,25 @@ import (
 	"strconv"
 
 	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
 )
 
 type Formatter interface {
 	Format(m *clogger.Message) ([]byte, error)
 }
 
+// GetFormatterFromString constructs the formatter with the given name from the raw config, wrapping it
+// in a ProjectingFormatter if the config contains any projection options
 func GetFormatterFromString(s string, args map[string]string) (Formatter, error) {
+	formatter, err := newFormatterFromString(s, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return WithProjection(formatter, args)
+}
+
+func newFormatterFromString(s string, args map[string]string) (Formatter, error) {
 	switch s {
 	case "json":
 		var err error
@@ -27,18 +39,29 @@ func GetFormatterFromString(s string, args map[string]string) (Formatter, error)
 			NewlineDelimited: newlines,
 		}, nil
 	case "console":
-		var err error
-		color := false
-		if c, ok := args["color"]; ok {
-			color, err = strconv.ParseBool(c)
-			if err != nil {
-				return nil, fmt.Errorf("invalid bool `%s` for color in Console output - expected true or false", c)
-			}
+		return NewConsoleFormatterFromRaw(args)
+	case "syslog":
+		return NewSyslogFormatterFromRaw(args)
+	case "gelf":
+		return NewGELFFormatterFromRaw(args)
+	case "template":
+		return NewTemplateFormatterFromRaw(args)
+	case "binary":
+		return &BinaryFormatter{}, nil
+	case "msgpack":
+		framing, err := parse.ParseFraming(args)
+		if err != nil {
+			return nil, err
 		}
 
-		return &ConsoleFormatter{
-			color,
-		}, nil
+		return &MsgpackFormatter{Framing: framing}, nil
+	case "cbor":
+		framing, err := parse.ParseFraming(args)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewCBORFormatter(framing)
 	}
 
 	return nil, fmt.Errorf("no formatter named `%s` found", s)
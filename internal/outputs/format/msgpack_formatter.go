@@ -0,0 +1,26 @@
+package format
+
+import (
+	"bytes"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackFormatter is a Formatter that formats messages as MessagePack maps
+type MsgpackFormatter struct {
+	Framing parse.Framing
+}
+
+func (m *MsgpackFormatter) Format(msg *clogger.Message) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.UseCompactInts(true)
+	encoder.SetSortMapKeys(true)
+	if err := encoder.EncodeMap(msg.ParsedFields); err != nil {
+		return nil, err
+	}
+
+	return frame(m.Framing, buffer.Bytes()), nil
+}
@@ -0,0 +1,306 @@
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+// DEFAULT_FLATTEN_SEPARATOR is the separator used between the keys of nested maps when flattening them
+const DEFAULT_FLATTEN_SEPARATOR = "."
+
+// DEFAULT_TIMESTAMP_FORMAT is the layout used for timestamps added by `timestamp_field` and `ingest_timestamp_field`
+const DEFAULT_TIMESTAMP_FORMAT = "rfc3339nano"
+
+// Projection is a set of transformations applied to the fields of a message before it gets formatted
+// They get applied in the order flatten, include, exclude, rename, unflatten, so that include and exclude
+// can refer to flattened keys, and renames can produce dotted keys that get nested. The timestamp and metadata fields get added last
+type Projection struct {
+	// IncludeFields are the only fields that get formatted, if not empty
+	IncludeFields map[string]struct{}
+
+	// ExcludeFields are fields that get dropped
+	ExcludeFields map[string]struct{}
+
+	// Rename maps old field names to new ones
+	Rename map[string]string
+
+	// Flatten converts nested maps into dotted keys, e.g. `{"a": {"b": 1}}` becomes `{"a.b": 1}`
+	Flatten bool
+
+	// Unflatten is the reverse of Flatten, converting dotted keys into nested maps
+	Unflatten bool
+
+	Separator string
+
+	// TimestampField and IngestTimestampField, if set, are the fields that the event and ingest times
+	// of the message get added as, formatted with TimestampFormat
+	TimestampField       string
+	IngestTimestampField string
+	TimestampFormat      string
+
+	// MetadataField, if set, is the field that the metadata of the message gets added as
+	MetadataField string
+}
+
+// parseFieldSet parses a comma separated list of fields into a set
+func parseFieldSet(s string) map[string]struct{} {
+	fields := make(map[string]struct{})
+	for _, field := range strings.Split(s, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields[field] = struct{}{}
+		}
+	}
+
+	return fields
+}
+
+// NewProjectionFromRaw constructs a Projection from the given raw config, returning nil if the config
+// doesn't contain any projection options
+func NewProjectionFromRaw(args map[string]string) (*Projection, error) {
+	projection := &Projection{
+		Separator: DEFAULT_FLATTEN_SEPARATOR,
+	}
+
+	configured := false
+	if include, ok := args["include_fields"]; ok {
+		projection.IncludeFields = parseFieldSet(include)
+		configured = true
+	}
+
+	if exclude, ok := args["exclude_fields"]; ok {
+		projection.ExcludeFields = parseFieldSet(exclude)
+		configured = true
+	}
+
+	if rename, ok := args["rename"]; ok {
+		projection.Rename = make(map[string]string)
+		for _, pair := range strings.Split(rename, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+
+			parts := strings.SplitN(pair, ":", 2)
+			if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+				return nil, fmt.Errorf("invalid `rename` pair `%s` - expected old:new", pair)
+			}
+
+			projection.Rename[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+
+		configured = true
+	}
+
+	bools := map[string]*bool{
+		"flatten":   &projection.Flatten,
+		"unflatten": &projection.Unflatten,
+	}
+
+	for key, value := range bools {
+		if s, ok := args[key]; ok {
+			var err error
+			*value, err = strconv.ParseBool(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bool `%s` for `%s` - expected true or false", s, key)
+			}
+
+			configured = true
+		}
+	}
+
+	if projection.Flatten && projection.Unflatten {
+		return nil, fmt.Errorf("only one of `flatten` and `unflatten` can be set")
+	}
+
+	if separator, ok := args["flatten_separator"]; ok {
+		if separator == "" {
+			return nil, fmt.Errorf("`flatten_separator` can't be empty")
+		}
+
+		projection.Separator = separator
+	}
+
+	addedFields := map[string]*string{
+		"timestamp_field":        &projection.TimestampField,
+		"ingest_timestamp_field": &projection.IngestTimestampField,
+		"metadata_field":         &projection.MetadataField,
+	}
+
+	for key, value := range addedFields {
+		if s, ok := args[key]; ok && s != "" {
+			*value = s
+			configured = true
+		}
+	}
+
+	projection.TimestampFormat = DEFAULT_TIMESTAMP_FORMAT
+	if layout, ok := args["timestamp_format"]; ok {
+		projection.TimestampFormat = layout
+	}
+
+	if !configured {
+		return nil, nil
+	}
+
+	return projection, nil
+}
+
+// flattenInto copies the given fields into dest, converting nested maps into keys joined with the separator
+func flattenInto(dest map[string]interface{}, prefix string, fields map[string]interface{}, separator string) {
+	for key, value := range fields {
+		if prefix != "" {
+			key = prefix + separator + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenInto(dest, key, nested, separator)
+			continue
+		}
+
+		dest[key] = value
+	}
+}
+
+// unflatten converts keys containing the separator into nested maps. Keys that conflict with an existing
+// non-map value are left as they are. Maps from the original fields are copied before being added to
+func unflatten(fields map[string]interface{}, separator string) map[string]interface{} {
+	result := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if !strings.Contains(key, separator) {
+			result[key] = value
+		}
+	}
+
+	// owned tracks the nested maps (by path) that we've created, and so can modify in place
+	owned := make(map[string]struct{})
+	for key, value := range fields {
+		if !strings.Contains(key, separator) {
+			continue
+		}
+
+		parts := strings.Split(key, separator)
+		current := result
+		path := ""
+		for _, part := range parts[:len(parts)-1] {
+			path += separator + part
+			next, exists := current[part]
+			nested, isMap := next.(map[string]interface{})
+			switch {
+			case !exists:
+				nested = make(map[string]interface{})
+			case !isMap:
+				current = nil
+			default:
+				if _, ok := owned[path]; !ok {
+					copied := make(map[string]interface{}, len(nested)+1)
+					for k, v := range nested {
+						copied[k] = v
+					}
+
+					nested = copied
+				}
+			}
+
+			if current == nil {
+				break
+			}
+
+			current[part] = nested
+			owned[path] = struct{}{}
+			current = nested
+		}
+
+		if current == nil {
+			result[key] = value
+			continue
+		}
+
+		current[parts[len(parts)-1]] = value
+	}
+
+	return result
+}
+
+// Apply returns a copy of the given message with the projection applied to its fields
+func (p *Projection) Apply(m *clogger.Message) clogger.Message {
+	fields := m.ParsedFields
+	if p.Flatten {
+		fields = make(map[string]interface{}, len(m.ParsedFields))
+		flattenInto(fields, "", m.ParsedFields, p.Separator)
+	}
+
+	projected := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if p.IncludeFields != nil {
+			if _, ok := p.IncludeFields[key]; !ok {
+				continue
+			}
+		}
+
+		if _, ok := p.ExcludeFields[key]; ok {
+			continue
+		}
+
+		if newKey, ok := p.Rename[key]; ok {
+			key = newKey
+		}
+
+		projected[key] = value
+	}
+
+	if p.Unflatten {
+		projected = unflatten(projected, p.Separator)
+	}
+
+	if p.TimestampField != "" {
+		projected[p.TimestampField] = timestampValue(m.EventTime, p.TimestampFormat)
+	}
+
+	if p.IngestTimestampField != "" {
+		projected[p.IngestTimestampField] = timestampValue(m.IngestTime, p.TimestampFormat)
+	}
+
+	if p.MetadataField != "" {
+		metadata := make(map[string]interface{}, len(m.Metadata))
+		for key, value := range m.Metadata {
+			metadata[key] = value
+		}
+
+		projected[p.MetadataField] = metadata
+	}
+
+	message := *m
+	message.ParsedFields = projected
+	return message
+}
+
+// ProjectingFormatter is a Formatter that applies a Projection to messages before passing them to another Formatter
+type ProjectingFormatter struct {
+	Formatter
+	Projection *Projection
+}
+
+func (p *ProjectingFormatter) Format(m *clogger.Message) ([]byte, error) {
+	projected := p.Projection.Apply(m)
+	return p.Formatter.Format(&projected)
+}
+
+// WithProjection wraps the given formatter with the projection options (`include_fields`, `exclude_fields`, `rename`, `flatten`,
+// `unflatten`, `timestamp_field`, `ingest_timestamp_field`, `metadata_field`) in the given config, returning it unchanged if there aren't any
+func WithProjection(formatter Formatter, args map[string]string) (Formatter, error) {
+	projection, err := NewProjectionFromRaw(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if projection == nil {
+		return formatter, nil
+	}
+
+	return &ProjectingFormatter{
+		Formatter:  formatter,
+		Projection: projection,
+	}, nil
+}
@@ -0,0 +1,222 @@
+package format_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+)
+
+func TestProjection(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     map[string]string
+		fields   map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			name: "include",
+			args: map[string]string{"include_fields": "a, b"},
+			fields: map[string]interface{}{
+				"a": 1,
+				"b": 2,
+				"c": 3,
+			},
+			expected: map[string]interface{}{
+				"a": 1,
+				"b": 2,
+			},
+		},
+		{
+			name: "exclude and rename",
+			args: map[string]string{"exclude_fields": "c", "rename": "a:alpha,b:beta"},
+			fields: map[string]interface{}{
+				"a": 1,
+				"b": 2,
+				"c": 3,
+			},
+			expected: map[string]interface{}{
+				"alpha": 1,
+				"beta":  2,
+			},
+		},
+		{
+			name: "flatten",
+			args: map[string]string{"flatten": "true", "exclude_fields": "http.request.body"},
+			fields: map[string]interface{}{
+				"host": "web1",
+				"http": map[string]interface{}{
+					"status": 200,
+					"request": map[string]interface{}{
+						"method": "GET",
+						"body":   "secret",
+					},
+				},
+			},
+			expected: map[string]interface{}{
+				"host":                "web1",
+				"http.status":         200,
+				"http.request.method": "GET",
+			},
+		},
+		{
+			name: "unflatten",
+			args: map[string]string{"unflatten": "true", "flatten_separator": "_", "rename": "host:host_name"},
+			fields: map[string]interface{}{
+				"host":        "web1",
+				"http_status": 200,
+				"http_method": "GET",
+				"user":        "bob",
+				"user_id":     1,
+			},
+			expected: map[string]interface{}{
+				"host": map[string]interface{}{
+					"name": "web1",
+				},
+				"http": map[string]interface{}{
+					"status": 200,
+					"method": "GET",
+				},
+				"user":    "bob",
+				"user_id": 1,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			projection, err := format.NewProjectionFromRaw(test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := clogger.NewMessage()
+			msg.ParsedFields = test.fields
+
+			projected := projection.Apply(&msg)
+			if !reflect.DeepEqual(projected.ParsedFields, test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, projected.ParsedFields)
+			}
+
+			if !projected.EventTime.Equal(msg.EventTime) {
+				t.Fatal("projection didn't keep the message timestamp")
+			}
+		})
+	}
+}
+
+func TestUnflattenDoesntModifyOriginal(t *testing.T) {
+	projection, err := format.NewProjectionFromRaw(map[string]string{"unflatten": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nested := map[string]interface{}{"a": 1}
+	msg := clogger.NewMessage()
+	msg.ParsedFields["n"] = nested
+	msg.ParsedFields["n.b"] = 2
+
+	projected := projection.Apply(&msg)
+	expected := map[string]interface{}{"n": map[string]interface{}{"a": 1, "b": 2}}
+	if !reflect.DeepEqual(projected.ParsedFields, expected) {
+		t.Fatalf("expected %v, got %v", expected, projected.ParsedFields)
+	}
+
+	if len(nested) != 1 {
+		t.Fatalf("unflattening modified the original nested map: %v", nested)
+	}
+}
+
+func TestGetFormatterWithProjection(t *testing.T) {
+	formatter, err := format.GetFormatterFromString("json", map[string]string{
+		"include_fields": "message,host",
+		"rename":         "host:hostname",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+	msg.ParsedFields["host"] = "web1"
+	msg.ParsedFields["secret"] = "hunter2"
+
+	data, err := formatter.Format(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"hostname":"web1","message":"hello"}` {
+		t.Fatalf("Got unexpected output: %s", string(data))
+	}
+
+	if _, ok := msg.ParsedFields["secret"]; !ok {
+		t.Fatal("formatting modified the original message")
+	}
+
+	if _, err := format.GetFormatterFromString("json", map[string]string{"flatten": "true", "unflatten": "true"}); err == nil {
+		t.Fatal("expected an error with both flatten and unflatten")
+	}
+}
+
+func TestProjectionTimestampFields(t *testing.T) {
+	formatter, err := format.GetFormatterFromString("json", map[string]string{
+		"timestamp_field":        "@timestamp",
+		"ingest_timestamp_field": "ingested",
+		"timestamp_format":       "unixms",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := clogger.NewMessage()
+	msg.EventTime = time.Unix(1622548800, 0)
+	msg.IngestTime = time.Unix(1622548801, 0)
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+
+	data, err := formatter.Format(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"@timestamp":1622548800000,"ingested":1622548801000,"message":"hello"}` {
+		t.Fatalf("Got unexpected output: %s", string(data))
+	}
+}
+
+func TestProjectionMetadataField(t *testing.T) {
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+	msg.SetMetadata(clogger.METADATA_INPUT, "tcp_in")
+
+	// Metadata doesn't get formatted unless it's asked for
+	data, err := (&format.JSONFormatter{}).Format(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"message":"hello"}` {
+		t.Fatalf("Got unexpected output: %s", string(data))
+	}
+
+	formatter, err := format.GetFormatterFromString("json", map[string]string{
+		"metadata_field": "meta",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = formatter.Format(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != `{"message":"hello","meta":{"input":"tcp_in"}}` {
+		t.Fatalf("Got unexpected output: %s", string(data))
+	}
+}
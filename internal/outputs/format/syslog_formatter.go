@@ -0,0 +1,315 @@
+package format
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+// SYSLOG_SD_ID is the structured data ID that fields get put under in RFC 5424 messages
+// 32473 is the private enterprise number reserved for documentation
+const SYSLOG_SD_ID = "clogger@32473"
+
+const SYSLOG_NIL_VALUE = "-"
+
+type SyslogRFC int
+
+const (
+	SYSLOG_RFC5424 SyslogRFC = iota
+	SYSLOG_RFC3164
+)
+
+// syslogFacilities maps the names of syslog facilities to their codes
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+// syslogSeverities maps common level names to syslog severities
+var syslogSeverities = map[string]int{
+	"emerg":     0,
+	"emergency": 0,
+	"panic":     0,
+	"alert":     1,
+	"crit":      2,
+	"critical":  2,
+	"fatal":     2,
+	"err":       3,
+	"error":     3,
+	"warn":      4,
+	"warning":   4,
+	"notice":    5,
+	"info":      6,
+	"debug":     7,
+	"trace":     7,
+}
+
+// SyslogFormatter is a Formatter that formats messages as syslog lines, mapping the configured
+// fields onto the syslog header
+type SyslogFormatter struct {
+	RFC SyslogRFC
+
+	// Facility is the facility to use if the message doesn't have a FacilityField
+	Facility int
+
+	// Severity is the severity to use if the message doesn't have a SeverityField
+	Severity int
+
+	FacilityField string
+	SeverityField string
+	HostnameField string
+	AppNameField  string
+	ProcIDField   string
+	MsgIDField    string
+
+	// StructuredDataFields are the fields that get put into the structured data of RFC 5424 messages
+	StructuredDataFields []string
+
+	hostname string
+}
+
+func parseSyslogFacility(s string) (int, error) {
+	if facility, ok := syslogFacilities[strings.ToLower(s)]; ok {
+		return facility, nil
+	}
+
+	if facility, err := strconv.Atoi(s); err == nil && facility >= 0 && facility <= 23 {
+		return facility, nil
+	}
+
+	return 0, fmt.Errorf("invalid syslog facility `%s`", s)
+}
+
+func parseSyslogSeverity(s string) (int, error) {
+	if severity, ok := syslogSeverities[strings.ToLower(s)]; ok {
+		return severity, nil
+	}
+
+	if severity, err := strconv.Atoi(s); err == nil && severity >= 0 && severity <= 7 {
+		return severity, nil
+	}
+
+	return 0, fmt.Errorf("invalid syslog severity `%s`", s)
+}
+
+// NewSyslogFormatterFromRaw constructs a SyslogFormatter from the given raw config
+func NewSyslogFormatterFromRaw(args map[string]string) (*SyslogFormatter, error) {
+	hostname, _ := os.Hostname()
+	formatter := &SyslogFormatter{
+		RFC:           SYSLOG_RFC5424,
+		Facility:      syslogFacilities["user"],
+		Severity:      syslogSeverities["info"],
+		FacilityField: "facility",
+		SeverityField: "level",
+		HostnameField: "host",
+		AppNameField:  "app",
+		ProcIDField:   "pid",
+		MsgIDField:    "msgid",
+		hostname:      hostname,
+	}
+
+	var err error
+	if rfc, ok := args["rfc"]; ok {
+		switch rfc {
+		case "5424":
+			formatter.RFC = SYSLOG_RFC5424
+		case "3164":
+			formatter.RFC = SYSLOG_RFC3164
+		default:
+			return nil, fmt.Errorf("invalid `rfc` for syslog format - expected 5424 or 3164, got `%s`", rfc)
+		}
+	}
+
+	if facility, ok := args["facility"]; ok {
+		formatter.Facility, err = parseSyslogFacility(facility)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if severity, ok := args["severity"]; ok {
+		formatter.Severity, err = parseSyslogSeverity(severity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fields := map[string]*string{
+		"facility_field": &formatter.FacilityField,
+		"severity_field": &formatter.SeverityField,
+		"hostname_field": &formatter.HostnameField,
+		"appname_field":  &formatter.AppNameField,
+		"procid_field":   &formatter.ProcIDField,
+		"msgid_field":    &formatter.MsgIDField,
+	}
+
+	for key, field := range fields {
+		if value, ok := args[key]; ok {
+			*field = value
+		}
+	}
+
+	if sdFields, ok := args["sd_fields"]; ok {
+		for _, field := range strings.Split(sdFields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				formatter.StructuredDataFields = append(formatter.StructuredDataFields, field)
+			}
+		}
+	}
+
+	return formatter, nil
+}
+
+// headerField returns the string value of the given field, truncated and stripped of spaces
+// so that it's valid in a syslog header, or the given default if the message doesn't have it
+func headerField(m *clogger.Message, field string, maxLen int, def string) string {
+	value, ok := m.ParsedFields[field]
+	if !ok || value == nil {
+		return def
+	}
+
+	s := strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 {
+			return -1
+		}
+
+		return r
+	}, fmt.Sprint(value))
+
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+
+	if s == "" {
+		return def
+	}
+
+	return s
+}
+
+// escapeSDValue escapes the given value for use as a param value in RFC 5424 structured data
+func escapeSDValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
+
+// escapeSDName strips any characters that aren't valid in an RFC 5424 SD-NAME
+func escapeSDName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			return -1
+		}
+
+		return r
+	}, s)
+
+	if len(s) > 32 {
+		s = s[:32]
+	}
+
+	return s
+}
+
+func (s *SyslogFormatter) priority(m *clogger.Message) int {
+	facility := s.Facility
+	if value, ok := m.ParsedFields[s.FacilityField]; ok && value != nil {
+		if f, err := parseSyslogFacility(fmt.Sprint(value)); err == nil {
+			facility = f
+		}
+	}
+
+	severity := s.Severity
+	if value, ok := m.ParsedFields[s.SeverityField]; ok && value != nil {
+		if sev, err := parseSyslogSeverity(fmt.Sprint(value)); err == nil {
+			severity = sev
+		}
+	}
+
+	return facility*8 + severity
+}
+
+func (s *SyslogFormatter) structuredData(m *clogger.Message) string {
+	params := []string{}
+	for _, field := range s.StructuredDataFields {
+		if value, ok := m.ParsedFields[field]; ok && value != nil {
+			if name := escapeSDName(field); name != "" {
+				params = append(params, fmt.Sprintf(`%s="%s"`, name, escapeSDValue(fmt.Sprint(value))))
+			}
+		}
+	}
+
+	if len(params) == 0 {
+		return SYSLOG_NIL_VALUE
+	}
+
+	sort.Strings(params)
+
+	return fmt.Sprintf("[%s %s]", SYSLOG_SD_ID, strings.Join(params, " "))
+}
+
+func (s *SyslogFormatter) Format(m *clogger.Message) ([]byte, error) {
+	now := m.EventTime
+	msg := ""
+	if value, ok := m.ParsedFields[clogger.MESSAGE_FIELD]; ok && value != nil {
+		msg = fmt.Sprint(value)
+	}
+
+	hostname := s.hostname
+	if hostname == "" {
+		hostname = SYSLOG_NIL_VALUE
+	}
+
+	switch s.RFC {
+	case SYSLOG_RFC3164:
+		tag := headerField(m, s.AppNameField, 32, "clogger")
+		if pid := headerField(m, s.ProcIDField, 128, ""); pid != "" {
+			tag = fmt.Sprintf("%s[%s]", tag, pid)
+		}
+
+		return []byte(fmt.Sprintf("<%d>%s %s %s: %s",
+			s.priority(m),
+			now.Format(time.Stamp),
+			headerField(m, s.HostnameField, 255, hostname),
+			tag,
+			msg,
+		)), nil
+	default:
+		line := fmt.Sprintf("<%d>1 %s %s %s %s %s %s",
+			s.priority(m),
+			now.Format("2006-01-02T15:04:05.000000Z07:00"),
+			headerField(m, s.HostnameField, 255, hostname),
+			headerField(m, s.AppNameField, 48, SYSLOG_NIL_VALUE),
+			headerField(m, s.ProcIDField, 128, SYSLOG_NIL_VALUE),
+			headerField(m, s.MsgIDField, 32, SYSLOG_NIL_VALUE),
+			s.structuredData(m),
+		)
+
+		if msg != "" {
+			line += " " + msg
+		}
+
+		return []byte(line), nil
+	}
+}
@@ -0,0 +1,66 @@
+package format_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+)
+
+func TestSyslogFormatterRFC5424(t *testing.T) {
+	formatter, err := format.NewSyslogFormatterFromRaw(map[string]string{
+		"facility":  "local0",
+		"sd_fields": "request_id,path",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello world"
+	msg.ParsedFields["level"] = "error"
+	msg.ParsedFields["host"] = "web 1"
+	msg.ParsedFields["app"] = "nginx"
+	msg.ParsedFields["request_id"] = "abc"
+	msg.ParsedFields["path"] = `/a"b]`
+
+	data, err := formatter.Format(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// local0 (16) * 8 + error (3) = 131
+	expected := regexp.MustCompile(`^<131>1 \S+ web1 nginx - - \[clogger@32473 path="/a\\"b\\]" request_id="abc"\] hello world$`)
+	if !expected.Match(data) {
+		t.Fatalf("Got unexpected syslog line: %s", string(data))
+	}
+}
+
+func TestSyslogFormatterRFC3164(t *testing.T) {
+	formatter, err := format.NewSyslogFormatterFromRaw(map[string]string{
+		"rfc": "3164",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello"
+	msg.ParsedFields["host"] = "web1"
+	msg.ParsedFields["app"] = "sshd"
+	msg.ParsedFields["pid"] = 1234
+
+	data, err := formatter.Format(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// user (1) * 8 + info (6) = 14
+	expected := regexp.MustCompile(`^<14>[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2} web1 sshd\[1234\]: hello$`)
+	if !expected.Match(data) {
+		t.Fatalf("Got unexpected syslog line: %s", string(data))
+	}
+}
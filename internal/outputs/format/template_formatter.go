@@ -0,0 +1,202 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+)
+
+// TemplateFormatter is a Formatter that renders messages through a Go text/template, e.g.
+// `{{.host}} {{.level | upper}} {{.message}}`. The template is executed against the fields of the message
+type TemplateFormatter struct {
+	NewlineDelimited bool
+
+	template *template.Template
+
+	// current is the message currently being rendered, so that the template functions can get at its timestamp and metadata
+	lock    sync.Mutex
+	current *clogger.Message
+}
+
+// NewTemplateFormatter parses the given text/template into a TemplateFormatter
+func NewTemplateFormatter(text string, newlines bool) (*TemplateFormatter, error) {
+	formatter := &TemplateFormatter{
+		NewlineDelimited: newlines,
+	}
+
+	tmpl, err := template.New("format").Funcs(formatter.funcs()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	formatter.template = tmpl
+	return formatter, nil
+}
+
+// NewTemplateFormatterFromRaw constructs a TemplateFormatter from the given raw config, taking
+// the template either inline from `template`, or from the file at `template_file`
+func NewTemplateFormatterFromRaw(args map[string]string) (*TemplateFormatter, error) {
+	text, hasText := args["template"]
+	file, hasFile := args["template_file"]
+
+	switch {
+	case hasText && hasFile:
+		return nil, fmt.Errorf("only one of `template` and `template_file` can be given for template format")
+	case hasFile:
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		text = string(data)
+	case !hasText:
+		return nil, fmt.Errorf("missing `template` or `template_file` required for template format")
+	}
+
+	newlines := false
+	if n, ok := args["newlines"]; ok {
+		var err error
+		newlines, err = strconv.ParseBool(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool `%s` for newline delimiting in template output - expected true or false", n)
+		}
+	}
+
+	return NewTemplateFormatter(text, newlines)
+}
+
+func (t *TemplateFormatter) funcs() template.FuncMap {
+	return template.FuncMap{
+		"json":      templateJSON,
+		"default":   templateDefault,
+		"upper":     func(v interface{}) string { return strings.ToUpper(templateString(v)) },
+		"lower":     func(v interface{}) string { return strings.ToLower(templateString(v)) },
+		"truncate":  templateTruncate,
+		"timestamp": t.timestamp,
+		"meta":      t.meta,
+	}
+}
+
+// templateString converts the given value into a string, treating nil (e.g. a missing field) as empty
+func templateString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	return fmt.Sprint(v)
+}
+
+// templateJSON encodes the given value as JSON, e.g. for embedding a field as a properly escaped JSON string
+func templateJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// templateDefault returns the given value, or def if the value is missing or empty, e.g. `{{.user | default "-"}}`
+func templateDefault(def interface{}, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+
+	if s, ok := v.(string); ok && s == "" {
+		return def
+	}
+
+	return v
+}
+
+// templateTruncate cuts the given value down to at most n runes, e.g. `{{.message | truncate 80}}`
+func templateTruncate(n int, v interface{}) string {
+	s := templateString(v)
+	if n < 0 {
+		n = 0
+	}
+
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n])
+}
+
+// toTime converts the given field value into a time, accepting times, RFC 3339 strings, and unix timestamps in seconds
+func toTime(v interface{}) (time.Time, error) {
+	switch value := v.(type) {
+	case time.Time:
+		return value, nil
+	case string:
+		return time.Parse(time.RFC3339Nano, value)
+	case float64:
+		return time.Unix(0, int64(value*float64(time.Second))), nil
+	case int64:
+		return time.Unix(value, 0), nil
+	case int:
+		return time.Unix(int64(value), 0), nil
+	case uint64:
+		return time.Unix(int64(value), 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("can't convert `%v` to a time", v)
+}
+
+// timestamp formats the given time (or the time of the message being rendered if one isn't given) with the layout
+// e.g. `{{timestamp "%Y-%m-%d"}}` or `{{timestamp "rfc3339" .start_time}}`
+func (t *TemplateFormatter) timestamp(layout string, values ...interface{}) (string, error) {
+	var ts time.Time
+	switch len(values) {
+	case 0:
+		ts = t.current.EventTime
+	case 1:
+		var err error
+		ts, err = toTime(values[0])
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("timestamp takes at most one time to format, got %d", len(values))
+	}
+
+	return formatTimestamp(ts, layout), nil
+}
+
+// meta returns the value of the given metadata key of the message being rendered, e.g. `{{meta "peer_addr"}}`
+func (t *TemplateFormatter) meta(key string) string {
+	value, _ := t.current.GetMetadata(key)
+	return value
+}
+
+func (t *TemplateFormatter) Format(m *clogger.Message) ([]byte, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.current = m
+	defer func() { t.current = nil }()
+
+	var buffer bytes.Buffer
+	if err := t.template.Execute(&buffer, m.ParsedFields); err != nil {
+		return nil, err
+	}
+
+	if t.NewlineDelimited {
+		buffer.WriteByte('\n')
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,83 @@
+package format_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+)
+
+func TestTemplateFormatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "fields and case",
+			template: `{{.host}} {{.level | upper}} {{.message}}`,
+			expected: "web1 ERROR hello world",
+		},
+		{
+			name:     "json escaping",
+			template: `{"msg":{{json .message}},"quote":{{json .quote}}}`,
+			expected: `{"msg":"hello world","quote":"a \"b\""}`,
+		},
+		{
+			name:     "defaults",
+			template: `{{.user | default "-"}} {{.empty | default "none"}} {{.host | default "-"}}`,
+			expected: "- none web1",
+		},
+		{
+			name:     "truncate",
+			template: `{{.message | truncate 5}}|{{.host | truncate 10}}`,
+			expected: "hello|web1",
+		},
+		{
+			name:     "message timestamp",
+			template: `{{timestamp "%Y-%m-%d"}} {{timestamp "unix"}} {{timestamp "rfc3339" .at}}`,
+			expected: "2021-06-01 1622548800 2020-01-02T03:04:05Z",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formatter, err := format.GetFormatterFromString("template", map[string]string{
+				"template": test.template,
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := clogger.NewMessage()
+			msg.EventTime = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+			msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello world"
+			msg.ParsedFields["host"] = "web1"
+			msg.ParsedFields["level"] = "error"
+			msg.ParsedFields["quote"] = `a "b"`
+			msg.ParsedFields["empty"] = ""
+			msg.ParsedFields["at"] = "2020-01-02T03:04:05Z"
+
+			data, err := formatter.Format(&msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != test.expected {
+				t.Fatalf("expected `%s`, got `%s`", test.expected, string(data))
+			}
+		})
+	}
+}
+
+func TestTemplateFormatterConfig(t *testing.T) {
+	if _, err := format.GetFormatterFromString("template", map[string]string{}); err == nil {
+		t.Fatal("expected an error with no template")
+	}
+
+	if _, err := format.GetFormatterFromString("template", map[string]string{"template": "{{.foo"}); err == nil {
+		t.Fatal("expected an error with an invalid template")
+	}
+}
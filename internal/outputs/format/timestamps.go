@@ -0,0 +1,56 @@
+package format
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/strftime"
+)
+
+// namedTimeLayouts are the shorthand layouts that can be used anywhere a formatter takes a time layout
+var namedTimeLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"kitchen":     time.Kitchen,
+	"stamp":       time.Stamp,
+}
+
+// timestampValue is like formatTimestamp, but returns the epoch layouts as numbers rather than strings
+// so that they get encoded as numbers in the structured formats
+func timestampValue(ts time.Time, layout string) interface{} {
+	switch layout {
+	case "unix":
+		return ts.Unix()
+	case "unixms":
+		return ts.UnixNano() / int64(time.Millisecond)
+	case "unixnano":
+		return ts.UnixNano()
+	}
+
+	return formatTimestamp(ts, layout)
+}
+
+// formatTimestamp formats the given time with the layout, which can be a strftime layout (e.g. `%Y-%m-%d`),
+// a Go layout, one of the named layouts (e.g. `rfc3339`), or `unix`/`unixms`/`unixnano`
+func formatTimestamp(ts time.Time, layout string) string {
+	switch layout {
+	case "unix":
+		return strconv.FormatInt(ts.Unix(), 10)
+	case "unixms":
+		return strconv.FormatInt(ts.UnixNano()/int64(time.Millisecond), 10)
+	case "unixnano":
+		return strconv.FormatInt(ts.UnixNano(), 10)
+	}
+
+	if named, ok := namedTimeLayouts[strings.ToLower(layout)]; ok {
+		return ts.Format(named)
+	}
+
+	if strings.ContainsRune(layout, '%') {
+		return strftime.Format(ts, layout)
+	}
+
+	return ts.Format(layout)
+}
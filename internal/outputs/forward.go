@@ -0,0 +1,452 @@
+package outputs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/fluent"
+	"github.com/sinkingpoint/clogger/internal/inputs"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const DEFAULT_FORWARD_TAG = "clogger"
+const DEFAULT_FORWARD_TIMEOUT = 10 * time.Second
+
+type ForwardMode int
+
+const (
+	// FORWARD_MODE_MESSAGE sends each event as its own message
+	FORWARD_MODE_MESSAGE ForwardMode = iota
+
+	// FORWARD_MODE_FORWARD sends the events for each tag as an array of entries
+	FORWARD_MODE_FORWARD
+
+	// FORWARD_MODE_PACKED sends the events for each tag as a concatenated msgpack stream
+	FORWARD_MODE_PACKED
+
+	// FORWARD_MODE_COMPRESSED sends the events for each tag as a gzipped, concatenated msgpack stream
+	FORWARD_MODE_COMPRESSED
+)
+
+type ForwardOutputConfig struct {
+	SendConfig
+	Destination string
+	Mode        ForwardMode
+
+	// Tag is the template used to generate the tag of each event
+	Tag *FieldTemplate
+
+	// MessageKey is the record key that the message field gets sent as
+	MessageKey string
+
+	// RequireAck makes us wait for the server to ack every message before considering it sent
+	RequireAck bool
+
+	// Handshake is the shared key config, or nil if the server doesn't need us to authenticate
+	Handshake *fluent.HandshakeConfig
+	UseTLS    bool
+	TLS       *clogger.TLSConfig
+	Timeout   time.Duration
+}
+
+func newForwardOutputConfigFromRaw(rawConf map[string]string) (ForwardOutputConfig, error) {
+	conf, err := NewSendConfigFromRaw(rawConf)
+	if err != nil {
+		return ForwardOutputConfig{}, err
+	}
+
+	tlsConf, err := clogger.NewTLSConfigFromRaw(rawConf)
+	if err != nil {
+		return ForwardOutputConfig{}, err
+	}
+
+	forwardConf := ForwardOutputConfig{
+		SendConfig:  conf,
+		Destination: inputs.DEFAULT_FORWARD_LISTEN_ADDR,
+		Mode:        FORWARD_MODE_FORWARD,
+		MessageKey:  inputs.DEFAULT_FORWARD_MESSAGE_KEY,
+		UseTLS:      tlsConf.IsEnabled(),
+		TLS:         &tlsConf,
+		Timeout:     DEFAULT_FORWARD_TIMEOUT,
+	}
+
+	if destination, ok := rawConf["destination"]; ok {
+		forwardConf.Destination = destination
+	}
+
+	if mode, ok := rawConf["mode"]; ok {
+		switch mode {
+		case "message":
+			forwardConf.Mode = FORWARD_MODE_MESSAGE
+		case "forward":
+			forwardConf.Mode = FORWARD_MODE_FORWARD
+		case "packed":
+			forwardConf.Mode = FORWARD_MODE_PACKED
+		case "compressed":
+			forwardConf.Mode = FORWARD_MODE_COMPRESSED
+		default:
+			return ForwardOutputConfig{}, fmt.Errorf("invalid `mode` for forward output - expected message, forward, packed, or compressed, got `%s`", mode)
+		}
+	}
+
+	tag := DEFAULT_FORWARD_TAG
+	if t, ok := rawConf["tag"]; ok {
+		tag = t
+	}
+
+	forwardConf.Tag, err = NewFieldTemplate(tag)
+	if err != nil {
+		return ForwardOutputConfig{}, err
+	}
+
+	if key, ok := rawConf["message_key"]; ok {
+		forwardConf.MessageKey = key
+	}
+
+	if ack, ok := rawConf["require_ack"]; ok {
+		forwardConf.RequireAck, err = strconv.ParseBool(ack)
+		if err != nil {
+			return ForwardOutputConfig{}, fmt.Errorf("invalid bool `%s` for `require_ack` in forward output - expected true or false", ack)
+		}
+	}
+
+	if t, ok := rawConf["tls"]; ok {
+		forwardConf.UseTLS, err = strconv.ParseBool(t)
+		if err != nil {
+			return ForwardOutputConfig{}, fmt.Errorf("invalid bool `%s` for `tls` in forward output - expected true or false", t)
+		}
+	}
+
+	if timeout, ok := rawConf["timeout"]; ok {
+		forwardConf.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return ForwardOutputConfig{}, err
+		}
+	}
+
+	forwardConf.Handshake, err = inputs.NewForwardHandshakeConfigFromRaw(rawConf)
+	if err != nil {
+		return ForwardOutputConfig{}, err
+	}
+
+	return forwardConf, nil
+}
+
+// ForwardOutput is an Outputter that sends messages to a Fluentd / Fluent Bit compatible server over the Forward protocol
+type ForwardOutput struct {
+	conf    ForwardOutputConfig
+	conn    net.Conn
+	decoder *msgpack.Decoder
+}
+
+func NewForwardOutput(conf ForwardOutputConfig) (*ForwardOutput, error) {
+	return &ForwardOutput{
+		conf: conf,
+	}, nil
+}
+
+func (f *ForwardOutput) GetSendConfig() SendConfig {
+	return f.conf.SendConfig
+}
+
+func (f *ForwardOutput) Close(ctx context.Context) error {
+	if f.conn != nil {
+		err := f.conn.Close()
+		f.conn = nil
+		f.decoder = nil
+		return err
+	}
+
+	return nil
+}
+
+func (f *ForwardOutput) connect() error {
+	dialer := net.Dialer{
+		Timeout: f.conf.Timeout,
+	}
+
+	var conn net.Conn
+	var err error
+	if f.conf.UseTLS {
+		conn, err = tls.DialWithDialer(&dialer, "tcp", f.conf.Destination, f.conf.TLS.ClientConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", f.conf.Destination)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	decoder := fluent.NewDecoder(bufio.NewReader(conn))
+	if f.conf.Handshake != nil {
+		conn.SetDeadline(time.Now().Add(f.conf.Timeout))
+		if err := f.conf.Handshake.ClientHandshake(decoder, msgpack.NewEncoder(conn)); err != nil {
+			conn.Close()
+			return err
+		}
+
+		conn.SetDeadline(time.Time{})
+	}
+
+	f.conn = conn
+	f.decoder = decoder
+	return nil
+}
+
+// forwardGroup is the events for a single tag, along with the indexes of the messages they came from
+type forwardGroup struct {
+	tag     string
+	entries []fluent.Entry
+	indexes []int
+}
+
+// groupByTag groups the given messages by their tag, preserving the order that each tag was first seen in
+func (f *ForwardOutput) groupByTag(messages []clogger.Message) []*forwardGroup {
+	groups := []*forwardGroup{}
+	index := map[string]*forwardGroup{}
+	for i := range messages {
+		msg := &messages[i]
+		tag, err := f.conf.Tag.Render(msg, msg.EventTime)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to generate tag for message")
+			continue
+		}
+
+		record := make(map[string]interface{}, len(msg.ParsedFields))
+		for key, value := range msg.ParsedFields {
+			if key == clogger.MESSAGE_FIELD {
+				key = f.conf.MessageKey
+			}
+
+			record[key] = value
+		}
+
+		group, ok := index[tag]
+		if !ok {
+			group = &forwardGroup{
+				tag: tag,
+			}
+
+			index[tag] = group
+			groups = append(groups, group)
+		}
+
+		group.entries = append(group.entries, fluent.Entry{
+			Time:   msg.EventTime,
+			Record: record,
+		})
+
+		group.indexes = append(group.indexes, i)
+	}
+
+	return groups
+}
+
+// newChunkID generates a unique ID for the server to ack a message with
+func newChunkID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(id), nil
+}
+
+// encodeGroup encodes the given group in the configured mode, returning the chunk IDs that need to be acked
+func (f *ForwardOutput) encodeGroup(buffer *bytes.Buffer, group *forwardGroup) ([]string, error) {
+	encoder := msgpack.NewEncoder(buffer)
+	chunks := []string{}
+	newOptions := func(size int) (fluent.Options, error) {
+		opts := fluent.Options{
+			Size: size,
+		}
+
+		if f.conf.RequireAck {
+			chunk, err := newChunkID()
+			if err != nil {
+				return opts, err
+			}
+
+			opts.Chunk = chunk
+			chunks = append(chunks, chunk)
+		}
+
+		return opts, nil
+	}
+
+	if f.conf.Mode == FORWARD_MODE_MESSAGE {
+		for _, entry := range group.entries {
+			opts, err := newOptions(1)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := encoder.EncodeArrayLen(4); err != nil {
+				return nil, err
+			}
+
+			if err := encoder.EncodeString(group.tag); err != nil {
+				return nil, err
+			}
+
+			if err := fluent.EncodeTime(encoder, entry.Time); err != nil {
+				return nil, err
+			}
+
+			if err := encoder.EncodeMap(entry.Record); err != nil {
+				return nil, err
+			}
+
+			if err := fluent.EncodeOptions(encoder, opts); err != nil {
+				return nil, err
+			}
+		}
+
+		return chunks, nil
+	}
+
+	opts, err := newOptions(len(group.entries))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := encoder.EncodeArrayLen(3); err != nil {
+		return nil, err
+	}
+
+	if err := encoder.EncodeString(group.tag); err != nil {
+		return nil, err
+	}
+
+	switch f.conf.Mode {
+	case FORWARD_MODE_FORWARD:
+		if err := encoder.EncodeArrayLen(len(group.entries)); err != nil {
+			return nil, err
+		}
+
+		for _, entry := range group.entries {
+			if err := fluent.EncodeEntry(encoder, entry); err != nil {
+				return nil, err
+			}
+		}
+	case FORWARD_MODE_PACKED, FORWARD_MODE_COMPRESSED:
+		var packed bytes.Buffer
+		packedEncoder := msgpack.NewEncoder(&packed)
+		for _, entry := range group.entries {
+			if err := fluent.EncodeEntry(packedEncoder, entry); err != nil {
+				return nil, err
+			}
+		}
+
+		data := packed.Bytes()
+		if f.conf.Mode == FORWARD_MODE_COMPRESSED {
+			opts.Compressed = "gzip"
+			var compressed bytes.Buffer
+			writer := gzip.NewWriter(&compressed)
+			writer.Write(data)
+			if err := writer.Close(); err != nil {
+				return nil, err
+			}
+
+			data = compressed.Bytes()
+		}
+
+		if err := encoder.EncodeBytes(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := fluent.EncodeOptions(encoder, opts); err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+// sendGroup sends the given group, waiting for the acks if required
+func (f *ForwardOutput) sendGroup(group *forwardGroup) error {
+	var buffer bytes.Buffer
+	chunks, err := f.encodeGroup(&buffer, group)
+	if err != nil {
+		return err
+	}
+
+	f.conn.SetDeadline(time.Now().Add(f.conf.Timeout))
+	defer f.conn.SetDeadline(time.Time{})
+
+	if _, err := f.conn.Write(buffer.Bytes()); err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		ack, err := fluent.ReadAck(f.decoder)
+		if err != nil {
+			return err
+		}
+
+		if ack != chunk {
+			return fmt.Errorf("got ack for unexpected chunk `%s`, expected `%s`", ack, chunk)
+		}
+	}
+
+	return nil
+}
+
+func (f *ForwardOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	_, span := tracing.GetTracer().Start(ctx, "ForwardOutput.FlushToOutput")
+	defer span.End()
+
+	groups := f.groupByTag(messages.Messages)
+	span.SetAttributes(attribute.Int("batch_size", len(messages.Messages)), attribute.Int("num_tags", len(groups)))
+
+	if f.conn == nil {
+		if err := f.connect(); err != nil {
+			return OUTPUT_TRANSIENT_FAILURE, err
+		}
+	}
+
+	for i, group := range groups {
+		if err := f.sendGroup(group); err != nil {
+			span.RecordError(err)
+			f.Close(ctx)
+
+			// Only retry the groups that haven't been sent (or acked) yet
+			remaining := []clogger.Message{}
+			for _, unsent := range groups[i:] {
+				for _, index := range unsent.indexes {
+					remaining = append(remaining, messages.Messages[index])
+				}
+			}
+
+			messages.Messages = append(messages.Messages[:0], remaining...)
+			return OUTPUT_TRANSIENT_FAILURE, err
+		}
+	}
+
+	return OUTPUT_SUCCESS, nil
+}
+
+func init() {
+	outputsRegistry.Register("forward", func(rawConf map[string]string) (interface{}, error) {
+		return newForwardOutputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Outputter, error) {
+		if c, ok := conf.(ForwardOutputConfig); ok {
+			return NewForwardOutput(c)
+		}
+
+		return nil, fmt.Errorf("invalid config passed to forward output")
+	})
+}
@@ -0,0 +1,129 @@
+package outputs_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+)
+
+func TestForwardRoundTrip(t *testing.T) {
+	for _, mode := range []string{"message", "forward", "packed", "compressed"} {
+		t.Run(mode, func(t *testing.T) {
+			input, err := inputs.Construct("forward", map[string]string{
+				"listen":     "127.0.0.1:0",
+				"shared_key": "secret",
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := input.Init(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			defer input.Close(context.Background())
+
+			output, err := outputs.Construct("forward", map[string]string{
+				"destination": input.(*inputs.ForwardInput).Addr().String(),
+				"mode":        mode,
+				"tag":         "app.{service}",
+				"require_ack": "true",
+				"shared_key":  "secret",
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer output.Close(context.Background())
+
+			batch := clogger.GetMessageBatch(3)
+			for _, service := range []string{"api", "web", "api"} {
+				msg := clogger.NewMessage()
+				msg.ParsedFields[clogger.MESSAGE_FIELD] = "hello from " + service
+				msg.ParsedFields["service"] = service
+				batch.Messages = append(batch.Messages, msg)
+			}
+
+			// Acks mean that the messages have been handed to the input by the time that this returns
+			if result, err := output.FlushToOutput(context.Background(), batch); result != outputs.OUTPUT_SUCCESS {
+				t.Fatalf("Failed to flush to forward output: %s", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			received := []clogger.Message{}
+			for len(received) < 3 {
+				b, err := input.GetBatch(ctx)
+				if err != nil || b == nil {
+					t.Fatalf("Failed to receive batch: %v", err)
+				}
+
+				received = append(received, b.Messages...)
+			}
+
+			tags := map[string]int{}
+			for _, msg := range received {
+				tags[msg.ParsedFields["tag"].(string)] += 1
+				if msg.ParsedFields[clogger.MESSAGE_FIELD] != "hello from "+msg.ParsedFields["service"].(string) {
+					t.Errorf("Got unexpected fields: %v", msg.ParsedFields)
+				}
+
+				if tag, _ := msg.GetMetadata(clogger.METADATA_TAG); tag != msg.ParsedFields["tag"] {
+					t.Errorf("Expected the tag in the metadata, got %v", msg.Metadata)
+				}
+
+				if inputType, _ := msg.GetMetadata(clogger.METADATA_INPUT_TYPE); inputType != "forward" {
+					t.Errorf("Expected the input type in the metadata, got %v", msg.Metadata)
+				}
+			}
+
+			if tags["app.api"] != 2 || tags["app.web"] != 1 {
+				t.Errorf("Got unexpected tags: %v", tags)
+			}
+
+			if !received[0].EventTime.Equal(batch.Messages[0].EventTime) {
+				t.Errorf("Expected the timestamp to round trip with nanosecond precision")
+			}
+		})
+	}
+}
+
+func TestForwardHandshakeRejectsWrongKey(t *testing.T) {
+	input, err := inputs.Construct("forward", map[string]string{
+		"listen":     "127.0.0.1:0",
+		"shared_key": "secret",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := input.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	defer input.Close(context.Background())
+
+	output, err := outputs.Construct("forward", map[string]string{
+		"destination": input.(*inputs.ForwardInput).Addr().String(),
+		"shared_key":  "wrong",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := clogger.GetMessageBatch(1)
+	batch.Messages = append(batch.Messages, clogger.NewMessage())
+
+	if result, _ := output.FlushToOutput(context.Background(), batch); result != outputs.OUTPUT_TRANSIENT_FAILURE {
+		t.Fatalf("Expected the handshake to fail, got %s", result.ToString())
+	}
+}
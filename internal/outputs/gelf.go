@@ -0,0 +1,313 @@
+package outputs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const DEFAULT_GELF_DESTINATION = "localhost:12201"
+const DEFAULT_GELF_CHUNK_SIZE = 8192
+const DEFAULT_GELF_TIMEOUT = 10 * time.Second
+
+// GELF_MAX_CHUNKS is the maximum number of chunks that a single message can be split into, as per the spec
+const GELF_MAX_CHUNKS = 128
+
+// gelfChunkHeaderSize is the size of the header on each chunk: 2 bytes magic, 8 bytes message ID,
+// 1 byte sequence number, and 1 byte sequence count
+const gelfChunkHeaderSize = 12
+
+type GELFTransport int
+
+const (
+	GELF_TRANSPORT_UDP GELFTransport = iota
+	GELF_TRANSPORT_TCP
+)
+
+type GELFCompression int
+
+const (
+	GELF_COMPRESSION_NONE GELFCompression = iota
+	GELF_COMPRESSION_GZIP
+	GELF_COMPRESSION_ZLIB
+)
+
+type GELFOutputConfig struct {
+	SendConfig
+	Destination string
+	Transport   GELFTransport
+
+	// Compression is the compression to use for UDP datagrams. GELF over TCP can't be compressed
+	Compression GELFCompression
+
+	// ChunkSize is the maximum size of a UDP datagram, above which messages get chunked
+	ChunkSize int
+	Timeout   time.Duration
+}
+
+func newGELFOutputConfigFromRaw(rawConf map[string]string) (GELFOutputConfig, error) {
+	gelfConf := GELFOutputConfig{
+		Destination: DEFAULT_GELF_DESTINATION,
+		Transport:   GELF_TRANSPORT_UDP,
+		Compression: GELF_COMPRESSION_NONE,
+		ChunkSize:   DEFAULT_GELF_CHUNK_SIZE,
+		Timeout:     DEFAULT_GELF_TIMEOUT,
+	}
+
+	if destination, ok := rawConf["destination"]; ok {
+		gelfConf.Destination = destination
+	}
+
+	if transport, ok := rawConf["transport"]; ok {
+		switch transport {
+		case "udp":
+			gelfConf.Transport = GELF_TRANSPORT_UDP
+		case "tcp":
+			gelfConf.Transport = GELF_TRANSPORT_TCP
+		default:
+			return GELFOutputConfig{}, fmt.Errorf("invalid `transport` for GELF output - expected udp or tcp, got `%s`", transport)
+		}
+	}
+
+	if compression, ok := rawConf["compression"]; ok {
+		switch compression {
+		case "none":
+			gelfConf.Compression = GELF_COMPRESSION_NONE
+		case "gzip":
+			gelfConf.Compression = GELF_COMPRESSION_GZIP
+		case "zlib":
+			gelfConf.Compression = GELF_COMPRESSION_ZLIB
+		default:
+			return GELFOutputConfig{}, fmt.Errorf("invalid `compression` for GELF output - expected none, gzip, or zlib, got `%s`", compression)
+		}
+
+		if gelfConf.Transport == GELF_TRANSPORT_TCP && gelfConf.Compression != GELF_COMPRESSION_NONE {
+			return GELFOutputConfig{}, fmt.Errorf("GELF over TCP doesn't support compression")
+		}
+	}
+
+	var err error
+	if chunkSize, ok := rawConf["chunk_size"]; ok {
+		gelfConf.ChunkSize, err = strconv.Atoi(chunkSize)
+		if err != nil || gelfConf.ChunkSize <= gelfChunkHeaderSize {
+			return GELFOutputConfig{}, fmt.Errorf("invalid `chunk_size` for GELF output - expected an int larger than %d, got `%s`", gelfChunkHeaderSize, chunkSize)
+		}
+	}
+
+	if timeout, ok := rawConf["timeout"]; ok {
+		gelfConf.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return GELFOutputConfig{}, err
+		}
+	}
+
+	// GELF outputs always format as GELF, null delimited over TCP
+	formatterConf := make(map[string]string, len(rawConf)+1)
+	for k, v := range rawConf {
+		formatterConf[k] = v
+	}
+
+	formatterConf["null_delimited"] = strconv.FormatBool(gelfConf.Transport == GELF_TRANSPORT_TCP)
+	formatter, err := format.NewGELFFormatterFromRaw(formatterConf)
+	if err != nil {
+		return GELFOutputConfig{}, err
+	}
+
+	gelfConf.SendConfig, err = NewSendConfigFromRaw(rawConf)
+	if err != nil {
+		return GELFOutputConfig{}, err
+	}
+
+	gelfConf.Formatter, err = format.WithProjection(formatter, rawConf)
+	if err != nil {
+		return GELFOutputConfig{}, err
+	}
+
+	return gelfConf, nil
+}
+
+// GELFOutput is an Outputter that sends messages to a Graylog server in the Graylog Extended Log Format
+type GELFOutput struct {
+	conf GELFOutputConfig
+	conn net.Conn
+}
+
+func NewGELFOutput(conf GELFOutputConfig) (*GELFOutput, error) {
+	return &GELFOutput{
+		conf: conf,
+	}, nil
+}
+
+func (g *GELFOutput) GetSendConfig() SendConfig {
+	return g.conf.SendConfig
+}
+
+func (g *GELFOutput) Close(ctx context.Context) error {
+	if g.conn != nil {
+		err := g.conn.Close()
+		g.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+func (g *GELFOutput) connect() error {
+	dialer := net.Dialer{
+		Timeout: g.conf.Timeout,
+	}
+
+	network := "udp"
+	if g.conf.Transport == GELF_TRANSPORT_TCP {
+		network = "tcp"
+	}
+
+	conn, err := dialer.Dial(network, g.conf.Destination)
+	if err != nil {
+		return err
+	}
+
+	g.conn = conn
+	return nil
+}
+
+// compress compresses the given payload with the configured compression
+func (g *GELFOutput) compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+
+	switch g.conf.Compression {
+	case GELF_COMPRESSION_GZIP:
+		writer = gzip.NewWriter(&buffer)
+	case GELF_COMPRESSION_ZLIB:
+		writer = zlib.NewWriter(&buffer)
+	default:
+		return data, nil
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// chunk splits the given payload into GELF chunks if it's too big to fit into a single datagram
+func (g *GELFOutput) chunk(data []byte) ([][]byte, error) {
+	if len(data) <= g.conf.ChunkSize {
+		return [][]byte{data}, nil
+	}
+
+	chunkDataSize := g.conf.ChunkSize - gelfChunkHeaderSize
+	numChunks := (len(data) + chunkDataSize - 1) / chunkDataSize
+	if numChunks > GELF_MAX_CHUNKS {
+		return nil, fmt.Errorf("message is too large to send over GELF - would need %d chunks", numChunks)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, numChunks)
+	for i := 0; i < numChunks; i++ {
+		end := (i + 1) * chunkDataSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk := make([]byte, 0, gelfChunkHeaderSize+end-i*chunkDataSize)
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(numChunks))
+		chunk = append(chunk, data[i*chunkDataSize:end]...)
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+func (g *GELFOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	_, span := tracing.GetTracer().Start(ctx, "GELFOutput.FlushToOutput")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch_size", len(messages.Messages)))
+
+	if g.conn == nil {
+		if err := g.connect(); err != nil {
+			return OUTPUT_TRANSIENT_FAILURE, err
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	for _, msg := range messages.Messages {
+		data, err := g.conf.Formatter.Format(&msg)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to format message")
+			continue
+		}
+
+		if g.conf.Transport == GELF_TRANSPORT_TCP {
+			buffer.Write(data)
+			continue
+		}
+
+		data, err = g.compress(data)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to compress message")
+			continue
+		}
+
+		chunks, err := g.chunk(data)
+		if err != nil {
+			log.Warn().Err(err).Msg("Dropping message")
+			continue
+		}
+
+		for _, chunk := range chunks {
+			if _, err := g.conn.Write(chunk); err != nil {
+				g.Close(ctx)
+				return OUTPUT_TRANSIENT_FAILURE, err
+			}
+		}
+	}
+
+	if buffer.Len() > 0 {
+		g.conn.SetWriteDeadline(time.Now().Add(g.conf.Timeout))
+		if _, err := g.conn.Write(buffer.Bytes()); err != nil {
+			g.Close(ctx)
+			return OUTPUT_TRANSIENT_FAILURE, err
+		}
+	}
+
+	return OUTPUT_SUCCESS, nil
+}
+
+func init() {
+	outputsRegistry.Register("gelf", func(rawConf map[string]string) (interface{}, error) {
+		return newGELFOutputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Outputter, error) {
+		if c, ok := conf.(GELFOutputConfig); ok {
+			return NewGELFOutput(c)
+		}
+
+		return nil, fmt.Errorf("invalid config passed to gelf output")
+	})
+}
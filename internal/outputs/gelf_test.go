@@ -0,0 +1,80 @@
+package outputs_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs/parse"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+)
+
+func TestGELFOutputChunkedUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	output, err := outputs.Construct("gelf", map[string]string{
+		"destination": conn.LocalAddr().String(),
+		"compression": "gzip",
+		"chunk_size":  "64",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer output.Close(context.Background())
+
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = strings.Repeat("a long message ", 50)
+	msg.ParsedFields["level"] = "error"
+	msg.ParsedFields["service"] = "nginx"
+
+	batch := clogger.GetMessageBatch(1)
+	batch.Messages = append(batch.Messages, msg)
+
+	if result, err := output.FlushToOutput(context.Background(), batch); result != outputs.OUTPUT_SUCCESS {
+		t.Fatalf("Failed to flush to GELF output: %s", err)
+	}
+
+	parser := parse.NewGELFParser()
+	c := make(chan clogger.Message, 1)
+	buffer := make([]byte, 65535)
+	numDatagrams := 0
+	for len(c) == 0 {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n > 64 {
+			t.Fatalf("Got a datagram bigger than the chunk size: %d", n)
+		}
+
+		numDatagrams += 1
+		if err := parser.ParseDatagram(context.Background(), append([]byte(nil), buffer[:n]...), c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if numDatagrams < 2 {
+		t.Errorf("Expected the message to be chunked, got %d datagrams", numDatagrams)
+	}
+
+	received := <-c
+	if received.ParsedFields[clogger.MESSAGE_FIELD] != msg.ParsedFields[clogger.MESSAGE_FIELD] || received.ParsedFields["service"] != "nginx" {
+		t.Errorf("Got unexpected fields: %v", received.ParsedFields)
+	}
+
+	// error maps to syslog severity 3, which comes back as a JSON number
+	if received.ParsedFields["level"] != float64(3) {
+		t.Errorf("Expected level 3, got %v", received.ParsedFields["level"])
+	}
+}
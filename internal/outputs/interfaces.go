@@ -2,6 +2,7 @@ package outputs
 
 import (
 	"context"
+	"fmt"
 	"strconv"
 	"time"
 
@@ -25,10 +26,30 @@ const (
 	// OUTPUT_LONG_FAILURE indicates that we failed to send data to the output and we should
 	// buffer it to the buffer destination, if configured - this failure is likely to take a while to resolve
 	OUTPUT_LONG_FAILURE
+
+	// OUTPUT_REJECTED indicates that the output permanently refused the messages left in the batch (e.g. a mapping error),
+	// so retrying them is pointless. They get sent to the buffer destination, if configured, as dead letters but the output itself is still healthy
+	OUTPUT_REJECTED
 )
 
+// PartialRejectionError is returned by outputs that permanently refused some of the messages in a batch, but can retry the rest.
+// The Sender dead letters the Rejected messages straight away, while the result applies to the messages left in the batch
+type PartialRejectionError struct {
+	Rejected *clogger.MessageBatch
+	Err      error
+}
+
+func (p *PartialRejectionError) Error() string {
+	return fmt.Sprintf("%d messages rejected: %s", len(p.Rejected.Messages), p.Err)
+}
+
+func (p *PartialRejectionError) Unwrap() error {
+	return p.Err
+}
+
 // allOutputs is a convenience map to take results and return their strings
 // so that we can iterate all the possible OutputResults for metrics
+// Note: OUTPUT_REJECTED isn't a state that an output can be in, so it's not included here
 var allOutputs = map[OutputResult]string{
 	OUTPUT_SUCCESS:           OUTPUT_SUCCESS.ToString(),
 	OUTPUT_TRANSIENT_FAILURE: OUTPUT_TRANSIENT_FAILURE.ToString(),
@@ -43,6 +64,8 @@ func (o OutputResult) ToString() string {
 		return "transient_failure"
 	case OUTPUT_LONG_FAILURE:
 		return "long_failure"
+	case OUTPUT_REJECTED:
+		return "rejected"
 	}
 
 	log.Fatal().Int("output_result", int(o)).Msg("Missing implementation of `ToString` for OutputResult")
@@ -88,9 +111,12 @@ func NewSendConfigFromRaw(rawConf map[string]string) (SendConfig, error) {
 
 	if s, ok := rawConf["format"]; ok {
 		conf.Formatter, err = format.GetFormatterFromString(s, rawConf)
-		if err != nil {
-			return SendConfig{}, err
-		}
+	} else {
+		conf.Formatter, err = format.WithProjection(conf.Formatter, rawConf)
+	}
+
+	if err != nil {
+		return SendConfig{}, err
 	}
 
 	return conf, nil
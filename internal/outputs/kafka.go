@@ -0,0 +1,302 @@
+package outputs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// KAFKA_IDEMPOTENT_RETRIES is the number of times the idempotent producer retries a request before handing
+// the failure back to the Sender
+const KAFKA_IDEMPOTENT_RETRIES = 3
+
+type KafkaOutputConfig struct {
+	SendConfig
+
+	Brokers []string
+
+	// Topic is the template used to generate the topic for each message
+	Topic *FieldTemplate
+
+	// KeyField is the (optional) field used as the key of each message, which determines the partition that it goes to
+	KeyField string
+
+	// Sarama is the underlying config of the producer (acks, compression etc)
+	Sarama *sarama.Config
+}
+
+// parseKafkaAcks converts the given acks config into the sarama equivalent
+func parseKafkaAcks(s string) (sarama.RequiredAcks, error) {
+	switch strings.ToLower(s) {
+	case "none", "0":
+		return sarama.NoResponse, nil
+	case "leader", "1":
+		return sarama.WaitForLocal, nil
+	case "all", "-1":
+		return sarama.WaitForAll, nil
+	}
+
+	return 0, fmt.Errorf("invalid `acks` for Kafka output - expected none, leader, or all, got `%s`", s)
+}
+
+// parseKafkaCompression converts the given compression config into the sarama equivalent
+func parseKafkaCompression(s string) (sarama.CompressionCodec, error) {
+	switch strings.ToLower(s) {
+	case "none":
+		return sarama.CompressionNone, nil
+	case "gzip":
+		return sarama.CompressionGZIP, nil
+	case "snappy":
+		return sarama.CompressionSnappy, nil
+	case "lz4":
+		return sarama.CompressionLZ4, nil
+	case "zstd":
+		return sarama.CompressionZSTD, nil
+	}
+
+	return 0, fmt.Errorf("invalid `compression` for Kafka output - expected none, gzip, snappy, lz4, or zstd, got `%s`", s)
+}
+
+// NewKafkaOutputConfigFromRaw constructs a KafkaOutputConfig from the given raw config, validating the resulting producer config
+func NewKafkaOutputConfigFromRaw(rawConf map[string]string) (KafkaOutputConfig, error) {
+	conf, err := NewSendConfigFromRaw(rawConf)
+	if err != nil {
+		return KafkaOutputConfig{}, err
+	}
+
+	saramaConf, err := inputs.NewKafkaSaramaConfigFromRaw(rawConf)
+	if err != nil {
+		return KafkaOutputConfig{}, err
+	}
+
+	// We use a sync producer, which requires both of these
+	saramaConf.Producer.Return.Successes = true
+	saramaConf.Producer.Return.Errors = true
+
+	// Retries are handled by the Sender
+	saramaConf.Producer.Retry.Max = 0
+
+	if acks, ok := rawConf["acks"]; ok {
+		saramaConf.Producer.RequiredAcks, err = parseKafkaAcks(acks)
+		if err != nil {
+			return KafkaOutputConfig{}, err
+		}
+	}
+
+	if compression, ok := rawConf["compression"]; ok {
+		saramaConf.Producer.Compression, err = parseKafkaCompression(compression)
+		if err != nil {
+			return KafkaOutputConfig{}, err
+		}
+	}
+
+	if idempotent, ok := rawConf["idempotent"]; ok {
+		saramaConf.Producer.Idempotent, err = strconv.ParseBool(idempotent)
+		if err != nil {
+			return KafkaOutputConfig{}, fmt.Errorf("invalid bool `%s` for `idempotent` in Kafka output - expected true or false", idempotent)
+		}
+
+		if saramaConf.Producer.Idempotent {
+			if !saramaConf.Version.IsAtLeast(sarama.V0_11_0_0) {
+				return KafkaOutputConfig{}, fmt.Errorf("`idempotent` in Kafka output requires a `version` of at least 0.11.0, got `%s`", saramaConf.Version)
+			}
+
+			// The idempotent producer requires acks from all the replicas, only a single in flight request, and
+			// for sarama to do its own retries so that the broker can deduplicate them
+			saramaConf.Producer.RequiredAcks = sarama.WaitForAll
+			saramaConf.Net.MaxOpenRequests = 1
+			saramaConf.Producer.Retry.Max = KAFKA_IDEMPOTENT_RETRIES
+		}
+	}
+
+	if timeout, ok := rawConf["timeout"]; ok {
+		saramaConf.Producer.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return KafkaOutputConfig{}, err
+		}
+	}
+
+	if err := saramaConf.Validate(); err != nil {
+		return KafkaOutputConfig{}, err
+	}
+
+	brokers := inputs.DEFAULT_KAFKA_BROKERS
+	if b, ok := rawConf["brokers"]; ok {
+		brokers = b
+	}
+
+	topicStr, ok := rawConf["topic"]
+	if !ok {
+		return KafkaOutputConfig{}, fmt.Errorf("missing `topic` required for Kafka output")
+	}
+
+	topic, err := NewFieldTemplate(topicStr)
+	if err != nil {
+		return KafkaOutputConfig{}, err
+	}
+
+	return KafkaOutputConfig{
+		SendConfig: conf,
+		Brokers:    strings.Split(brokers, ","),
+		Topic:      topic,
+		KeyField:   rawConf["key_field"],
+		Sarama:     saramaConf,
+	}, nil
+}
+
+// KafkaOutput is an Outputter that produces messages to Kafka topics
+type KafkaOutput struct {
+	conf     KafkaOutputConfig
+	producer sarama.SyncProducer
+}
+
+// NewKafkaOutput constructs a KafkaOutput, connecting to the configured brokers
+func NewKafkaOutput(conf KafkaOutputConfig) (*KafkaOutput, error) {
+	producer, err := sarama.NewSyncProducer(conf.Brokers, conf.Sarama)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKafkaOutputWithProducer(conf, producer), nil
+}
+
+// NewKafkaOutputWithProducer constructs a KafkaOutput with the given producer, incase
+// we want to use something other than the default sarama one
+func NewKafkaOutputWithProducer(conf KafkaOutputConfig, producer sarama.SyncProducer) *KafkaOutput {
+	return &KafkaOutput{
+		conf:     conf,
+		producer: producer,
+	}
+}
+
+func (k *KafkaOutput) GetSendConfig() SendConfig {
+	return k.conf.SendConfig
+}
+
+func (k *KafkaOutput) Close(ctx context.Context) error {
+	return k.producer.Close()
+}
+
+// isRetryableKafkaError returns true if the given produce error is likely to succeed if we try again
+func isRetryableKafkaError(err error) bool {
+	var kerr sarama.KError
+	if errors.As(err, &kerr) {
+		switch kerr {
+		case sarama.ErrMessageSizeTooLarge, sarama.ErrInvalidMessage, sarama.ErrInvalidMessageSize, sarama.ErrInvalidTopic, sarama.ErrTopicAuthorizationFailed:
+			return false
+		}
+	}
+
+	return true
+}
+
+func (k *KafkaOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	_, span := tracing.GetTracer().Start(ctx, "KafkaOutput.FlushToOutput")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch_size", len(messages.Messages)))
+
+	producerMessages := make([]*sarama.ProducerMessage, 0, len(messages.Messages))
+
+	// sent maps each producer message back to the index of the message it came from
+	sent := make(map[*sarama.ProducerMessage]int, len(messages.Messages))
+
+	for i := range messages.Messages {
+		msg := &messages.Messages[i]
+		topic, err := k.conf.Topic.Render(msg, msg.EventTime.UTC())
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to generate topic for message")
+			continue
+		}
+
+		data, err := k.conf.Formatter.Format(msg)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to format message")
+			continue
+		}
+
+		producerMessage := &sarama.ProducerMessage{
+			Topic:     topic,
+			Value:     sarama.ByteEncoder(bytes.TrimRight(data, "\n")),
+			Timestamp: msg.EventTime,
+		}
+
+		if k.conf.KeyField != "" {
+			if key, ok := msg.ParsedFields[k.conf.KeyField]; ok && key != nil {
+				producerMessage.Key = sarama.StringEncoder(fmt.Sprint(key))
+			}
+		}
+
+		producerMessages = append(producerMessages, producerMessage)
+		sent[producerMessage] = i
+	}
+
+	if len(producerMessages) == 0 {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	err := k.producer.SendMessages(producerMessages)
+	if err == nil {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	var producerErrors sarama.ProducerErrors
+	if !errors.As(err, &producerErrors) {
+		// Something went wrong with the whole batch (e.g. we lost the brokers)
+		return OUTPUT_TRANSIENT_FAILURE, err
+	}
+
+	// Compact the batch down to just the failed messages, so that only they get retried or dead lettered
+	failed := make([]int, 0, len(producerErrors))
+	retryable := 0
+	for _, producerErr := range producerErrors {
+		if i, ok := sent[producerErr.Msg]; ok {
+			failed = append(failed, i)
+			if isRetryableKafkaError(producerErr.Err) {
+				retryable += 1
+			}
+		}
+	}
+
+	// Errors don't necessarily come back in order
+	sort.Ints(failed)
+	for j, i := range failed {
+		messages.Messages[j] = messages.Messages[i]
+	}
+
+	messages.Messages = messages.Messages[:len(failed)]
+
+	span.SetAttributes(attribute.Int("failed", len(failed)), attribute.Int("retryable", retryable))
+
+	if retryable > 0 {
+		return OUTPUT_TRANSIENT_FAILURE, producerErrors[0]
+	} else if len(failed) > 0 {
+		return OUTPUT_REJECTED, producerErrors[0]
+	}
+
+	return OUTPUT_SUCCESS, nil
+}
+
+func init() {
+	outputsRegistry.Register("kafka", func(rawConf map[string]string) (interface{}, error) {
+		return NewKafkaOutputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Outputter, error) {
+		if c, ok := conf.(KafkaOutputConfig); ok {
+			return NewKafkaOutput(c)
+		}
+
+		return nil, fmt.Errorf("invalid config passed to kafka output")
+	})
+}
@@ -0,0 +1,107 @@
+package outputs_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+)
+
+// fakeSyncProducer is a sarama.SyncProducer that fails any message with a `fail` field
+// with that error
+type fakeSyncProducer struct {
+	sent []*sarama.ProducerMessage
+}
+
+func (f *fakeSyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return 0, 0, f.SendMessages([]*sarama.ProducerMessage{msg})
+}
+
+func (f *fakeSyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	errs := sarama.ProducerErrors{}
+	for _, msg := range msgs {
+		if msg.Key != nil {
+			key, _ := msg.Key.Encode()
+			if string(key) == "too_large" {
+				errs = append(errs, &sarama.ProducerError{Msg: msg, Err: sarama.ErrMessageSizeTooLarge})
+				continue
+			}
+		}
+
+		f.sent = append(f.sent, msg)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (f *fakeSyncProducer) Close() error {
+	return nil
+}
+
+func TestKafkaOutputRejectsOnlyFailedMessages(t *testing.T) {
+	topic, err := outputs.NewFieldTemplate("logs.{service}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	producer := &fakeSyncProducer{}
+	output := outputs.NewKafkaOutputWithProducer(outputs.KafkaOutputConfig{
+		SendConfig: outputs.SendConfig{
+			Formatter: &format.JSONFormatter{},
+		},
+		Topic:    topic,
+		KeyField: "key",
+	}, producer)
+
+	batch := clogger.GetMessageBatch(3)
+	for _, key := range []string{"a", "too_large", "b"} {
+		msg := clogger.NewMessage()
+		msg.ParsedFields["service"] = "test"
+		msg.ParsedFields["key"] = key
+		batch.Messages = append(batch.Messages, msg)
+	}
+
+	result, _ := output.FlushToOutput(context.Background(), batch)
+	if result != outputs.OUTPUT_REJECTED {
+		t.Fatalf("Expected the batch to be rejected, got %s", result.ToString())
+	}
+
+	if len(batch.Messages) != 1 || batch.Messages[0].ParsedFields["key"] != "too_large" {
+		t.Fatalf("Expected the batch to be compacted to the rejected message, got %v", batch.Messages)
+	}
+
+	if len(producer.sent) != 2 || producer.sent[0].Topic != "logs.test" {
+		t.Fatalf("Expected two messages to be sent to `logs.test`, got %v", producer.sent)
+	}
+}
+
+func TestKafkaOutputIdempotentConfig(t *testing.T) {
+	conf, err := outputs.NewKafkaOutputConfigFromRaw(map[string]string{"topic": "logs", "idempotent": "true", "acks": "leader"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Sarama.Producer.Retry.Max < 1 || conf.Sarama.Producer.RequiredAcks != sarama.WaitForAll || conf.Sarama.Net.MaxOpenRequests != 1 {
+		t.Fatalf("Expected the idempotent producer to be configured with retries, acks from all replicas and one in flight request, got %+v", conf.Sarama.Producer)
+	}
+
+	if _, err := outputs.NewKafkaOutputConfigFromRaw(map[string]string{"topic": "logs", "idempotent": "true", "version": "0.10.2.0"}); err == nil {
+		t.Fatal("Expected an error using the idempotent producer with a Kafka version before 0.11")
+	}
+
+	conf, err = outputs.NewKafkaOutputConfigFromRaw(map[string]string{"topic": "logs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.Sarama.Producer.Retry.Max != 0 {
+		t.Fatalf("Expected sarama retries to be disabled without the idempotent producer, got %d", conf.Sarama.Producer.Retry.Max)
+	}
+}
@@ -0,0 +1,47 @@
+package outputs
+
+import (
+	"regexp"
+	"strings"
+)
+
+var invalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// fieldLabel maps a (possibly dotted) field in a message to a Prometheus style label
+type fieldLabel struct {
+	field string
+	label string
+}
+
+// sanitizeLabel turns the given string into a valid Prometheus style label name
+func sanitizeLabel(s string) string {
+	s = invalidLabelChars.ReplaceAllString(s, "_")
+	if s != "" && s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+
+	return s
+}
+
+// parseFieldLabels parses labels of the form `field1,field2:label2`, where the optional `:label` renames the field
+func parseFieldLabels(s string) []fieldLabel {
+	labels := []fieldLabel{}
+	for _, label := range strings.Split(s, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+
+		field, name := label, label
+		if i := strings.IndexByte(label, ':'); i >= 0 {
+			field, name = label[:i], label[i+1:]
+		}
+
+		labels = append(labels, fieldLabel{
+			field: field,
+			label: sanitizeLabel(name),
+		})
+	}
+
+	return labels
+}
@@ -0,0 +1,368 @@
+package outputs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const DEFAULT_LOKI_URL = "http://localhost:3100/loki/api/v1/push"
+const DEFAULT_LOKI_TIMEOUT = 30 * time.Second
+
+type LokiEncoding int
+
+const (
+	LOKI_ENCODING_PROTOBUF LokiEncoding = iota
+	LOKI_ENCODING_JSON
+)
+
+type LokiOutputConfig struct {
+	SendConfig
+
+	// URL is the full URL of the Loki push API
+	URL string
+
+	// Labels are the fields that get turned into stream labels. Every other field stays in the line
+	Labels []fieldLabel
+
+	// StaticLabels are labels that get added to every stream
+	StaticLabels map[string]string
+
+	// TenantID is the (optional) tenant to send as the `X-Scope-OrgID` header
+	TenantID string
+
+	Encoding LokiEncoding
+	Timeout  time.Duration
+}
+
+func newLokiOutputConfigFromRaw(rawConf map[string]string) (LokiOutputConfig, error) {
+	conf, err := NewSendConfigFromRaw(rawConf)
+	if err != nil {
+		return LokiOutputConfig{}, err
+	}
+
+	lokiConf := LokiOutputConfig{
+		SendConfig: conf,
+		URL:        DEFAULT_LOKI_URL,
+		TenantID:   rawConf["tenant_id"],
+		Encoding:   LOKI_ENCODING_PROTOBUF,
+		Timeout:    DEFAULT_LOKI_TIMEOUT,
+		StaticLabels: map[string]string{
+			"job": "clogger",
+		},
+	}
+
+	if url, ok := rawConf["url"]; ok {
+		lokiConf.URL = url
+	}
+
+	if labels, ok := rawConf["labels"]; ok {
+		lokiConf.Labels = parseFieldLabels(labels)
+	}
+
+	// static_labels are of the form `key1=value1,key2=value2`
+	if staticLabels, ok := rawConf["static_labels"]; ok {
+		lokiConf.StaticLabels = map[string]string{}
+		for _, pair := range strings.Split(staticLabels, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				return LokiOutputConfig{}, fmt.Errorf("invalid static label `%s` in Loki output - expected key=value", pair)
+			}
+
+			lokiConf.StaticLabels[sanitizeLabel(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if encoding, ok := rawConf["encoding"]; ok {
+		switch encoding {
+		case "protobuf":
+			lokiConf.Encoding = LOKI_ENCODING_PROTOBUF
+		case "json":
+			lokiConf.Encoding = LOKI_ENCODING_JSON
+		default:
+			return LokiOutputConfig{}, fmt.Errorf("invalid `encoding` for Loki output - expected `protobuf` or `json`, got `%s`", encoding)
+		}
+	}
+
+	if timeout, ok := rawConf["timeout"]; ok {
+		lokiConf.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return LokiOutputConfig{}, err
+		}
+	}
+
+	return lokiConf, nil
+}
+
+type lokiEntry struct {
+	timestamp time.Time
+	line      string
+}
+
+// lokiStream is a set of entries that share the same labels
+type lokiStream struct {
+	labels  map[string]string
+	key     string
+	entries []lokiEntry
+}
+
+// LokiOutput is an Outputter that groups messages into streams by their labels
+// and pushes them to the Grafana Loki push API
+type LokiOutput struct {
+	conf   LokiOutputConfig
+	client *http.Client
+}
+
+func NewLokiOutput(conf LokiOutputConfig) (*LokiOutput, error) {
+	return &LokiOutput{
+		conf: conf,
+		client: &http.Client{
+			Timeout: conf.Timeout,
+		},
+	}, nil
+}
+
+func (l *LokiOutput) GetSendConfig() SendConfig {
+	return l.conf.SendConfig
+}
+
+func (l *LokiOutput) Close(ctx context.Context) error {
+	l.client.CloseIdleConnections()
+	return nil
+}
+
+// labelString converts the given labels into the Prometheus style string that Loki expects, e.g. `{a="b", c="d"}`
+func labelString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, strconv.Quote(labels[k])))
+	}
+
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// groupStreams splits the given messages into streams by their labels, removing the label fields from the lines
+func (l *LokiOutput) groupStreams(messages []clogger.Message) []*lokiStream {
+	streams := map[string]*lokiStream{}
+	order := []*lokiStream{}
+
+	for i := range messages {
+		msg := &messages[i]
+		labels := make(map[string]string, len(l.conf.StaticLabels)+len(l.conf.Labels))
+		for k, v := range l.conf.StaticLabels {
+			labels[k] = v
+		}
+
+		// Copy the fields so that we can strip out the labels without touching the original message
+		// in case we have to retry
+		line := *msg
+		line.ParsedFields = make(map[string]interface{}, len(msg.ParsedFields))
+
+		for k, v := range msg.ParsedFields {
+			line.ParsedFields[k] = v
+		}
+
+		// Nested label fields stay in the line, as only the top level map has been copied
+		for _, label := range l.conf.Labels {
+			if value, ok := clogger.GetPath(line.ParsedFields, label.field); ok && value != nil {
+				labels[label.label] = fmt.Sprint(value)
+				delete(line.ParsedFields, label.field)
+			}
+		}
+
+		data, err := l.conf.Formatter.Format(&line)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to format message")
+			continue
+		}
+
+		key := labelString(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{
+				labels: labels,
+				key:    key,
+			}
+
+			streams[key] = stream
+			order = append(order, stream)
+		}
+
+		stream.entries = append(stream.entries, lokiEntry{
+			timestamp: msg.EventTime,
+			line:      string(bytes.TrimRight(data, "\n")),
+		})
+	}
+
+	// Loki rejects entries that are out of order within a stream, so send them oldest first
+	for _, stream := range order {
+		sort.SliceStable(stream.entries, func(i, j int) bool {
+			return stream.entries[i].timestamp.Before(stream.entries[j].timestamp)
+		})
+	}
+
+	return order
+}
+
+// encodeProtobuf encodes the given streams as a snappy compressed `logproto.PushRequest`
+func encodeProtobuf(streams []*lokiStream) []byte {
+	var req []byte
+	for _, stream := range streams {
+		var s []byte
+		s = protowire.AppendTag(s, 1, protowire.BytesType)
+		s = protowire.AppendString(s, stream.key)
+		for _, entry := range stream.entries {
+			var ts []byte
+			ts = protowire.AppendTag(ts, 1, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(entry.timestamp.Unix()))
+			ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(entry.timestamp.Nanosecond()))
+
+			var e []byte
+			e = protowire.AppendTag(e, 1, protowire.BytesType)
+			e = protowire.AppendBytes(e, ts)
+			e = protowire.AppendTag(e, 2, protowire.BytesType)
+			e = protowire.AppendString(e, entry.line)
+
+			s = protowire.AppendTag(s, 2, protowire.BytesType)
+			s = protowire.AppendBytes(s, e)
+		}
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, s)
+	}
+
+	return snappy.Encode(nil, req)
+}
+
+// encodeJSON encodes the given streams in the JSON format of the push API
+func encodeJSON(streams []*lokiStream) ([]byte, error) {
+	type jsonStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+
+	req := struct {
+		Streams []jsonStream `json:"streams"`
+	}{
+		Streams: make([]jsonStream, 0, len(streams)),
+	}
+
+	for _, stream := range streams {
+		values := make([][2]string, 0, len(stream.entries))
+		for _, entry := range stream.entries {
+			values = append(values, [2]string{strconv.FormatInt(entry.timestamp.UnixNano(), 10), entry.line})
+		}
+
+		req.Streams = append(req.Streams, jsonStream{
+			Stream: stream.labels,
+			Values: values,
+		})
+	}
+
+	return json.Marshal(req)
+}
+
+// isLokiOutOfOrder returns true if the given error body from Loki is an out of order (or too old) rejection
+// Loki accepts the rest of the push in that case, so retrying would just create duplicates
+func isLokiOutOfOrder(body string) bool {
+	return strings.Contains(body, "out of order") || strings.Contains(body, "too far behind") || strings.Contains(body, "greater_than_max_sample_age")
+}
+
+func (l *LokiOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	ctx, span := tracing.GetTracer().Start(ctx, "LokiOutput.FlushToOutput")
+	defer span.End()
+
+	streams := l.groupStreams(messages.Messages)
+	span.SetAttributes(attribute.Int("batch_size", len(messages.Messages)), attribute.Int("num_streams", len(streams)))
+	if len(streams) == 0 {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	var body []byte
+	var contentType string
+	switch l.conf.Encoding {
+	case LOKI_ENCODING_PROTOBUF:
+		body = encodeProtobuf(streams)
+		contentType = "application/x-protobuf"
+	case LOKI_ENCODING_JSON:
+		var err error
+		body, err = encodeJSON(streams)
+		if err != nil {
+			return OUTPUT_REJECTED, err
+		}
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return OUTPUT_LONG_FAILURE, err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if l.conf.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.conf.TenantID)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return OUTPUT_TRANSIENT_FAILURE, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	err = fmt.Errorf("loki push failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+
+	switch {
+	case isRetryableStatus(resp.StatusCode):
+		return OUTPUT_TRANSIENT_FAILURE, err
+	case resp.StatusCode == http.StatusBadRequest && isLokiOutOfOrder(string(respBody)):
+		return OUTPUT_SUCCESS, err
+	case resp.StatusCode == http.StatusBadRequest:
+		return OUTPUT_REJECTED, err
+	default:
+		return OUTPUT_LONG_FAILURE, err
+	}
+}
+
+func init() {
+	outputsRegistry.Register("loki", func(rawConf map[string]string) (interface{}, error) {
+		return newLokiOutputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Outputter, error) {
+		if c, ok := conf.(LokiOutputConfig); ok {
+			return NewLokiOutput(c)
+		}
+
+		return nil, fmt.Errorf("invalid config passed to loki output")
+	})
+}
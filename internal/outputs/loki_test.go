@@ -0,0 +1,151 @@
+package outputs_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+)
+
+type lokiPushRequest struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+func newTestLokiOutput(t *testing.T, url string) *outputs.LokiOutput {
+	conf, err := outputs.Construct("loki", map[string]string{
+		"url":       url,
+		"labels":    "service,lvl:level",
+		"encoding":  "json",
+		"tenant_id": "test",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conf.(*outputs.LokiOutput)
+}
+
+func TestLokiOutputGroupsStreams(t *testing.T) {
+	var req lokiPushRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Scope-OrgID") != "test" {
+			t.Errorf("Expected tenant header `test`, got `%s`", r.Header.Get("X-Scope-OrgID"))
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode push request: %s", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	output := newTestLokiOutput(t, server.URL)
+
+	// Give the messages decreasing event times so that the entries have to be sorted
+	base := time.Unix(1622548800, 0)
+	batch := clogger.GetMessageBatch(3)
+	for i, service := range []string{"a", "b", "a"} {
+		msg := clogger.NewMessage()
+		msg.EventTime = base.Add(-time.Duration(i) * time.Second)
+		msg.ParsedFields["service"] = service
+		msg.ParsedFields["lvl"] = "info"
+		msg.ParsedFields["request_id"] = "1234"
+		batch.Messages = append(batch.Messages, msg)
+	}
+
+	result, err := output.FlushToOutput(context.Background(), batch)
+	if result != outputs.OUTPUT_SUCCESS {
+		t.Fatalf("Expected success, got %s (%v)", result.ToString(), err)
+	}
+
+	if len(req.Streams) != 2 {
+		t.Fatalf("Expected 2 streams, got %d", len(req.Streams))
+	}
+
+	stream := req.Streams[0]
+	if stream.Stream["service"] != "a" || stream.Stream["level"] != "info" || stream.Stream["job"] != "clogger" {
+		t.Errorf("Got unexpected labels %v", stream.Stream)
+	}
+
+	if len(stream.Values) != 2 {
+		t.Fatalf("Expected 2 entries in the first stream, got %d", len(stream.Values))
+	}
+
+	expectedTimes := []string{strconv.FormatInt(base.Add(-2*time.Second).UnixNano(), 10), strconv.FormatInt(base.UnixNano(), 10)}
+	if stream.Values[0][0] != expectedTimes[0] || stream.Values[1][0] != expectedTimes[1] {
+		t.Errorf("Expected entries with event times %v, got %v", expectedTimes, stream.Values)
+	}
+
+	line := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(stream.Values[0][1]), &line); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := line["service"]; ok {
+		t.Error("Expected the label fields to be removed from the line")
+	}
+
+	if line["request_id"] != "1234" {
+		t.Error("Expected non label fields to stay in the line")
+	}
+}
+
+func TestLokiOutputNestedLabels(t *testing.T) {
+	var req lokiPushRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode push request: %s", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	output, err := outputs.Construct("loki", map[string]string{
+		"url":      server.URL,
+		"labels":   "kubernetes.namespace:namespace",
+		"encoding": "json",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := clogger.NewMessage()
+	msg.ParsedFields["kubernetes"] = map[string]interface{}{"namespace": "prod"}
+	batch := clogger.GetMessageBatch(1)
+	batch.Messages = append(batch.Messages, msg)
+
+	if result, err := output.FlushToOutput(context.Background(), batch); result != outputs.OUTPUT_SUCCESS {
+		t.Fatalf("Expected success, got %s (%v)", result.ToString(), err)
+	}
+
+	if len(req.Streams) != 1 || req.Streams[0].Stream["namespace"] != "prod" {
+		t.Fatalf("Expected the nested field to become a label, got %v", req.Streams)
+	}
+}
+
+func TestLokiOutputBacksOffOnRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	output := newTestLokiOutput(t, server.URL)
+	batch := clogger.SizeOneBatch(clogger.NewMessage())
+
+	if result, _ := output.FlushToOutput(context.Background(), batch); result != outputs.OUTPUT_TRANSIENT_FAILURE {
+		t.Fatalf("Expected a transient failure, got %s", result.ToString())
+	}
+}
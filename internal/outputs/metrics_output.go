@@ -0,0 +1,404 @@
+package outputs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const DEFAULT_METRICS_MAX_SERIES = 1000
+const DEFAULT_METRICS_HELP = "A metric derived from logs by clogger"
+
+// METRICS_OVERFLOW_LABEL_VALUE is the value given to every label of messages that would take a metric past its max series
+const METRICS_OVERFLOW_LABEL_VALUE = "__other__"
+
+var validMetricName = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+
+type MetricType string
+
+const (
+	METRIC_COUNTER   MetricType = "counter"
+	METRIC_GAUGE     MetricType = "gauge"
+	METRIC_HISTOGRAM MetricType = "histogram"
+)
+
+type MetricsOutputConfig struct {
+	SendConfig
+
+	// Name is the full name of the metric, and Help is its description
+	Name string
+	Help string
+
+	Type MetricType
+
+	// ValueField is the (possibly dotted, e.g. `http.latency`) field that holds the value to add to a counter, set a gauge to, or observe in a histogram.
+	// Counters count messages if it's not set
+	ValueField string
+
+	// Labels are the (possibly dotted) fields that get turned into metric labels
+	Labels []fieldLabel
+
+	// Match are field values that messages must have to be counted, e.g. `level=error`
+	Match map[string]string
+
+	// Buckets are the upper bounds of the histogram buckets
+	Buckets []float64
+
+	// MaxSeries caps the number of label combinations. Messages past it are counted with every label set to METRICS_OVERFLOW_LABEL_VALUE
+	MaxSeries int
+}
+
+func newMetricsOutputConfigFromRaw(rawConf map[string]string) (MetricsOutputConfig, error) {
+	conf, err := NewSendConfigFromRaw(rawConf)
+	if err != nil {
+		return MetricsOutputConfig{}, err
+	}
+
+	metricsConf := MetricsOutputConfig{
+		SendConfig: conf,
+		Name:       rawConf["name"],
+		Help:       DEFAULT_METRICS_HELP,
+		Type:       METRIC_COUNTER,
+		ValueField: rawConf["value_field"],
+		Match:      map[string]string{},
+		Buckets:    prometheus.DefBuckets,
+		MaxSeries:  DEFAULT_METRICS_MAX_SERIES,
+	}
+
+	if metricsConf.Name == "" {
+		return MetricsOutputConfig{}, fmt.Errorf("missing `name` in metrics output")
+	}
+
+	if !validMetricName.MatchString(metricsConf.Name) {
+		return MetricsOutputConfig{}, fmt.Errorf("invalid `name` in metrics output - `%s` isn't a valid Prometheus metric name", metricsConf.Name)
+	}
+
+	if help, ok := rawConf["help"]; ok {
+		metricsConf.Help = help
+	}
+
+	if ty, ok := rawConf["metric_type"]; ok {
+		metricsConf.Type = MetricType(strings.ToLower(ty))
+		switch metricsConf.Type {
+		case METRIC_COUNTER, METRIC_GAUGE, METRIC_HISTOGRAM:
+		default:
+			return MetricsOutputConfig{}, fmt.Errorf("invalid `metric_type` in metrics output - expected `counter`, `gauge` or `histogram`, got `%s`", ty)
+		}
+	}
+
+	if metricsConf.Type != METRIC_COUNTER && metricsConf.ValueField == "" {
+		return MetricsOutputConfig{}, fmt.Errorf("missing `value_field` in metrics output, which is required for %ss", metricsConf.Type)
+	}
+
+	if labels, ok := rawConf["labels"]; ok {
+		metricsConf.Labels = parseFieldLabels(labels)
+	}
+
+	// match is of the form `field1=value1,field2=value2`
+	if match, ok := rawConf["match"]; ok {
+		for _, pair := range strings.Split(match, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				return MetricsOutputConfig{}, fmt.Errorf("invalid match `%s` in metrics output - expected field=value", pair)
+			}
+
+			metricsConf.Match[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if buckets, ok := rawConf["buckets"]; ok {
+		if metricsConf.Type != METRIC_HISTOGRAM {
+			return MetricsOutputConfig{}, fmt.Errorf("`buckets` in metrics output is only valid for histograms")
+		}
+
+		metricsConf.Buckets = nil
+		for _, s := range strings.Split(buckets, ",") {
+			bucket, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return MetricsOutputConfig{}, fmt.Errorf("invalid bucket `%s` in metrics output - expected a number", s)
+			}
+
+			if n := len(metricsConf.Buckets); n > 0 && bucket <= metricsConf.Buckets[n-1] {
+				return MetricsOutputConfig{}, fmt.Errorf("invalid `buckets` in metrics output - expected increasing numbers, got `%s`", buckets)
+			}
+
+			metricsConf.Buckets = append(metricsConf.Buckets, bucket)
+		}
+	}
+
+	if s, ok := rawConf["max_series"]; ok {
+		metricsConf.MaxSeries, err = strconv.Atoi(s)
+		if err != nil || metricsConf.MaxSeries <= 0 {
+			return MetricsOutputConfig{}, fmt.Errorf("invalid `max_series` in metrics output - expected a positive int, got `%s`", s)
+		}
+	}
+
+	return metricsConf, nil
+}
+
+// metricSeries tracks the label combinations of a metric, so that MaxSeries is enforced across every
+// output that feeds the same metric
+type metricSeries struct {
+	lock   sync.Mutex
+	series map[string]struct{}
+}
+
+var (
+	metricSeriesLock        sync.Mutex
+	metricSeriesByCollector = map[prometheus.Collector]*metricSeries{}
+)
+
+// seriesFor returns the series tracker of the given collector, creating it if it doesn't exist
+func seriesFor(collector prometheus.Collector) *metricSeries {
+	metricSeriesLock.Lock()
+	defer metricSeriesLock.Unlock()
+
+	series, ok := metricSeriesByCollector[collector]
+	if !ok {
+		series = &metricSeries{
+			series: make(map[string]struct{}),
+		}
+
+		metricSeriesByCollector[collector] = series
+	}
+
+	return series
+}
+
+// MetricsOutput is an Outputter that turns messages into Prometheus metrics, served alongside clogger's own metrics
+type MetricsOutput struct {
+	MetricsOutputConfig
+
+	counter   *prometheus.CounterVec
+	gauge     *prometheus.GaugeVec
+	histogram *prometheus.HistogramVec
+
+	// series is shared with every other output that feeds the same metric
+	series *metricSeries
+}
+
+// registerCollector registers the given collector, returning the existing one if an identical metric
+// has already been registered (e.g. by another output feeding the same metric)
+func registerCollector(collector prometheus.Collector) (prometheus.Collector, error) {
+	if err := prometheus.Register(collector); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			return alreadyRegistered.ExistingCollector, nil
+		}
+
+		return nil, err
+	}
+
+	return collector, nil
+}
+
+func NewMetricsOutput(conf MetricsOutputConfig) (*MetricsOutput, error) {
+	output := &MetricsOutput{
+		MetricsOutputConfig: conf,
+	}
+
+	labels := make([]string, 0, len(conf.Labels))
+	for _, label := range conf.Labels {
+		labels = append(labels, label.label)
+	}
+
+	var collector prometheus.Collector
+	switch conf.Type {
+	case METRIC_GAUGE:
+		collector = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: conf.Name, Help: conf.Help}, labels)
+	case METRIC_HISTOGRAM:
+		collector = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: conf.Name, Help: conf.Help, Buckets: conf.Buckets}, labels)
+	default:
+		collector = prometheus.NewCounterVec(prometheus.CounterOpts{Name: conf.Name, Help: conf.Help}, labels)
+	}
+
+	collector, err := registerCollector(collector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register metric `%s`: %w", conf.Name, err)
+	}
+
+	var ok bool
+	switch conf.Type {
+	case METRIC_GAUGE:
+		output.gauge, ok = collector.(*prometheus.GaugeVec)
+	case METRIC_HISTOGRAM:
+		output.histogram, ok = collector.(*prometheus.HistogramVec)
+	default:
+		output.counter, ok = collector.(*prometheus.CounterVec)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("metric `%s` is already registered with a different type", conf.Name)
+	}
+
+	output.series = seriesFor(collector)
+
+	return output, nil
+}
+
+// Collector returns the Prometheus collector that this output updates
+func (m *MetricsOutput) Collector() prometheus.Collector {
+	switch m.Type {
+	case METRIC_GAUGE:
+		return m.gauge
+	case METRIC_HISTOGRAM:
+		return m.histogram
+	default:
+		return m.counter
+	}
+}
+
+func (m *MetricsOutput) GetSendConfig() SendConfig {
+	return m.SendConfig
+}
+
+func (m *MetricsOutput) Close(ctx context.Context) error {
+	return nil
+}
+
+// matches returns whether the given message has all the configured match values
+func (m *MetricsOutput) matches(msg *clogger.Message) bool {
+	for field, value := range m.Match {
+		actual, _ := clogger.GetPath(msg.ParsedFields, field)
+		if fmt.Sprint(actual) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// labelValues returns the label values for the given message, capped at the max series
+func (m *MetricsOutput) labelValues(msg *clogger.Message) []string {
+	values := make([]string, 0, len(m.Labels))
+	for _, label := range m.Labels {
+		if value, ok := clogger.GetPath(msg.ParsedFields, label.field); ok && value != nil {
+			values = append(values, fmt.Sprint(value))
+		} else {
+			values = append(values, "")
+		}
+	}
+
+	key := strings.Join(values, "\x00")
+
+	m.series.lock.Lock()
+	defer m.series.lock.Unlock()
+	if _, ok := m.series.series[key]; !ok {
+		if len(m.series.series) >= m.MaxSeries {
+			for i := range values {
+				values[i] = METRICS_OVERFLOW_LABEL_VALUE
+			}
+
+			return values
+		}
+
+		m.series.series[key] = struct{}{}
+	}
+
+	return values
+}
+
+// metricValue converts the given field value into a number
+func metricValue(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+
+	return 0, fmt.Errorf("can't convert `%v` to a number", value)
+}
+
+func (m *MetricsOutput) observe(msg *clogger.Message) error {
+	if !m.matches(msg) {
+		return nil
+	}
+
+	value := 1.0
+	if m.ValueField != "" {
+		raw, ok := clogger.GetPath(msg.ParsedFields, m.ValueField)
+		if !ok {
+			return nil
+		}
+
+		var err error
+		value, err = metricValue(raw)
+		if err != nil || math.IsNaN(value) {
+			return fmt.Errorf("invalid value in field `%s` for metric `%s`: %v", m.ValueField, m.Name, raw)
+		}
+	}
+
+	labels := m.labelValues(msg)
+	switch m.Type {
+	case METRIC_GAUGE:
+		m.gauge.WithLabelValues(labels...).Set(value)
+	case METRIC_HISTOGRAM:
+		m.histogram.WithLabelValues(labels...).Observe(value)
+	default:
+		if value < 0 {
+			return fmt.Errorf("invalid value in field `%s` for counter `%s` - counters can't go down, got %v", m.ValueField, m.Name, value)
+		}
+
+		m.counter.WithLabelValues(labels...).Add(value)
+	}
+
+	return nil
+}
+
+func (m *MetricsOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	_, span := tracing.GetTracer().Start(ctx, "MetricsOutput.FlushToOutput")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch_size", len(messages.Messages)))
+
+	var firstError error
+	for i := range messages.Messages {
+		if err := m.observe(&messages.Messages[i]); err != nil && firstError == nil {
+			firstError = err
+		}
+	}
+
+	// OUTPUT_SUCCESS here so that we don't retry - errors are bad data, and retrying would count the good messages twice
+	return OUTPUT_SUCCESS, firstError
+}
+
+func init() {
+	outputsRegistry.Register("metrics", func(rawConf map[string]string) (interface{}, error) {
+		return newMetricsOutputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Outputter, error) {
+		if c, ok := conf.(MetricsOutputConfig); ok {
+			return NewMetricsOutput(c)
+		}
+
+		return nil, fmt.Errorf("invalid config passed to metrics output")
+	})
+}
@@ -0,0 +1,213 @@
+package outputs_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+)
+
+func metricsBatch(fields ...map[string]interface{}) *clogger.MessageBatch {
+	batch := clogger.GetMessageBatch(len(fields))
+	for _, f := range fields {
+		msg := clogger.NewMessage()
+		msg.ParsedFields = f
+		batch.Messages = append(batch.Messages, msg)
+	}
+
+	return batch
+}
+
+func TestMetricsOutputCounter(t *testing.T) {
+	output, err := outputs.Construct("metrics", map[string]string{
+		"name":       "test_log_errors_total",
+		"labels":     "service,http.status:status",
+		"match":      "level=error",
+		"max_series": "2",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := output.FlushToOutput(context.Background(), metricsBatch(
+		map[string]interface{}{"level": "error", "service": "api", "http.status": 500},
+		map[string]interface{}{"level": "error", "service": "api", "http.status": 500},
+		map[string]interface{}{"level": "info", "service": "api", "http.status": 200},
+		map[string]interface{}{"level": "error", "service": "web"},
+		map[string]interface{}{"level": "error", "service": "db"},
+		map[string]interface{}{"level": "error", "service": "cache"},
+	))
+
+	if err != nil || result != outputs.OUTPUT_SUCCESS {
+		t.Fatalf("Failed to flush: result=%v, err=%v", result, err)
+	}
+
+	expected := `
+# HELP test_log_errors_total A metric derived from logs by clogger
+# TYPE test_log_errors_total counter
+test_log_errors_total{service="__other__",status="__other__"} 2
+test_log_errors_total{service="api",status="500"} 2
+test_log_errors_total{service="web",status=""} 1
+`
+
+	if err := testutil.CollectAndCompare(output.(*outputs.MetricsOutput).Collector(), strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetricsOutputHistogramAndGauge(t *testing.T) {
+	histogram, err := outputs.Construct("metrics", map[string]string{
+		"name":        "test_log_latency_seconds",
+		"metric_type": "histogram",
+		"value_field": "latency",
+		"buckets":     "0.1,1",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gauge, err := outputs.Construct("metrics", map[string]string{
+		"name":        "test_log_queue_depth",
+		"metric_type": "gauge",
+		"value_field": "depth",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := metricsBatch(
+		map[string]interface{}{"latency": 0.05, "depth": 3},
+		map[string]interface{}{"latency": "0.5", "depth": "7"},
+		map[string]interface{}{"message": "no value"},
+	)
+
+	for _, output := range []outputs.Outputter{histogram, gauge} {
+		if _, err := output.FlushToOutput(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `
+# HELP test_log_latency_seconds A metric derived from logs by clogger
+# TYPE test_log_latency_seconds histogram
+test_log_latency_seconds_bucket{le="0.1"} 1
+test_log_latency_seconds_bucket{le="1"} 2
+test_log_latency_seconds_bucket{le="+Inf"} 2
+test_log_latency_seconds_sum 0.55
+test_log_latency_seconds_count 2
+`
+
+	if err := testutil.CollectAndCompare(histogram.(*outputs.MetricsOutput).Collector(), strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	if value := testutil.ToFloat64(gauge.(*outputs.MetricsOutput).Collector()); value != 7 {
+		t.Fatalf("expected the gauge to be set to the last value, got %v", value)
+	}
+
+	// Bad values are reported, but don't stop the rest of the batch
+	_, err = histogram.FlushToOutput(context.Background(), metricsBatch(
+		map[string]interface{}{"latency": "slow"},
+		map[string]interface{}{"latency": 2},
+	))
+
+	if err == nil {
+		t.Fatal("expected an error with a non-numeric value")
+	}
+}
+
+func TestMetricsOutputNestedFields(t *testing.T) {
+	output, err := outputs.Construct("metrics", map[string]string{
+		"name":        "test_log_nested_latency_total",
+		"labels":      "http.method:method",
+		"match":       "http.status=500",
+		"value_field": "timing.latency",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = output.FlushToOutput(context.Background(), metricsBatch(
+		map[string]interface{}{"http": map[string]interface{}{"method": "GET", "status": 500}, "timing": map[string]interface{}{"latency": 2}},
+		map[string]interface{}{"http": map[string]interface{}{"method": "GET", "status": 500}, "timing": map[string]interface{}{"latency": 3}},
+		map[string]interface{}{"http": map[string]interface{}{"method": "GET", "status": 200}, "timing": map[string]interface{}{"latency": 7}},
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP test_log_nested_latency_total A metric derived from logs by clogger
+# TYPE test_log_nested_latency_total counter
+test_log_nested_latency_total{method="GET"} 5
+`
+
+	if err := testutil.CollectAndCompare(output.(*outputs.MetricsOutput).Collector(), strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetricsOutputSharedMaxSeries(t *testing.T) {
+	conf := map[string]string{
+		"name":       "test_log_shared_total",
+		"labels":     "service",
+		"max_series": "1",
+	}
+
+	first, err := outputs.Construct("metrics", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := outputs.Construct("metrics", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second output can't add a series past the limit that the first has already reached
+	for output, service := range map[outputs.Outputter]string{first: "api", second: "web"} {
+		if _, err := output.FlushToOutput(context.Background(), metricsBatch(map[string]interface{}{"service": service})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if series := testutil.CollectAndCount(first.(*outputs.MetricsOutput).Collector()); series != 2 {
+		t.Fatalf("expected one series plus the overflow series, got %d", series)
+	}
+}
+
+func TestMetricsOutputConfig(t *testing.T) {
+	invalid := []map[string]string{
+		{},
+		{"name": "not a metric"},
+		{"name": "a", "metric_type": "summary"},
+		{"name": "a", "metric_type": "gauge"},
+		{"name": "a", "buckets": "1,2"},
+		{"name": "a", "metric_type": "histogram", "value_field": "v", "buckets": "2,1"},
+		{"name": "a", "match": "level"},
+		{"name": "a", "max_series": "0"},
+	}
+
+	for _, conf := range invalid {
+		if _, err := outputs.Construct("metrics", conf); err == nil {
+			t.Errorf("Expected an error constructing a metrics output with %v", conf)
+		}
+	}
+
+	// Registering the same metric twice with a different type fails
+	if _, err := outputs.Construct("metrics", map[string]string{"name": "test_log_conflict"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := outputs.Construct("metrics", map[string]string{"name": "test_log_conflict", "metric_type": "gauge", "value_field": "v"}); err == nil {
+		t.Fatal("Expected an error registering a metric with a conflicting type")
+	}
+}
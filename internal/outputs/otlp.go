@@ -0,0 +1,316 @@
+package outputs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/otlp"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const DEFAULT_OTLP_HTTP_ENDPOINT = "http://localhost:4318/v1/logs"
+const DEFAULT_OTLP_GRPC_ENDPOINT = "localhost:4317"
+const DEFAULT_OTLP_TIMEOUT = 10 * time.Second
+
+type OTLPProtocol int
+
+const (
+	OTLP_PROTOCOL_HTTP_PROTOBUF OTLPProtocol = iota
+	OTLP_PROTOCOL_HTTP_JSON
+	OTLP_PROTOCOL_GRPC
+)
+
+type OTLPOutputConfig struct {
+	SendConfig
+
+	// Endpoint is the URL to POST exports to for OTLP/HTTP, or the host:port to connect to for OTLP/gRPC
+	Endpoint string
+	Protocol OTLPProtocol
+
+	// Headers are extra headers (or gRPC metadata) sent with every export, e.g. for auth
+	Headers map[string]string
+
+	// Gzip compresses exports if true
+	Gzip    bool
+	TLS     *clogger.TLSConfig
+	Timeout time.Duration
+}
+
+func newOTLPOutputConfigFromRaw(rawConf map[string]string) (OTLPOutputConfig, error) {
+	conf, err := NewSendConfigFromRaw(rawConf)
+	if err != nil {
+		return OTLPOutputConfig{}, err
+	}
+
+	tls, err := clogger.NewTLSConfigFromRaw(rawConf)
+	if err != nil {
+		return OTLPOutputConfig{}, err
+	}
+
+	otlpConf := OTLPOutputConfig{
+		SendConfig: conf,
+		Protocol:   OTLP_PROTOCOL_HTTP_PROTOBUF,
+		Headers:    map[string]string{},
+		TLS:        &tls,
+		Timeout:    DEFAULT_OTLP_TIMEOUT,
+	}
+
+	if protocol, ok := rawConf["protocol"]; ok {
+		switch protocol {
+		case "http/protobuf":
+			otlpConf.Protocol = OTLP_PROTOCOL_HTTP_PROTOBUF
+		case "http/json":
+			otlpConf.Protocol = OTLP_PROTOCOL_HTTP_JSON
+		case "grpc":
+			otlpConf.Protocol = OTLP_PROTOCOL_GRPC
+		default:
+			return OTLPOutputConfig{}, fmt.Errorf("invalid `protocol` for OTLP output - expected http/protobuf, http/json, or grpc, got `%s`", protocol)
+		}
+	}
+
+	if endpoint, ok := rawConf["endpoint"]; ok {
+		otlpConf.Endpoint = endpoint
+	} else if otlpConf.Protocol == OTLP_PROTOCOL_GRPC {
+		otlpConf.Endpoint = DEFAULT_OTLP_GRPC_ENDPOINT
+	} else {
+		otlpConf.Endpoint = DEFAULT_OTLP_HTTP_ENDPOINT
+	}
+
+	// headers are of the form `key1=value1,key2=value2`
+	if headers, ok := rawConf["headers"]; ok {
+		for _, pair := range strings.Split(headers, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				return OTLPOutputConfig{}, fmt.Errorf("invalid header `%s` in OTLP output - expected key=value", pair)
+			}
+
+			otlpConf.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if compression, ok := rawConf["compression"]; ok {
+		switch compression {
+		case "none":
+			otlpConf.Gzip = false
+		case "gzip":
+			otlpConf.Gzip = true
+		default:
+			return OTLPOutputConfig{}, fmt.Errorf("invalid `compression` for OTLP output - expected none or gzip, got `%s`", compression)
+		}
+	}
+
+	if timeout, ok := rawConf["timeout"]; ok {
+		otlpConf.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return OTLPOutputConfig{}, err
+		}
+	}
+
+	return otlpConf, nil
+}
+
+// OTLPOutput is an Outputter that exports messages as OpenTelemetry logs over OTLP/HTTP or OTLP/gRPC,
+// grouping each batch by resource and instrumentation scope
+type OTLPOutput struct {
+	conf       OTLPOutputConfig
+	httpClient *http.Client
+	grpcConn   *grpc.ClientConn
+	grpcClient collogspb.LogsServiceClient
+}
+
+func NewOTLPOutput(conf OTLPOutputConfig) (*OTLPOutput, error) {
+	output := &OTLPOutput{
+		conf: conf,
+	}
+
+	if conf.Protocol != OTLP_PROTOCOL_GRPC {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if conf.TLS.IsEnabled() {
+			transport.TLSClientConfig = conf.TLS.ClientConfig()
+		}
+
+		output.httpClient = &http.Client{
+			Timeout:   conf.Timeout,
+			Transport: transport,
+		}
+
+		return output, nil
+	}
+
+	options := []grpc.DialOption{}
+	if conf.TLS.IsEnabled() {
+		options = append(options, grpc.WithTransportCredentials(credentials.NewTLS(conf.TLS.ClientConfig())))
+	} else {
+		options = append(options, grpc.WithInsecure())
+	}
+
+	// Dialing is non blocking, so this doesn't fail if the collector is down
+	conn, err := grpc.Dial(conf.Endpoint, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	output.grpcConn = conn
+	output.grpcClient = collogspb.NewLogsServiceClient(conn)
+
+	return output, nil
+}
+
+func (o *OTLPOutput) GetSendConfig() SendConfig {
+	return o.conf.SendConfig
+}
+
+func (o *OTLPOutput) Close(ctx context.Context) error {
+	if o.grpcConn != nil {
+		return o.grpcConn.Close()
+	}
+
+	return nil
+}
+
+func (o *OTLPOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	ctx, span := tracing.GetTracer().Start(ctx, "OTLPOutput.FlushToOutput")
+	defer span.End()
+
+	req := &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: otlp.FromMessages(messages.Messages),
+	}
+
+	span.SetAttributes(attribute.Int("batch_size", len(messages.Messages)), attribute.Int("num_resources", len(req.ResourceLogs)))
+	if len(req.ResourceLogs) == 0 {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	if o.conf.Protocol == OTLP_PROTOCOL_GRPC {
+		return o.exportGRPC(ctx, req)
+	}
+
+	return o.exportHTTP(ctx, req)
+}
+
+func (o *OTLPOutput) exportGRPC(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (OutputResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.conf.Timeout)
+	defer cancel()
+
+	if len(o.conf.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(o.conf.Headers))
+	}
+
+	options := []grpc.CallOption{}
+	if o.conf.Gzip {
+		options = append(options, grpc.UseCompressor("gzip"))
+	}
+
+	_, err := o.grpcClient.Export(ctx, req, options...)
+	if err == nil {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	// These are the codes that the OTLP spec says are retryable
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		return OUTPUT_TRANSIENT_FAILURE, err
+	case codes.InvalidArgument:
+		return OUTPUT_REJECTED, err
+	default:
+		return OUTPUT_LONG_FAILURE, err
+	}
+}
+
+func (o *OTLPOutput) exportHTTP(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (OutputResult, error) {
+	var body []byte
+	var contentType string
+	var err error
+	switch o.conf.Protocol {
+	case OTLP_PROTOCOL_HTTP_JSON:
+		body, err = otlp.MarshalJSON(req)
+		contentType = "application/json"
+	default:
+		body, err = proto.Marshal(req)
+		contentType = "application/x-protobuf"
+	}
+
+	if err != nil {
+		return OUTPUT_REJECTED, err
+	}
+
+	if o.conf.Gzip {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		writer.Write(body)
+		if err := writer.Close(); err != nil {
+			return OUTPUT_LONG_FAILURE, err
+		}
+
+		body = buffer.Bytes()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.conf.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return OUTPUT_LONG_FAILURE, err
+	}
+
+	for key, value := range o.conf.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	httpReq.Header.Set("Content-Type", contentType)
+	if o.conf.Gzip {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := o.httpClient.Do(httpReq)
+	if err != nil {
+		return OUTPUT_TRANSIENT_FAILURE, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 300 {
+		return OUTPUT_SUCCESS, nil
+	}
+
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	err = fmt.Errorf("OTLP export failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+
+	switch {
+	case isRetryableStatus(resp.StatusCode):
+		return OUTPUT_TRANSIENT_FAILURE, err
+	case resp.StatusCode == http.StatusBadRequest:
+		return OUTPUT_REJECTED, err
+	default:
+		return OUTPUT_LONG_FAILURE, err
+	}
+}
+
+func init() {
+	outputsRegistry.Register("otlp", func(rawConf map[string]string) (interface{}, error) {
+		return newOTLPOutputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Outputter, error) {
+		if c, ok := conf.(OTLPOutputConfig); ok {
+			return NewOTLPOutput(c)
+		}
+
+		return nil, fmt.Errorf("invalid config passed to otlp output")
+	})
+}
@@ -0,0 +1,102 @@
+package outputs_test
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/inputs"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+)
+
+// freePort finds a port that nothing is listening on
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func testOTLPRoundTrip(t *testing.T, input *inputs.OTLPInput, outputConf map[string]string) {
+	output, err := outputs.Construct("otlp", outputConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer output.Close(context.Background())
+
+	msg := clogger.NewMessage()
+	msg.ParsedFields[clogger.MESSAGE_FIELD] = "test message"
+	msg.ParsedFields["resource.service.name"] = "api"
+	msg.ParsedFields["span_id"] = "0102030405060708"
+
+	batch := clogger.GetMessageBatch(1)
+	batch.Messages = append(batch.Messages, msg)
+
+	if result, err := output.FlushToOutput(context.Background(), batch); result != outputs.OUTPUT_SUCCESS {
+		t.Fatalf("Failed to flush to OTLP output: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received, err := input.GetBatch(ctx)
+	if err != nil || received == nil {
+		t.Fatalf("Failed to receive batch: %v", err)
+	}
+
+	if len(received.Messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(received.Messages))
+	}
+
+	for key, value := range msg.ParsedFields {
+		if received.Messages[0].ParsedFields[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, received.Messages[0].ParsedFields[key])
+		}
+	}
+}
+
+func TestOTLPOverHTTP(t *testing.T) {
+	for _, protocol := range []string{"http/protobuf", "http/json"} {
+		t.Run(protocol, func(t *testing.T) {
+			input := inputs.NewOTLPInput(inputs.OTLPInputConfig{})
+			server := httptest.NewServer(input)
+			defer server.Close()
+
+			testOTLPRoundTrip(t, input, map[string]string{
+				"endpoint":    server.URL + inputs.OTLP_LOGS_PATH,
+				"protocol":    protocol,
+				"compression": "gzip",
+			})
+		})
+	}
+}
+
+func TestOTLPOverGRPC(t *testing.T) {
+	addr := freePort(t)
+	input, err := inputs.Construct("otlp", map[string]string{
+		"http_listen": "",
+		"grpc_listen": addr,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := input.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	defer input.Close(context.Background())
+
+	testOTLPRoundTrip(t, input.(*inputs.OTLPInput), map[string]string{
+		"endpoint": addr,
+		"protocol": "grpc",
+	})
+}
@@ -0,0 +1,427 @@
+package outputs
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+)
+
+// rotatedTimeFormat is the suffix added to rotated files
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+type FileCompression int
+
+const (
+	FILE_COMPRESSION_NONE FileCompression = iota
+	FILE_COMPRESSION_GZIP
+	FILE_COMPRESSION_ZSTD
+)
+
+func (f FileCompression) extension() string {
+	switch f {
+	case FILE_COMPRESSION_GZIP:
+		return ".gz"
+	case FILE_COMPRESSION_ZSTD:
+		return ".zst"
+	}
+
+	return ""
+}
+
+type FsyncPolicy int
+
+const (
+	// FSYNC_NEVER leaves it up to the OS to decide when to flush writes to disk
+	FSYNC_NEVER FsyncPolicy = iota
+
+	// FSYNC_FLUSH fsyncs the file after every flushed batch
+	FSYNC_FLUSH
+
+	// FSYNC_WRITE fsyncs the file after every message
+	FSYNC_WRITE
+)
+
+// RotationConfig configures how (and if) a file gets rotated
+type RotationConfig struct {
+	// MaxSize is the size in bytes after which a file gets rotated (0 for no limit)
+	MaxSize int64
+
+	// Interval is the age after which a file gets rotated (0 for no limit)
+	Interval time.Duration
+
+	// Compression is the compression that gets applied to rotated files
+	Compression FileCompression
+
+	// MaxFiles is the maximum number of rotated files to keep (0 for no limit)
+	MaxFiles int
+
+	// MaxAge is the maximum age of rotated files to keep (0 for no limit)
+	MaxAge time.Duration
+
+	Fsync FsyncPolicy
+}
+
+// parseByteSize parses sizes of the form `100`, `10KB`, `10MB`, or `1GB`
+func parseByteSize(s string) (int64, error) {
+	multipliers := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"KB", 1 << 10},
+		{"MB", 1 << 20},
+		{"GB", 1 << 30},
+		{"K", 1 << 10},
+		{"M", 1 << 20},
+		{"G", 1 << 30},
+		{"B", 1},
+	}
+
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, m := range multipliers {
+		if strings.HasSuffix(upper, m.suffix) {
+			upper = strings.TrimSpace(strings.TrimSuffix(upper, m.suffix))
+			multiplier = m.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(upper, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size `%s` - expected a positive number with an optional KB, MB, or GB suffix", s)
+	}
+
+	return size * multiplier, nil
+}
+
+// NewRotationConfigFromRaw parses the rotation options of a file output from the given raw config
+func NewRotationConfigFromRaw(rawConf map[string]string) (RotationConfig, error) {
+	conf := RotationConfig{}
+
+	var err error
+	if s, ok := rawConf["max_size"]; ok {
+		conf.MaxSize, err = parseByteSize(s)
+		if err != nil {
+			return RotationConfig{}, err
+		}
+	}
+
+	if s, ok := rawConf["rotate_interval"]; ok {
+		conf.Interval, err = time.ParseDuration(s)
+		if err != nil {
+			return RotationConfig{}, err
+		}
+	}
+
+	if s, ok := rawConf["compression"]; ok {
+		switch s {
+		case "none":
+			conf.Compression = FILE_COMPRESSION_NONE
+		case "gzip":
+			conf.Compression = FILE_COMPRESSION_GZIP
+		case "zstd":
+			conf.Compression = FILE_COMPRESSION_ZSTD
+		default:
+			return RotationConfig{}, fmt.Errorf("invalid `compression` for file output - expected none, gzip, or zstd, got `%s`", s)
+		}
+	}
+
+	if s, ok := rawConf["max_files"]; ok {
+		conf.MaxFiles, err = strconv.Atoi(s)
+		if err != nil || conf.MaxFiles < 0 {
+			return RotationConfig{}, fmt.Errorf("invalid `max_files` for file output - expected a positive int, got `%s`", s)
+		}
+	}
+
+	if s, ok := rawConf["max_age"]; ok {
+		conf.MaxAge, err = time.ParseDuration(s)
+		if err != nil {
+			return RotationConfig{}, err
+		}
+	}
+
+	if s, ok := rawConf["fsync"]; ok {
+		switch s {
+		case "never":
+			conf.Fsync = FSYNC_NEVER
+		case "flush":
+			conf.Fsync = FSYNC_FLUSH
+		case "write":
+			conf.Fsync = FSYNC_WRITE
+		default:
+			return RotationConfig{}, fmt.Errorf("invalid `fsync` for file output - expected never, flush, or write, got `%s`", s)
+		}
+	}
+
+	return conf, nil
+}
+
+// compressing is the set of rotated files that are currently being compressed, across all the rotating files.
+// It's global because a rotatingFile can be closed and reopened (e.g. by a FileOutput with MaxOpenFiles) while its compressions are still running
+var compressing = struct {
+	sync.Mutex
+	paths map[string]struct{}
+}{paths: make(map[string]struct{})}
+
+// isCompressing returns true if the given rotated file, or the compressed file being generated from it, is in the middle of a compression
+func isCompressing(path string, compression FileCompression) bool {
+	compressing.Lock()
+	defer compressing.Unlock()
+
+	_, ok := compressing.paths[strings.TrimSuffix(path, compression.extension())]
+	return ok
+}
+
+// rotatingFile is an append only file that rotates itself according to a RotationConfig
+type rotatingFile struct {
+	conf     RotationConfig
+	path     string
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// compressions tracks the background compressions of rotated files
+	compressions *sync.WaitGroup
+}
+
+func openRotatingFile(path string, conf RotationConfig, compressions *sync.WaitGroup) (*rotatingFile, error) {
+	r := &rotatingFile{
+		conf:         conf,
+		path:         path,
+		compressions: compressions,
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = stat.Size()
+	r.openedAt = time.Now()
+
+	return nil
+}
+
+// Reopen closes and reopens the file at the same path, e.g. after it has been moved by an external logrotate
+func (r *rotatingFile) Reopen() error {
+	if err := r.file.Close(); err != nil {
+		log.Warn().Err(err).Str("path", r.path).Msg("Failed to close file for reopening")
+	}
+
+	return r.open()
+}
+
+// Write writes the given data to the file, rotating it first if necessary
+func (r *rotatingFile) Write(data []byte) (int, error) {
+	if r.shouldRotate(int64(len(data))) {
+		if err := r.Rotate(); err != nil {
+			log.Warn().Err(err).Str("path", r.path).Msg("Failed to rotate file")
+		}
+	}
+
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+
+	if r.conf.Fsync == FSYNC_WRITE {
+		return n, r.file.Sync()
+	}
+
+	return n, nil
+}
+
+// Flush is called at the end of every batch, syncing the file to disk if configured
+func (r *rotatingFile) Flush() error {
+	if r.conf.Fsync == FSYNC_FLUSH {
+		return r.file.Sync()
+	}
+
+	return nil
+}
+
+func (r *rotatingFile) shouldRotate(incoming int64) bool {
+	// Never rotate out empty files
+	if r.size == 0 {
+		return false
+	}
+
+	if r.conf.MaxSize > 0 && r.size+incoming > r.conf.MaxSize {
+		return true
+	}
+
+	return r.conf.Interval > 0 && time.Since(r.openedAt) >= r.conf.Interval
+}
+
+// Rotate moves the current file out of the way (compressing it if configured), opens a new one
+// and cleans up any old files that have fallen out of retention
+func (r *rotatingFile) Rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	rotatedPath := fmt.Sprintf("%s.%s", r.path, time.Now().Format(rotatedTimeFormat))
+	if err := os.Rename(r.path, rotatedPath); err != nil {
+		// Try and keep writing to the existing file if we can't move it
+		if openErr := r.open(); openErr != nil {
+			return openErr
+		}
+
+		return err
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	if r.conf.Compression == FILE_COMPRESSION_NONE {
+		r.enforceRetention()
+		return nil
+	}
+
+	compressing.Lock()
+	compressing.paths[rotatedPath] = struct{}{}
+	compressing.Unlock()
+
+	r.compressions.Add(1)
+	go func() {
+		defer r.compressions.Done()
+		if err := compressFile(rotatedPath, r.conf.Compression); err != nil {
+			log.Warn().Err(err).Str("path", rotatedPath).Msg("Failed to compress rotated file")
+		}
+
+		compressing.Lock()
+		delete(compressing.paths, rotatedPath)
+		compressing.Unlock()
+
+		r.enforceRetention()
+	}()
+
+	return nil
+}
+
+// enforceRetention deletes any rotated files that are older than MaxAge, or beyond the newest MaxFiles
+func (r *rotatingFile) enforceRetention() {
+	if r.conf.MaxFiles <= 0 && r.conf.MaxAge <= 0 {
+		return
+	}
+
+	rotated, err := filepath.Glob(r.path + ".[0-9]*")
+	if err != nil {
+		log.Warn().Err(err).Str("path", r.path).Msg("Failed to list rotated files")
+		return
+	}
+
+	// Files that are in the middle of being compressed don't count towards retention, otherwise we can race with
+	// the compressions and remove files out from underneath them. Uncompressed files that aren't being compressed
+	// (e.g. because the compression failed, or we crashed halfway through it) still count, so that they don't pile up
+	if r.conf.Compression != FILE_COMPRESSION_NONE {
+		settled := rotated[:0]
+		for _, path := range rotated {
+			if !isCompressing(path, r.conf.Compression) {
+				settled = append(settled, path)
+			}
+		}
+
+		rotated = settled
+	}
+
+	// Rotated files are suffixed with a sortable timestamp, so newest first is a reverse sort
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+
+	for i, path := range rotated {
+		expired := r.conf.MaxFiles > 0 && i >= r.conf.MaxFiles
+		if !expired && r.conf.MaxAge > 0 {
+			if stat, err := os.Stat(path); err == nil && time.Since(stat.ModTime()) > r.conf.MaxAge {
+				expired = true
+			}
+		}
+
+		if expired {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Warn().Err(err).Str("path", path).Msg("Failed to remove expired file")
+			}
+		}
+	}
+}
+
+func (r *rotatingFile) Close() error {
+	return r.file.Close()
+}
+
+// compressFile compresses the given file, replacing it with a compressed version
+func compressFile(path string, compression FileCompression) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	compressedPath := path + compression.extension()
+	out, err := os.OpenFile(compressedPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	var writer io.WriteCloser
+	switch compression {
+	case FILE_COMPRESSION_GZIP:
+		writer = gzip.NewWriter(out)
+	case FILE_COMPRESSION_ZSTD:
+		writer, err = zstd.NewWriter(out)
+		if err != nil {
+			out.Close()
+			return err
+		}
+	default:
+		out.Close()
+		return fmt.Errorf("BUG: unhandled compression %d", compression)
+	}
+
+	if _, err := io.Copy(writer, in); err != nil {
+		writer.Close()
+		out.Close()
+		os.Remove(compressedPath)
+		return err
+	}
+
+	if err := writer.Close(); err != nil {
+		out.Close()
+		os.Remove(compressedPath)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		os.Remove(compressedPath)
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -2,6 +2,7 @@ package outputs
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -89,7 +90,8 @@ func (s *Sender) transitionState(ctx context.Context, state OutputResult) {
 	}
 }
 
-// handleLongFailure handles the buffer in the event that the main sender fails
+// handleLongFailure handles the buffer in the event that the main sender fails. Without a buffer channel the messages
+// are dropped without being marked as delivered, so inputs that track delivery will read them again after a restart
 func (s *Sender) handleLongFailure(ctx context.Context) error {
 	_, span := tracing.GetTracer().Start(ctx, "Sender.handleLongFailure")
 	defer span.End()
@@ -107,6 +109,87 @@ func (s *Sender) handleLongFailure(ctx context.Context) error {
 	return nil
 }
 
+// deadLetter sends the given rejected messages to the buffer channel, if configured, taking ownership of the batch.
+// Without one, the messages are done with, so they count as delivered
+func (s *Sender) deadLetter(batch *clogger.MessageBatch) {
+	if s.BufferChannel != nil {
+		s.BufferChannel <- batch
+	} else {
+		log.Warn().Str("step_name", s.name).Int("num_messages", len(batch.Messages)).Msg("Dropping messages rejected by output")
+		batch.Delivered()
+		clogger.PutMessageBatch(batch)
+	}
+}
+
+// handlePartialRejection dead letters the rejected messages of a PartialRejectionError
+func (s *Sender) handlePartialRejection(ctx context.Context, rejection *PartialRejectionError) {
+	_, span := tracing.GetTracer().Start(ctx, "Sender.handlePartialRejection")
+	defer span.End()
+	span.SetAttributes(attribute.Bool("has_bufferchannel", s.BufferChannel != nil), attribute.Int("num_rejected", len(rejection.Rejected.Messages)))
+
+	s.deadLetter(rejection.Rejected)
+}
+
+// handleRejected sends the messages left in the buffer to the buffer channel, if configured, as dead letters
+// Unlike handleLongFailure, this doesn't change the state of the output because the output is still healthy
+func (s *Sender) handleRejected(ctx context.Context) {
+	_, span := tracing.GetTracer().Start(ctx, "Sender.handleRejected")
+	defer span.End()
+	span.SetAttributes(attribute.Bool("has_bufferchannel", s.BufferChannel != nil), attribute.Int("buffer_size", len(s.buffer.Messages)))
+
+	s.deadLetter(clogger.CloneBatch(s.buffer))
+	s.buffer.Messages = s.buffer.Messages[:0]
+	s.lastFlushTime = time.Now()
+	s.transitionState(ctx, OUTPUT_SUCCESS)
+}
+
+// flushToOutput sends the buffer to the output. On a partial failure, outputs remove the messages that they did deliver
+// from the buffer, so any messages that go missing from it (and weren't rejected) are marked as delivered
+func (s *Sender) flushToOutput(ctx context.Context) (OutputResult, error) {
+	pending := map[*clogger.Delivery]int{}
+	for _, msg := range s.buffer.Messages {
+		if msg.Delivery != nil {
+			pending[msg.Delivery]++
+		}
+	}
+
+	result, err := s.sender.FlushToOutput(ctx, s.buffer)
+	if err != nil {
+		// We just log errors - retries etc should be controlled by the OutputResult return
+		log.Debug().Err(err).Int("output_result", int(result)).Msg("Failed to flush output")
+	}
+
+	var rejection *PartialRejectionError
+	if !errors.As(err, &rejection) {
+		rejection = nil
+	}
+
+	if len(pending) > 0 {
+		remaining := s.buffer.Messages
+		if rejection != nil {
+			remaining = append(remaining[:len(remaining):len(remaining)], rejection.Rejected.Messages...)
+		}
+
+		for _, msg := range remaining {
+			if msg.Delivery != nil {
+				pending[msg.Delivery]--
+			}
+		}
+
+		for delivery, delivered := range pending {
+			for ; delivered > 0; delivered-- {
+				delivery.Done()
+			}
+		}
+	}
+
+	if rejection != nil {
+		s.handlePartialRejection(ctx, rejection)
+	}
+
+	return result, err
+}
+
 // doExponentialRetry handles the case where we have transient failures that can be retried
 // Note: This has the potential to cause double counting of logs (at least once delivery)
 func (s *Sender) doExponentialRetry(ctx context.Context) error {
@@ -121,14 +204,12 @@ func (s *Sender) doExponentialRetry(ctx context.Context) error {
 	for i := 1; i < s.MaxBackOffTries; i++ {
 		time.Sleep(backoffTime)
 
-		result, err := s.sender.FlushToOutput(ctx, s.buffer)
-		if err != nil {
-			log.Debug().Err(err).Int("output_result", int(result)).Msg("Failed to flush output")
-		}
+		result, _ := s.flushToOutput(ctx)
 
 		switch result {
 		case OUTPUT_SUCCESS:
 			span.SetAttributes(attribute.Int("success_after", i))
+			s.buffer.Delivered()
 			s.buffer.Messages = s.buffer.Messages[:0]
 			s.lastFlushTime = time.Now()
 
@@ -139,6 +220,10 @@ func (s *Sender) doExponentialRetry(ctx context.Context) error {
 			continue
 		case OUTPUT_LONG_FAILURE:
 			return s.handleLongFailure(ctx)
+		case OUTPUT_REJECTED:
+			span.SetAttributes(attribute.Int("rejected_after", i))
+			s.handleRejected(ctx)
+			return nil
 		}
 	}
 
@@ -173,14 +258,11 @@ func (s *Sender) Flush(ctx context.Context, final bool) {
 
 		s.lastRetryTime = time.Now()
 
-		result, err := s.sender.FlushToOutput(ctx, s.buffer)
-		if err != nil {
-			// We just log errors - retries etc should be controlled by the OutputResult return
-			log.Debug().Err(err).Int("output_result", int(result)).Msg("Failed to flush output")
-		}
+		result, _ := s.flushToOutput(ctx)
 
 		switch result {
 		case OUTPUT_SUCCESS:
+			s.buffer.Delivered()
 			s.buffer.Messages = s.buffer.Messages[:0]
 			s.lastFlushTime = time.Now()
 			s.transitionState(ctx, OUTPUT_SUCCESS)
@@ -192,6 +274,8 @@ func (s *Sender) Flush(ctx context.Context, final bool) {
 			}
 		case OUTPUT_LONG_FAILURE:
 			s.handleLongFailure(ctx)
+		case OUTPUT_REJECTED:
+			s.handleRejected(ctx)
 		}
 	}
 
@@ -2,6 +2,7 @@ package outputs_test
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -41,3 +42,100 @@ func TestSenderFlushesOnFullBuffer(t *testing.T) {
 	// Try and send another message, which should flush the buffer of the previous two messages
 	s.QueueMessages(context.Background(), batch)
 }
+
+// TestSenderDeadLettersPartialRejections tests that messages an output permanently rejects are dead lettered
+// straight away, while the rest of the batch is retried
+func TestSenderDeadLettersPartialRejections(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockOutput := mock_outputs.NewMockOutputter(ctrl)
+	mockOutput.EXPECT().GetSendConfig().Return(outputs.SendConfig{
+		FlushInterval: 10 * time.Second,
+		BatchSize:     10,
+		Formatter:     &format.JSONFormatter{},
+	}).Times(1)
+
+	gomock.InOrder(
+		mockOutput.EXPECT().FlushToOutput(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, batch *clogger.MessageBatch) (outputs.OutputResult, error) {
+			rejected := clogger.GetMessageBatch(1)
+			rejected.Messages = append(rejected.Messages, batch.Messages[1])
+			batch.Messages = batch.Messages[:1]
+			return outputs.OUTPUT_TRANSIENT_FAILURE, &outputs.PartialRejectionError{Rejected: rejected, Err: errors.New("mapping error")}
+		}),
+		mockOutput.EXPECT().FlushToOutput(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, batch *clogger.MessageBatch) (outputs.OutputResult, error) {
+			if len(batch.Messages) != 1 || batch.Messages[0].ParsedFields["id"] != 0 {
+				t.Errorf("Expected only the retryable message to be retried, got %v", batch.Messages)
+			}
+
+			return outputs.OUTPUT_SUCCESS, nil
+		}),
+	)
+
+	s := outputs.NewSender("test", mockOutput)
+	deadLetters := make(chan *clogger.MessageBatch, 1)
+	s.BufferChannel = deadLetters
+
+	batch := clogger.GetMessageBatch(2)
+	for i := 0; i < 2; i++ {
+		msg := clogger.NewMessage()
+		msg.ParsedFields["id"] = i
+		batch.Messages = append(batch.Messages, msg)
+	}
+
+	s.QueueMessages(context.Background(), batch)
+	s.Flush(context.Background(), true)
+
+	select {
+	case rejected := <-deadLetters:
+		if len(rejected.Messages) != 1 || rejected.Messages[0].ParsedFields["id"] != 1 {
+			t.Fatalf("Expected the rejected message to be dead lettered, got %v", rejected.Messages)
+		}
+	default:
+		t.Fatal("Expected the rejected message to be dead lettered")
+	}
+}
+
+// TestSenderMarksDeliveredMessages tests that messages are only marked as delivered once the output has delivered them,
+// including the ones an output removes from the batch after delivering them in a partially failed flush
+func TestSenderMarksDeliveredMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockOutput := mock_outputs.NewMockOutputter(ctrl)
+	mockOutput.EXPECT().GetSendConfig().Return(outputs.SendConfig{
+		FlushInterval: 10 * time.Second,
+		BatchSize:     10,
+		Formatter:     &format.JSONFormatter{},
+	}).Times(1)
+
+	gomock.InOrder(
+		mockOutput.EXPECT().FlushToOutput(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, batch *clogger.MessageBatch) (outputs.OutputResult, error) {
+			// Deliver the first message, but not the second
+			batch.Messages = append(batch.Messages[:0], batch.Messages[1])
+			return outputs.OUTPUT_TRANSIENT_FAILURE, nil
+		}),
+		mockOutput.EXPECT().FlushToOutput(gomock.Any(), gomock.Any()).Return(outputs.OUTPUT_LONG_FAILURE, nil),
+	)
+
+	delivered := map[int]bool{}
+	batch := clogger.GetMessageBatch(2)
+	for i := 0; i < 2; i++ {
+		id := i
+		msg := clogger.NewMessage()
+		msg.Delivery = clogger.NewDelivery(1, func() {
+			delivered[id] = true
+		})
+
+		batch.Messages = append(batch.Messages, msg)
+	}
+
+	s := outputs.NewSender("test", mockOutput)
+	s.MaxBackOffTries = 2
+	s.QueueMessages(context.Background(), batch)
+	s.Flush(context.Background(), true)
+
+	if !delivered[0] || delivered[1] {
+		t.Fatalf("Expected only the message that the output delivered to be marked, got %v", delivered)
+	}
+}
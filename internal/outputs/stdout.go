@@ -45,8 +45,6 @@ func (s *StdOutputter) FlushToOutput(ctx context.Context, messages *clogger.Mess
 	var firstError error
 
 	for _, msg := range messages.Messages {
-		// Add in the timestamp so that it gets pushed
-		msg.ParsedFields["auth_timestamp"] = msg.MonoTimestamp
 		s, err := s.Formatter.Format(&msg)
 		if err != nil {
 			if firstError == nil {
@@ -0,0 +1,241 @@
+package outputs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs/format"
+	"github.com/sinkingpoint/clogger/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const DEFAULT_SYSLOG_DESTINATION = "localhost:514"
+const DEFAULT_SYSLOG_TIMEOUT = 10 * time.Second
+
+type SyslogTransport int
+
+const (
+	SYSLOG_TRANSPORT_UDP SyslogTransport = iota
+	SYSLOG_TRANSPORT_TCP
+	SYSLOG_TRANSPORT_TLS
+)
+
+type SyslogFraming int
+
+const (
+	// SYSLOG_FRAMING_OCTET_COUNTING prefixes each message with its length (RFC 6587 / RFC 5425)
+	SYSLOG_FRAMING_OCTET_COUNTING SyslogFraming = iota
+
+	// SYSLOG_FRAMING_NEWLINE terminates each message with a newline
+	SYSLOG_FRAMING_NEWLINE
+)
+
+type SyslogOutputConfig struct {
+	SendConfig
+	Destination string
+	Transport   SyslogTransport
+	Framing     SyslogFraming
+	TLS         *clogger.TLSConfig
+	Timeout     time.Duration
+}
+
+func newSyslogOutputConfigFromRaw(rawConf map[string]string) (SyslogOutputConfig, error) {
+	conf, err := NewSendConfigFromRaw(rawConf)
+	if err != nil {
+		return SyslogOutputConfig{}, err
+	}
+
+	// Unless we've been told otherwise, syslog outputs should format as syslog
+	if _, ok := rawConf["format"]; !ok {
+		formatter, err := format.NewSyslogFormatterFromRaw(rawConf)
+		if err != nil {
+			return SyslogOutputConfig{}, err
+		}
+
+		conf.Formatter, err = format.WithProjection(formatter, rawConf)
+		if err != nil {
+			return SyslogOutputConfig{}, err
+		}
+	}
+
+	tls, err := clogger.NewTLSConfigFromRaw(rawConf)
+	if err != nil {
+		return SyslogOutputConfig{}, err
+	}
+
+	syslogConf := SyslogOutputConfig{
+		SendConfig:  conf,
+		Destination: DEFAULT_SYSLOG_DESTINATION,
+		Transport:   SYSLOG_TRANSPORT_UDP,
+		Framing:     SYSLOG_FRAMING_OCTET_COUNTING,
+		TLS:         &tls,
+		Timeout:     DEFAULT_SYSLOG_TIMEOUT,
+	}
+
+	if destination, ok := rawConf["destination"]; ok {
+		syslogConf.Destination = destination
+	}
+
+	if transport, ok := rawConf["transport"]; ok {
+		switch transport {
+		case "udp":
+			syslogConf.Transport = SYSLOG_TRANSPORT_UDP
+		case "tcp":
+			syslogConf.Transport = SYSLOG_TRANSPORT_TCP
+		case "tls":
+			syslogConf.Transport = SYSLOG_TRANSPORT_TLS
+		default:
+			return SyslogOutputConfig{}, fmt.Errorf("invalid `transport` for syslog output - expected udp, tcp, or tls, got `%s`", transport)
+		}
+	}
+
+	if framing, ok := rawConf["framing"]; ok {
+		switch framing {
+		case "octet":
+			syslogConf.Framing = SYSLOG_FRAMING_OCTET_COUNTING
+		case "newline":
+			syslogConf.Framing = SYSLOG_FRAMING_NEWLINE
+		default:
+			return SyslogOutputConfig{}, fmt.Errorf("invalid `framing` for syslog output - expected octet or newline, got `%s`", framing)
+		}
+	}
+
+	if timeout, ok := rawConf["timeout"]; ok {
+		syslogConf.Timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return SyslogOutputConfig{}, err
+		}
+	}
+
+	return syslogConf, nil
+}
+
+// SyslogOutput is an Outputter that sends messages to a syslog server over UDP, TCP, or TLS
+type SyslogOutput struct {
+	conf SyslogOutputConfig
+	conn net.Conn
+}
+
+func NewSyslogOutput(conf SyslogOutputConfig) (*SyslogOutput, error) {
+	return &SyslogOutput{
+		conf: conf,
+	}, nil
+}
+
+func (s *SyslogOutput) GetSendConfig() SendConfig {
+	return s.conf.SendConfig
+}
+
+func (s *SyslogOutput) Close(ctx context.Context) error {
+	if s.conn != nil {
+		err := s.conn.Close()
+		s.conn = nil
+		return err
+	}
+
+	return nil
+}
+
+func (s *SyslogOutput) connect() error {
+	dialer := net.Dialer{
+		Timeout: s.conf.Timeout,
+	}
+
+	var err error
+	switch s.conf.Transport {
+	case SYSLOG_TRANSPORT_UDP:
+		s.conn, err = dialer.Dial("udp", s.conf.Destination)
+	case SYSLOG_TRANSPORT_TCP:
+		s.conn, err = dialer.Dial("tcp", s.conf.Destination)
+	case SYSLOG_TRANSPORT_TLS:
+		s.conn, err = tls.DialWithDialer(&dialer, "tcp", s.conf.Destination, s.conf.TLS.ClientConfig())
+	}
+
+	if err != nil {
+		s.conn = nil
+	}
+
+	return err
+}
+
+// frame frames the given message for sending according to the transport and framing config
+func (s *SyslogOutput) frame(buffer *bytes.Buffer, data []byte) {
+	data = bytes.TrimRight(data, "\n")
+	if s.conf.Transport == SYSLOG_TRANSPORT_UDP {
+		buffer.Write(data)
+		return
+	}
+
+	switch s.conf.Framing {
+	case SYSLOG_FRAMING_OCTET_COUNTING:
+		buffer.WriteString(strconv.Itoa(len(data)))
+		buffer.WriteByte(' ')
+		buffer.Write(data)
+	case SYSLOG_FRAMING_NEWLINE:
+		buffer.Write(data)
+		buffer.WriteByte('\n')
+	}
+}
+
+func (s *SyslogOutput) FlushToOutput(ctx context.Context, messages *clogger.MessageBatch) (OutputResult, error) {
+	_, span := tracing.GetTracer().Start(ctx, "SyslogOutput.FlushToOutput")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("batch_size", len(messages.Messages)))
+
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return OUTPUT_TRANSIENT_FAILURE, err
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	for _, msg := range messages.Messages {
+		data, err := s.conf.Formatter.Format(&msg)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to format message")
+			continue
+		}
+
+		s.frame(&buffer, data)
+
+		// Each message gets its own datagram over UDP
+		if s.conf.Transport == SYSLOG_TRANSPORT_UDP {
+			if _, err := s.conn.Write(buffer.Bytes()); err != nil {
+				s.Close(ctx)
+				return OUTPUT_TRANSIENT_FAILURE, err
+			}
+
+			buffer.Reset()
+		}
+	}
+
+	if buffer.Len() > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(s.conf.Timeout))
+		if _, err := s.conn.Write(buffer.Bytes()); err != nil {
+			s.Close(ctx)
+			return OUTPUT_TRANSIENT_FAILURE, err
+		}
+	}
+
+	return OUTPUT_SUCCESS, nil
+}
+
+func init() {
+	outputsRegistry.Register("syslog", func(rawConf map[string]string) (interface{}, error) {
+		return newSyslogOutputConfigFromRaw(rawConf)
+	}, func(conf interface{}) (Outputter, error) {
+		if c, ok := conf.(SyslogOutputConfig); ok {
+			return NewSyslogOutput(c)
+		}
+
+		return nil, fmt.Errorf("invalid config passed to syslog output")
+	})
+}
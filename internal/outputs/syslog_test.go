@@ -0,0 +1,72 @@
+package outputs_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/outputs"
+)
+
+func TestSyslogOutputOctetCounting(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	output, err := outputs.Construct("syslog", map[string]string{
+		"transport":   "tcp",
+		"destination": listener.Addr().String(),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := clogger.GetMessageBatch(2)
+	for _, line := range []string{"first", "second line"} {
+		msg := clogger.NewMessage()
+		msg.ParsedFields[clogger.MESSAGE_FIELD] = line
+		batch.Messages = append(batch.Messages, msg)
+	}
+
+	if result, err := output.FlushToOutput(context.Background(), batch); result != outputs.OUTPUT_SUCCESS {
+		t.Fatalf("Failed to flush: %s", err)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output.Close(context.Background())
+
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{"first", "second line"} {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil {
+			t.Fatalf("Expected an octet count, got `%s`", length)
+		}
+
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasSuffix(string(frame), " "+expected) {
+			t.Errorf("Expected frame to end with `%s`, got `%s`", expected, string(frame))
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package outputs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/clogger"
+	"github.com/sinkingpoint/clogger/internal/strftime"
+)
+
+// templatePart is a single chunk of a FieldTemplate - either a literal string
+// (which may contain strftime directives), or a reference to a field in a message
+type templatePart struct {
+	literal string
+	field   string
+}
+
+// FieldTemplate is a string template that can be rendered against a message, e.g. `logs-{service}-%Y.%m.%d`
+// `{field}` references are replaced with the value of that field in the message, and strftime
+// directives in the rest of the template are replaced with the given time
+type FieldTemplate struct {
+	raw   string
+	parts []templatePart
+}
+
+// NewFieldTemplate parses the given template string into a FieldTemplate
+func NewFieldTemplate(s string) (*FieldTemplate, error) {
+	template := &FieldTemplate{
+		raw: s,
+	}
+
+	remaining := s
+	for len(remaining) > 0 {
+		start := strings.IndexByte(remaining, '{')
+		if start < 0 {
+			template.parts = append(template.parts, templatePart{literal: remaining})
+			break
+		}
+
+		end := strings.IndexByte(remaining[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed `{` in template `%s`", s)
+		}
+
+		end += start
+		field := strings.TrimSpace(remaining[start+1 : end])
+		if field == "" {
+			return nil, fmt.Errorf("empty field reference in template `%s`", s)
+		}
+
+		if start > 0 {
+			template.parts = append(template.parts, templatePart{literal: remaining[:start]})
+		}
+
+		template.parts = append(template.parts, templatePart{field: field})
+		remaining = remaining[end+1:]
+	}
+
+	return template, nil
+}
+
+// IsStatic returns true if the template doesn't reference any fields, i.e. renders the same for every message at a given time
+func (f *FieldTemplate) IsStatic() bool {
+	for _, part := range f.parts {
+		if part.field != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Render renders the template for the given message, using the given time for the strftime directives
+// Returns an error if the message is missing any of the referenced fields
+func (f *FieldTemplate) Render(m *clogger.Message, t time.Time) (string, error) {
+	return f.RenderWith(m, t, nil)
+}
+
+// RenderWith is like Render, but runs every field value through the given check (if not nil) before it's inserted
+// so that callers can reject values that aren't safe in their context
+func (f *FieldTemplate) RenderWith(m *clogger.Message, t time.Time, check func(value string) error) (string, error) {
+	var builder strings.Builder
+	for _, part := range f.parts {
+		if part.field == "" {
+			builder.WriteString(strftime.Format(t, part.literal))
+			continue
+		}
+
+		value, ok := m.ParsedFields[part.field]
+		if !ok || value == nil {
+			return "", fmt.Errorf("message is missing field `%s` required by template `%s`", part.field, f.raw)
+		}
+
+		valueStr := fmt.Sprint(value)
+		if check != nil {
+			if err := check(valueStr); err != nil {
+				return "", fmt.Errorf("invalid value for field `%s` in template `%s`: %w", part.field, f.raw, err)
+			}
+		}
+
+		builder.WriteString(valueStr)
+	}
+
+	return builder.String(), nil
+}
+
+func (f *FieldTemplate) String() string {
+	return f.raw
+}
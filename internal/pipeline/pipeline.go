@@ -3,6 +3,7 @@ package pipeline
 import (
 	"context"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -112,6 +113,41 @@ func (p *Pipeline) handleClose(chanName string) {
 	}
 }
 
+// sendBatch sends the given batch to all the steps linked from the named step
+func (p *Pipeline) sendBatch(name string, batch *clogger.MessageBatch) {
+	// Each step delivers its own copy of the messages, and messages that aren't sent anywhere are done with
+	links := len(p.Pipes[name])
+	if links == 0 {
+		batch.Delivered()
+		return
+	}
+
+	for i := range batch.Messages {
+		batch.Messages[i].Delivery.Add(links - 1)
+	}
+
+	processedLinks := 0
+
+	for _, link := range p.Pipes[name] {
+		if processedLinks >= 1 {
+			batch = clogger.CloneBatch(batch)
+		}
+		p.channels[link.To] <- clogger.CloneBatch(batch)
+		processedLinks += 1
+	}
+}
+
+// sendFlushed sends the messages flushed from an EmittingFilter to all the steps linked from it
+func (p *Pipeline) sendFlushed(name string, messages []clogger.Message) {
+	if len(messages) == 0 {
+		return
+	}
+
+	batch := clogger.GetMessageBatch(len(messages))
+	batch.Messages = append(batch.Messages, messages...)
+	p.sendBatch(name, batch)
+}
+
 func (p *Pipeline) Kill() {
 	p.killChannel <- true
 	p.wg.Wait()
@@ -125,6 +161,7 @@ func (p *Pipeline) Run() {
 	inputWg := sync.WaitGroup{}
 	filterWg := sync.WaitGroup{}
 	inputCloseChannels := map[string]chan bool{}
+	hostname, _ := os.Hostname()
 
 	for name, output := range p.Outputs {
 		if _, ok := p.channels[name]; !ok {
@@ -158,35 +195,54 @@ func (p *Pipeline) Run() {
 		filterWg.Add(1)
 		go func(name string, filter filters.Filter, inputPipe clogger.MessageChannel) {
 			defer filterWg.Done()
-			for batch := range inputPipe {
-				currentIndex := 0
-				for _, msg := range batch.Messages {
-					shouldDrop, err := filter.Filter(context.Background(), &msg)
-					if err != nil {
-						log.Warn().Err(err).Msg("Filter failed")
-					}
+			ctx := filters.ContextWithStepName(context.Background(), name)
+
+			// Filters that generate their own messages get flushed periodically, and once more when their input closes
+			emitter, isEmitter := filter.(filters.EmittingFilter)
+			var flushTicks <-chan time.Time
+			if isEmitter {
+				ticker := time.NewTicker(filters.FLUSH_INTERVAL)
+				defer ticker.Stop()
+				flushTicks = ticker.C
+			}
 
-					if !shouldDrop {
-						batch.Messages[currentIndex] = msg
-						currentIndex += 1
+		loop:
+			for {
+				select {
+				case batch, ok := <-inputPipe:
+					if !ok {
+						break loop
 					}
-				}
 
-				metrics.FilterDropped.WithLabelValues(name).Add(float64(len(batch.Messages) - currentIndex))
-				metrics.MessagesProcessed.WithLabelValues(name, "filter").Add(float64(len(batch.Messages)))
+					currentIndex := 0
+					for _, msg := range batch.Messages {
+						shouldDrop, err := filter.Filter(ctx, &msg)
+						if err != nil {
+							log.Warn().Err(err).Msg("Filter failed")
+						}
 
-				batch.Messages = batch.Messages[:currentIndex]
+						if shouldDrop {
+							msg.Delivery.Done()
+						} else {
+							batch.Messages[currentIndex] = msg
+							currentIndex += 1
+						}
+					}
 
-				processedLinks := 0
+					metrics.FilterDropped.WithLabelValues(name).Add(float64(len(batch.Messages) - currentIndex))
+					metrics.MessagesProcessed.WithLabelValues(name, "filter").Add(float64(len(batch.Messages)))
 
-				for _, link := range p.Pipes[name] {
-					if processedLinks >= 1 {
-						batch = clogger.CloneBatch(batch)
-					}
-					p.channels[link.To] <- clogger.CloneBatch(batch)
-					processedLinks += 1
+					batch.Messages = batch.Messages[:currentIndex]
+					p.sendBatch(name, batch)
+				case now := <-flushTicks:
+					p.sendFlushed(name, emitter.Flush(ctx, now, false))
 				}
 			}
+
+			if isEmitter {
+				p.sendFlushed(name, emitter.Flush(ctx, time.Now(), true))
+			}
+
 			p.handleClose(name)
 
 			log.Debug().Str("filter_name", name).Msg("Filter exited")
@@ -226,16 +282,18 @@ func (p *Pipeline) Run() {
 				}
 
 				if batch != nil {
-					metrics.MessagesProcessed.WithLabelValues(name, "input").Add(float64(len(batch.Messages)))
-					processedLinks := 0
+					for i := range batch.Messages {
+						msg := &batch.Messages[i]
+						msg.SetMetadata(clogger.METADATA_INPUT, name)
 
-					for _, link := range p.Pipes[name] {
-						if processedLinks >= 1 {
-							batch = clogger.CloneBatch(batch)
+						// Keep the source node of messages that have been forwarded from other clogger instances
+						if _, ok := msg.GetMetadata(clogger.METADATA_SOURCE_NODE); !ok && hostname != "" {
+							msg.SetMetadata(clogger.METADATA_SOURCE_NODE, hostname)
 						}
-						p.channels[link.To] <- clogger.CloneBatch(batch)
-						processedLinks += 1
 					}
+
+					metrics.MessagesProcessed.WithLabelValues(name, "input").Add(float64(len(batch.Messages)))
+					p.sendBatch(name, batch)
 				}
 
 				if cancelled {
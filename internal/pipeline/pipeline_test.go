@@ -26,13 +26,13 @@ func TestPipeline(t *testing.T) {
 		batch := clogger.GetMessageBatch(3)
 		batch.Messages = append(batch.Messages, []clogger.Message{
 			{
-				MonoTimestamp: 0,
+				EventTime: time.Unix(0, 0),
 			},
 			{
-				MonoTimestamp: 1,
+				EventTime: time.Unix(1, 0),
 			},
 			{
-				MonoTimestamp: 2,
+				EventTime: time.Unix(2, 0),
 			},
 		}...)
 
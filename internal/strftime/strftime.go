@@ -0,0 +1,108 @@
+package strftime
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// directives maps strftime directives to their equivalent Go time layouts
+var directives = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'L': "000",
+	'f': "000000",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'j': "002",
+	'z': "-0700",
+	'Z': "MST",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'D': "01/02/06",
+	'R': "15:04",
+}
+
+// fractional is the set of directives that render fractional seconds. Go layouts only recognise fractional seconds
+// directly after a `.` or `,`, so these are handled separately from the rest of the directives
+var fractional = map[byte]bool{
+	'L': true,
+	'f': true,
+}
+
+// Format formats the given time according to the strftime style layout, e.g. `%Y.%m.%d`
+// Unknown directives are passed through verbatim
+func Format(t time.Time, layout string) string {
+	var builder strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' || i == len(layout)-1 {
+			builder.WriteByte(layout[i])
+			continue
+		}
+
+		i += 1
+		switch c := layout[i]; c {
+		case '%':
+			builder.WriteByte('%')
+		case 's':
+			builder.WriteString(fmt.Sprint(t.Unix()))
+		case 'L', 'f':
+			// Go only recognises fractional seconds directly after a `.`, so format with one and strip it off
+			builder.WriteString(t.Format("." + directives[c])[1:])
+		default:
+			if goLayout, ok := directives[c]; ok {
+				builder.WriteString(t.Format(goLayout))
+			} else {
+				builder.WriteByte('%')
+				builder.WriteByte(c)
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+// ToLayout converts the given strftime style layout into the equivalent Go time layout, e.g. for parsing times
+// Returns an error if the layout uses directives that don't have a Go equivalent, like `%s`
+func ToLayout(layout string) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' || i == len(layout)-1 {
+			builder.WriteByte(layout[i])
+			continue
+		}
+
+		i += 1
+		c := layout[i]
+		if c == '%' {
+			builder.WriteByte('%')
+			continue
+		}
+
+		goLayout, ok := directives[c]
+		if !ok {
+			return "", fmt.Errorf("strftime directive `%%%c` has no Go layout equivalent", c)
+		}
+
+		if fractional[c] {
+			if prev := builder.String(); prev == "" || (prev[len(prev)-1] != '.' && prev[len(prev)-1] != ',') {
+				return "", fmt.Errorf("strftime directive `%%%c` must directly follow a `.` or `,` to have a Go layout equivalent", c)
+			}
+		}
+
+		builder.WriteString(goLayout)
+	}
+
+	return builder.String(), nil
+}
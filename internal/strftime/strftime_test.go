@@ -0,0 +1,50 @@
+package strftime_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sinkingpoint/clogger/internal/strftime"
+)
+
+func TestFormat(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.UTC)
+	tests := map[string]string{
+		"%Y-%m-%d":        "2024-01-02",
+		"%H:%M:%S.%L":     "03:04:05.123",
+		"%H:%M:%S,%f":     "03:04:05,123456",
+		"%L%f":            "123123456",
+		"%s":              "1704164645",
+		"100%% %q":        "100% %q",
+		"%a, %d %b %Y %T": "Tue, 02 Jan 2024 03:04:05",
+	}
+
+	for layout, expected := range tests {
+		if out := strftime.Format(ts, layout); out != expected {
+			t.Errorf("Format(%q) - expected `%s`, got `%s`", layout, expected, out)
+		}
+	}
+}
+
+func TestToLayout(t *testing.T) {
+	tests := map[string]string{
+		"%Y-%m-%d %H:%M:%S.%L": "2006-01-02 15:04:05.000",
+		"%T,%f":                "15:04:05,000000",
+		"%a, %d %b %Y":         "Mon, 02 Jan 2006",
+	}
+
+	for layout, expected := range tests {
+		out, err := strftime.ToLayout(layout)
+		if err != nil {
+			t.Errorf("ToLayout(%q) failed: %s", layout, err)
+		} else if out != expected {
+			t.Errorf("ToLayout(%q) - expected `%s`, got `%s`", layout, expected, out)
+		}
+	}
+
+	for _, layout := range []string{"%s", "%S%L"} {
+		if _, err := strftime.ToLayout(layout); err == nil {
+			t.Errorf("Expected an error converting %q", layout)
+		}
+	}
+}